@@ -73,16 +73,7 @@ func BenchmarkQuery(b *testing.B) {
 
 	for i := 0; i < b.N; i++ {
 		var got string
-		// TODO
-		//tb.check(stmt.QueryRow(1).Scan(&got))
-		rows := tb.checkRows(stmt.Query(1))
-		if !rows.Next() {
-			b.Fatal("received no row")
-		}
-		tb.check(rows.Scan(&got))
-		if rows.Next() {
-			b.Fatal("received more than one row")
-		}
+		tb.check(stmt.QueryRow(1).Scan(&got))
 		if got != "one" {
 			b.Errorf("query = %q; want one", got)
 			return
@@ -166,7 +157,7 @@ func BenchmarkRoundtripBin(b *testing.B) {
 	b.ReportAllocs()
 	b.ResetTimer()
 
-	var result []byte // TODO RawBytes
+	var result RawBytes
 	for i := 0; i < b.N; i++ {
 		length := min + i
 		if length > max {
@@ -190,14 +181,7 @@ func BenchmarkRoundtripBin(b *testing.B) {
 }
 
 func BenchmarkInterpolation(b *testing.B) {
-	mc := &Conn{
-		cfg: &Config{
-			Loc: time.UTC,
-		},
-		maxPacketAllowed: maxPacketSize,
-		maxWriteSize:     maxPacketSize - 1,
-		buf:              newBuffer(nil),
-	}
+	mc := newTestConn(nil, nil)
 
 	args := []interface{}{
 		int64(42424242),
@@ -218,3 +202,31 @@ func BenchmarkInterpolation(b *testing.B) {
 		}
 	}
 }
+
+func benchmarkScan(b *testing.B, dest ...interface{}) {
+	// a row of len(dest) length-encoded columns of 64 bytes each
+	column := append([]byte{64}, bytes.Repeat([]byte{'x'}, 64)...)
+	rows := &textRows{iRows{
+		conn:    &Conn{cfg: &Config{Loc: time.UTC}},
+		columns: make([]Field, len(dest)),
+		data:    bytes.Repeat(column, len(dest)),
+	}}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := rows.convert(dest); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkScanString(b *testing.B) {
+	var s1, s2, s3, s4 string
+	benchmarkScan(b, &s1, &s2, &s3, &s4)
+}
+
+func BenchmarkScanRawBytes(b *testing.B) {
+	var r1, r2, r3, r4 RawBytes
+	benchmarkScan(b, &r1, &r2, &r3, &r4)
+}
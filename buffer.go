@@ -22,11 +22,12 @@ const defaultBufSize = 4096
 // The buffer is similar to bufio.Reader / Writer but zero-copy-ish
 // Also highly optimized for this particular use case.
 type buffer struct {
-	buf     []byte
-	nc      net.Conn
-	idx     int
-	length  int
-	timeout time.Duration
+	buf      []byte
+	nc       net.Conn
+	idx      int
+	length   int
+	timeout  time.Duration
+	deadline time.Time // deadline of the current command, if any
 }
 
 func newBuffer(nc net.Conn) buffer {
@@ -59,8 +60,8 @@ func (b *buffer) fill(need int) error {
 	b.idx = 0
 
 	for {
-		if b.timeout > 0 {
-			if err := b.nc.SetReadDeadline(time.Now().Add(b.timeout)); err != nil {
+		if b.timeout > 0 || !b.deadline.IsZero() {
+			if err := b.nc.SetReadDeadline(b.readDeadline()); err != nil {
 				return err
 			}
 		}
@@ -89,6 +90,19 @@ func (b *buffer) fill(need int) error {
 	}
 }
 
+// readDeadline returns the earlier one of the command deadline and the
+// deadline given by the read timeout
+func (b *buffer) readDeadline() time.Time {
+	if b.timeout <= 0 {
+		return b.deadline
+	}
+	deadline := time.Now().Add(b.timeout)
+	if !b.deadline.IsZero() && b.deadline.Before(deadline) {
+		return b.deadline
+	}
+	return deadline
+}
+
 // returns next N bytes from buffer.
 // The returned slice is only guaranteed to be valid until the next read
 func (b *buffer) readNext(need int) ([]byte, error) {
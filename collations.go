@@ -8,7 +8,10 @@
 
 package gmysql
 
-const defaultCollation byte = 33 // utf8_general_ci
+const (
+	defaultCollation byte = 45 // utf8mb4_general_ci
+	utf8Collation    byte = 33 // utf8_general_ci
+)
 
 // A list of available collations mapped to the internal ID.
 // To update this map use the following MySQL query:
@@ -248,3 +251,15 @@ var unsafeCollations = map[byte]bool{
 	95: true, // cp932_japanese_ci
 	96: true, // cp932_bin
 }
+
+// A blacklist of charsets which are unsafe to use with multiple statements,
+// since the charset is changed after the connection is established and
+// parameters are interpolated client-side.
+// These multibyte encodings may contains 0x5c (`\`) in their trailing bytes.
+var unsafeCharsets = map[string]bool{
+	"big5":   true,
+	"cp932":  true,
+	"gb2312": true,
+	"gbk":    true,
+	"sjis":   true,
+}
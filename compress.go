@@ -0,0 +1,180 @@
+// gmysql - A MySQL package for Go
+//
+// Copyright 2016 The gmysql Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package gmysql
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+)
+
+// Payloads smaller than this are sent uncompressed, since compressing them
+// does not pay off.
+const minCompressLength = 50
+
+// compIO handles reading and writing of packets in the compressed protocol.
+// It sits between the packet layer and the network buffer: Compressed packets
+// are read from the network buffer and their decompressed payload is handed
+// out by readNext, just like buffer.readNext does for the uncompressed
+// protocol.
+// https://dev.mysql.com/doc/internals/en/compressed-packet-header.html
+type compIO struct {
+	conn     *Conn
+	buf      []byte // decompressed data
+	idx      int    // read position in buf
+	sequence uint8  // sequence number of the compressed packets
+	zr       io.ReadCloser
+	zw       *zlib.Writer
+	zbuf     bytes.Buffer
+}
+
+func newCompIO(conn *Conn) *compIO {
+	return &compIO{
+		conn: conn,
+	}
+}
+
+// returns next N bytes of decompressed data.
+// The returned slice is only guaranteed to be valid until the next read
+func (c *compIO) readNext(need int) ([]byte, error) {
+	for len(c.buf)-c.idx < need {
+		// move remaining data to the beginning
+		if c.idx > 0 {
+			n := copy(c.buf, c.buf[c.idx:])
+			c.buf = c.buf[:n]
+			c.idx = 0
+		}
+
+		if err := c.readCompressedPacket(); err != nil {
+			return nil, err
+		}
+	}
+
+	offset := c.idx
+	c.idx += need
+	return c.buf[offset:c.idx], nil
+}
+
+// reads one compressed packet and appends its payload to the buffer
+func (c *compIO) readCompressedPacket() error {
+	header, err := c.conn.buf.readNext(7)
+	if err != nil {
+		return err
+	}
+
+	// Compressed Payload Length [24 bit]
+	compLen := int(uint32(header[0]) | uint32(header[1])<<8 | uint32(header[2])<<16)
+
+	// Check Compressed Sequence [8 bit]
+	if header[3] != c.sequence {
+		if header[3] > c.sequence {
+			return ErrPktSyncMul
+		}
+		return ErrPktSync
+	}
+	c.sequence++
+
+	// Uncompressed Payload Length [24 bit]
+	uncompLen := int(uint32(header[4]) | uint32(header[5])<<8 | uint32(header[6])<<16)
+
+	payload, err := c.conn.buf.readNext(compLen)
+	if err != nil {
+		return err
+	}
+
+	// payload was sent uncompressed
+	if uncompLen == 0 {
+		c.buf = append(c.buf, payload...)
+		return nil
+	}
+
+	r := bytes.NewReader(payload)
+	if c.zr == nil {
+		if c.zr, err = zlib.NewReader(r); err != nil {
+			return err
+		}
+	} else if err = c.zr.(zlib.Resetter).Reset(r, nil); err != nil {
+		return err
+	}
+
+	pos := len(c.buf)
+	c.buf = reserveBuffer(c.buf, uncompLen)
+	if _, err = io.ReadFull(c.zr, c.buf[pos:]); err != nil {
+		c.buf = c.buf[:pos]
+		return ErrMalformPkt
+	}
+	return nil
+}
+
+// writes the given (uncompressed) packets as one or more compressed packets
+func (c *compIO) writePackets(data []byte) (int, error) {
+	var written int
+
+	for len(data) > 0 {
+		payload := data
+		if len(payload) > maxPacketSize {
+			payload = payload[:maxPacketSize]
+		}
+
+		// reserve space for the header
+		c.zbuf.Reset()
+		c.zbuf.Write([]byte{0, 0, 0, 0, 0, 0, 0})
+
+		uncompLen := len(payload)
+		if uncompLen < minCompressLength {
+			c.zbuf.Write(payload)
+			uncompLen = 0
+		} else {
+			if c.zw == nil {
+				c.zw = zlib.NewWriter(&c.zbuf)
+			} else {
+				c.zw.Reset(&c.zbuf)
+			}
+			if _, err := c.zw.Write(payload); err != nil {
+				return written, err
+			}
+			if err := c.zw.Close(); err != nil {
+				return written, err
+			}
+
+			// send uncompressed if compression did not pay off
+			if c.zbuf.Len()-7 >= uncompLen {
+				c.zbuf.Truncate(7)
+				c.zbuf.Write(payload)
+				uncompLen = 0
+			}
+		}
+
+		pkt := c.zbuf.Bytes()
+		compLen := len(pkt) - 7
+
+		// Compressed Payload Length [24 bit]
+		pkt[0] = byte(compLen)
+		pkt[1] = byte(compLen >> 8)
+		pkt[2] = byte(compLen >> 16)
+
+		// Compressed Sequence [8 bit]
+		pkt[3] = c.sequence
+
+		// Uncompressed Payload Length [24 bit]
+		pkt[4] = byte(uncompLen)
+		pkt[5] = byte(uncompLen >> 8)
+		pkt[6] = byte(uncompLen >> 16)
+
+		if _, err := c.conn.netConn.Write(pkt); err != nil {
+			return written, err
+		}
+		c.sequence++
+
+		written += len(payload)
+		data = data[len(payload):]
+	}
+
+	return written, nil
+}
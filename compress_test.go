@@ -0,0 +1,90 @@
+// gmysql - A MySQL package for Go
+//
+// Copyright 2016 The gmysql Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package gmysql
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+// loopbackConn is a net.Conn which returns everything written to it on read.
+type loopbackConn struct {
+	net.Conn
+	data bytes.Buffer
+}
+
+func (lc *loopbackConn) Read(b []byte) (int, error) {
+	return lc.data.Read(b)
+}
+
+func (lc *loopbackConn) Write(b []byte) (int, error) {
+	return lc.data.Write(b)
+}
+
+func (lc *loopbackConn) Close() error {
+	return nil
+}
+
+func newCompressedLoopbackConn() (*Conn, *loopbackConn) {
+	nc := new(loopbackConn)
+	conn := newTestConn(nc, nil)
+	conn.maxPacketAllowed = 3 * maxPacketSize
+	conn.compIO = newCompIO(conn)
+	return conn, nc
+}
+
+func TestCompressRoundtrip(t *testing.T) {
+	payloads := [][]byte{
+		[]byte("SELECT 1"), // below minCompressLength, sent uncompressed
+		bytes.Repeat([]byte("gmysql "), 1000),
+		bytes.Repeat([]byte{0xAB}, 2*maxPacketSize+7), // split packets
+	}
+
+	for i, payload := range payloads {
+		conn, nc := newCompressedLoopbackConn()
+
+		pkt := make([]byte, 4+len(payload))
+		copy(pkt[4:], payload)
+		if err := conn.writePacket(pkt); err != nil {
+			t.Fatalf("%d: writePacket failed: %v", i, err)
+		}
+		if nc.data.Len() >= len(pkt) && i > 0 {
+			t.Errorf("%d: expected compressed size < %d, got %d", i, len(pkt), nc.data.Len())
+		}
+
+		// read back what was written
+		conn.sequence = 0
+		conn.compIO.sequence = 0
+		got, err := conn.readPacket()
+		if err != nil {
+			t.Fatalf("%d: readPacket failed: %v", i, err)
+		}
+		if !bytes.Equal(got, payload) {
+			t.Errorf("%d: payload mismatch (len %d != %d)", i, len(got), len(payload))
+		}
+	}
+}
+
+func TestCompressSequence(t *testing.T) {
+	conn, _ := newCompressedLoopbackConn()
+
+	pkt := make([]byte, 4+8)
+	copy(pkt[4:], "SELECT 1")
+	if err := conn.writePacket(pkt); err != nil {
+		t.Fatal(err)
+	}
+
+	// the compressed packet was sent with sequence 0, expect 1
+	conn.sequence = 0
+	conn.compIO.sequence = 1
+	if _, err := conn.readPacket(); err != ErrBadConn {
+		t.Errorf("expected ErrBadConn, got %v", err)
+	}
+}
@@ -9,18 +9,40 @@
 package gmysql
 
 import (
+	"errors"
+	"io"
 	"net"
+	"reflect"
 	"strconv"
 	"strings"
 	"time"
 )
 
+var (
+	errMaxExecTimeNoSelect = errors.New("MAX_EXECUTION_TIME can only be used with SELECT statements")
+	errZeroDateTime        = errors.New("zero time.Time args are not allowed with zeroDateTimeBehavior=error")
+	errInvalidVarName      = errors.New("invalid system variable name")
+	errRowStreamed         = errors.New("the row is streamed by a ColumnReader and can not be read again")
+	errSliceArg            = errors.New("slice args require interpolateParams, prepared statements do not support them")
+)
+
 // Conn represents a database connection.
 type Conn struct {
 	buf              buffer
 	netConn          net.Conn
+	compIO           *compIO
+	stmtCache        *stmtCache
+	infileReader     io.Reader // set during ExecInfile
+	splitBuf         []byte    // reused to assemble split packets of a result
+	serverVersion    string
+	threadID         uint32
+	cipher           []byte // scramble of the handshake, reused by ChangeUser
+	authPlugin       string // plugin requested by the last auth switch request
+	currentDB        string // tracked via clientSessionTrack
 	affectedRows     uint64
 	insertID         uint64
+	warnings         uint16
+	info             string // info string of the last OK packet
 	cfg              *Config
 	maxPacketAllowed int
 	maxWriteSize     int
@@ -28,7 +50,16 @@ type Conn struct {
 	flags            clientFlag
 	status           statusFlag
 	sequence         uint8
+	lastCommand      byte   // reported if the packet sequence gets out of sync
+	lastQuery        string // prefix of the query or statement of lastCommand
 	strict           bool
+	warningsPending  bool // strict mode warnings to be read after the last result
+	stats            ConnStats
+	noUtf8mb4        bool // server is older than MySQL 5.5.3
+	idleBroken       bool // server closed the connection before answering a command
+	generation       uint // number of reconnects, statements of older ones are invalid
+	lazy             bool // not connected yet, see NewLazyConn
+	noTLS            bool // server does not support TLS, see Config.TLSPreferred
 }
 
 // DialFunc is a function which can be used to establish the network connection.
@@ -49,20 +80,42 @@ func RegisterDial(net string, dial DialFunc) {
 
 // Open opens a new connection
 func Open(dsn string) (*Conn, error) {
-	var err error
+	cfg, err := ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return OpenConfig(cfg)
+}
 
-	// New mysqlConn
-	conn := &Conn{
-		maxPacketAllowed: maxPacketSize,
-		maxWriteSize:     maxPacketSize - 1,
+// OpenConfig opens a new connection using the given Config instead of a DSN
+// string. Unset fields are filled with the same defaults ParseDSN uses.
+// The Config is copied and can be modified or reused afterwards.
+func OpenConfig(cfg *Config) (*Conn, error) {
+	conn, err := newConn(cfg)
+	if err != nil {
+		return nil, err
 	}
-	conn.cfg, err = ParseDSN(dsn)
+	if err = conn.dial(); err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// NewLazyConn returns a connection using the given Config like OpenConfig, but
+// without connecting to the server. The connection is established by the first
+// command, e.g. Exec, Query or Ping, which returns the error if it fails. The
+// connection can not be used anymore in that case.
+func NewLazyConn(cfg *Config) (*Conn, error) {
+	conn, err := newConn(cfg)
 	if err != nil {
 		return nil, err
 	}
-	conn.strict = conn.cfg.Strict
+	conn.lazy = true
+	return conn, nil
+}
 
-	// Connect to Server
+// dial connects to the server and authenticates.
+func (conn *Conn) dial() (err error) {
 	if dial, ok := dials[conn.cfg.Net]; ok {
 		conn.netConn, err = dial(conn.cfg.Addr)
 	} else {
@@ -70,16 +123,56 @@ func Open(dsn string) (*Conn, error) {
 		conn.netConn, err = nd.Dial(conn.cfg.Net, conn.cfg.Addr)
 	}
 	if err != nil {
+		return
+	}
+	return conn.handshake()
+}
+
+// connect connects a lazy connection on its first use. It returns
+// ErrInvalidConn if the connection is closed.
+func (conn *Conn) connect() error {
+	if conn.netConn != nil {
+		return nil
+	}
+	if !conn.lazy {
+		return ErrInvalidConn
+	}
+	conn.lazy = false
+	return conn.dial()
+}
+
+// newConn returns an unconnected Conn with a normalized copy of cfg.
+func newConn(cfg *Config) (*Conn, error) {
+	conn := &Conn{
+		maxPacketAllowed: maxPacketSize,
+		maxWriteSize:     maxPacketSize - 1,
+	}
+	cfgCopy := *cfg
+	conn.cfg = &cfgCopy
+	if err := conn.cfg.normalize(); err != nil {
 		return nil, err
 	}
+	conn.strict = conn.cfg.Strict
+	return conn, nil
+}
 
+// handshake sets up the freshly dialed network connection and authenticates.
+// The network connection is closed if it fails.
+func (conn *Conn) handshake() error {
 	// Enable TCP Keepalives on TCP connections
 	if tc, ok := conn.netConn.(*net.TCPConn); ok {
 		if err := tc.SetKeepAlive(true); err != nil {
 			// Don't send COM_QUIT before handshake.
 			conn.netConn.Close()
 			conn.netConn = nil
-			return nil, err
+			return err
+		}
+		if conn.cfg.KeepAlive > 0 {
+			if err := tc.SetKeepAlivePeriod(conn.cfg.KeepAlive); err != nil {
+				conn.netConn.Close()
+				conn.netConn = nil
+				return err
+			}
 		}
 	}
 
@@ -93,31 +186,43 @@ func Open(dsn string) (*Conn, error) {
 	cipher, err := conn.readInitPacket()
 	if err != nil {
 		conn.cleanup()
-		return nil, err
+		return err
 	}
+	conn.cipher = cipher
 
 	// Send Client Authentication Packet
 	if err = conn.writeAuthPacket(cipher); err != nil {
 		conn.cleanup()
-		return nil, err
+		return err
 	}
 
+	conn.currentDB = conn.cfg.DBName
+
 	// Handle response to auth packet, switch methods if possible
 	if err = conn.handleAuthResult(cipher); err != nil {
 		// Authentication failed and MySQL has already closed the connection
 		// (https://dev.mysql.com/doc/internals/en/authentication-fails.html).
 		// Do not send COM_QUIT, just cleanup and return the error.
 		conn.cleanup()
-		return nil, err
+		return err
 	}
 
-	// Get max allowed packet size
-	maxap, err := conn.getSystemVar("max_allowed_packet")
-	if err != nil {
-		conn.Close()
-		return nil, err
+	// Switch to the compressed protocol if it was negotiated
+	if conn.cfg.Compress && conn.flags&clientCompress != 0 {
+		conn.compIO = newCompIO(conn)
+	}
+
+	// Get max allowed packet size, unless it is configured
+	maxap := conn.cfg.MaxAllowedPacket
+	if maxap == 0 {
+		v, err := conn.getSystemVar("max_allowed_packet")
+		if err != nil {
+			conn.Close()
+			return err
+		}
+		maxap = stringToInt(v)
 	}
-	conn.maxPacketAllowed = stringToInt(maxap) - 1
+	conn.maxPacketAllowed = maxap - 1
 	if conn.maxPacketAllowed < maxPacketSize {
 		conn.maxWriteSize = conn.maxPacketAllowed
 	}
@@ -126,10 +231,14 @@ func Open(dsn string) (*Conn, error) {
 	err = conn.handleParams()
 	if err != nil {
 		conn.Close()
-		return nil, err
+		return err
 	}
 
-	return conn, nil
+	if conn.cfg.StmtCacheSize > 0 {
+		conn.stmtCache = newStmtCache(conn.cfg.StmtCacheSize)
+	}
+
+	return nil
 }
 
 func (conn *Conn) handleAuthResult(cipher []byte) (err error) {
@@ -143,7 +252,10 @@ func (conn *Conn) handleAuthResult(cipher []byte) (err error) {
 	}
 
 	// Retry auth if configured to do so.
-	if conn.cfg.AllowOldPasswords && err == ErrOldPassword {
+	if err == errAuthSwitch {
+		// Retry with the plugin and cipher sent along with the auth switch request
+		err = conn.authSwitch(conn.authPlugin, conn.cipher)
+	} else if conn.cfg.AllowOldPasswords && err == ErrOldPassword {
 		// Retry with old authentication method. Note: there are edge cases
 		// where this should work but doesn't; this is currently "wontfix":
 		// https://github.com/go-sql-driver/mysql/issues/184
@@ -163,8 +275,102 @@ func (conn *Conn) handleAuthResult(cipher []byte) (err error) {
 	return
 }
 
+// authSwitch authenticates with the plugin and the cipher requested by an auth
+// switch request of the server.
+func (conn *Conn) authSwitch(plugin string, cipher []byte) error {
+	passwd := []byte(conn.cfg.Passwd)
+
+	switch plugin {
+	case "mysql_native_password":
+		if err := conn.writeNativeAuthPacket(cipher); err != nil {
+			return err
+		}
+		return conn.readResultOK()
+
+	case "caching_sha2_password":
+		if err := conn.writeAuthSwitchPacket(scrambleSHA256Password(cipher, passwd)); err != nil {
+			return err
+		}
+		data, err := conn.readAuthMoreData()
+		if data == nil || err != nil {
+			return err
+		}
+		switch {
+		case len(data) == 1 && data[0] == 3:
+			// fast auth succeeded, the password hash was cached by the server
+			return conn.readResultOK()
+		case len(data) == 1 && data[0] == 4:
+			// full auth required, the password is sent in clear text over
+			// secure connections and encrypted with the server key otherwise
+			if conn.secureTransport() {
+				return conn.clearPasswordAuth()
+			}
+			return conn.writeEncryptedPassword(cipher, []byte{2})
+		}
+		return ErrMalformPkt
+
+	case "sha256_password":
+		if len(passwd) == 0 {
+			if err := conn.writeAuthSwitchPacket([]byte{0}); err != nil {
+				return err
+			}
+			return conn.readResultOK()
+		}
+		if conn.cfg.TLS != nil && !conn.noTLS {
+			return conn.clearPasswordAuth()
+		}
+		return conn.writeEncryptedPassword(cipher, []byte{1})
+	}
+	return ErrUnknownPlugin
+}
+
+// secureTransport reports whether the password may be sent in clear text,
+// i.e. over TLS or a unix socket.
+func (conn *Conn) secureTransport() bool {
+	return (conn.cfg.TLS != nil && !conn.noTLS) || conn.cfg.Net == "unix"
+}
+
+// clearPasswordAuth sends the password in clear text.
+func (conn *Conn) clearPasswordAuth() error {
+	if err := conn.writeClearAuthPacket(); err != nil {
+		return err
+	}
+	return conn.readResultOK()
+}
+
+// writeEncryptedPassword requests the RSA public key of the server with the
+// given request and sends the password encrypted with it.
+func (conn *Conn) writeEncryptedPassword(cipher, request []byte) error {
+	if err := conn.writeAuthSwitchPacket(request); err != nil {
+		return err
+	}
+	pemKey, err := conn.readAuthMoreData()
+	if pemKey == nil || err != nil {
+		if err == nil {
+			err = ErrMalformPkt
+		}
+		return err
+	}
+	enc, err := encryptPassword(cipher, []byte(conn.cfg.Passwd), pemKey)
+	if err != nil {
+		return err
+	}
+	if err = conn.writeAuthSwitchPacket(enc); err != nil {
+		return err
+	}
+	return conn.readResultOK()
+}
+
 // Handles parameters set in DSN after the connection is established
 func (conn *Conn) handleParams() (err error) {
+	// The handshake used the default collation, the server rejects this one
+	// if it does not support it
+	if name := conn.cfg.UnknownCollation; name != "" {
+		if err = conn.exec("SET NAMES " + collationCharset(name) + " COLLATE " + name); err != nil {
+			return
+		}
+	}
+
 	for param, val := range conn.cfg.Params {
 		switch param {
 		// Charset
@@ -189,9 +395,31 @@ func (conn *Conn) handleParams() (err error) {
 			}
 		}
 	}
+
+	if conn.cfg.AutoLoc {
+		err = conn.detectLoc()
+	}
 	return
 }
 
+// detectLoc sets the location for time.Time values to the current offset of
+// the session time zone, which might have been set by the DSN params.
+func (conn *Conn) detectLoc() error {
+	var name, systemName string
+	var offset int
+	err := conn.QueryRow(
+		"SELECT @@time_zone, @@system_time_zone, TIMESTAMPDIFF(SECOND, UTC_TIMESTAMP(), NOW())",
+	).Scan(&name, &systemName, &offset)
+	if err != nil {
+		return err
+	}
+	if name == "SYSTEM" {
+		name = systemName
+	}
+	conn.cfg.Loc = time.FixedZone(name, offset)
+	return nil
+}
+
 // Close closes the database connection.
 func (conn *Conn) Close() (err error) {
 	// Makes Close idempotent
@@ -204,6 +432,179 @@ func (conn *Conn) Close() (err error) {
 	return
 }
 
+// Ping verifies that the connection to the database is still alive.
+func (conn *Conn) Ping() error {
+	if err := conn.connect(); err != nil {
+		return err
+	}
+
+	if err := conn.writeCommandPacket(comPing); err != nil {
+		return err
+	}
+
+	return conn.readResultOK()
+}
+
+// ServerVersion returns the version string the server sent in the handshake,
+// e.g. "5.7.34-log".
+func (conn *Conn) ServerVersion() string {
+	return conn.serverVersion
+}
+
+// ThreadID returns the id the server assigned to the connection, which is
+// listed as Id in SHOW PROCESSLIST and can be used with KILL.
+func (conn *Conn) ThreadID() uint32 {
+	return conn.threadID
+}
+
+// CurrentDatabase returns the default database of the connection.
+// Changes, e.g. by USE statements, are only tracked if the server supports
+// session state tracking (MySQL 5.7+) and session_track_schema is enabled,
+// which is the default.
+func (conn *Conn) CurrentDatabase() string {
+	return conn.currentDB
+}
+
+// UseDatabase makes name the default database of the connection, like a USE
+// statement. It also verifies that the connection is still alive, within the
+// same round trip. A nonexistent database is reported as *Error 1049
+// (ER_BAD_DB_ERROR).
+func (conn *Conn) UseDatabase(name string) error {
+	if err := conn.connect(); err != nil {
+		return err
+	}
+
+	if err := conn.writeCommandPacketStr(comInitDB, name); err != nil {
+		return err
+	}
+	if err := conn.readResultOK(); err != nil {
+		return err
+	}
+	conn.currentDB = name
+	return nil
+}
+
+// InTransaction reports whether a transaction is open on the connection, as
+// reported by the server status of the last command. This includes
+// transactions started implicitly with autocommit=0.
+func (conn *Conn) InTransaction() bool {
+	return conn.status&statusInTrans != 0
+}
+
+// ConnStats contains the traffic counters of a connection. The bytes include
+// the packet headers. If the compressed protocol is used, the sizes before
+// compression are counted.
+type ConnStats struct {
+	BytesRead      uint64
+	BytesWritten   uint64
+	PacketsRead    uint64
+	PacketsWritten uint64
+}
+
+// Stats returns the traffic counters of the connection, which include the
+// traffic of the handshake.
+func (conn *Conn) Stats() ConnStats {
+	return conn.stats
+}
+
+// KillQuery aborts the statement the connection with the given thread id is
+// currently executing. The statement fails with error 1317 (ER_QUERY_INTERRUPTED)
+// then, while the connection stays usable.
+func (conn *Conn) KillQuery(threadID uint32) error {
+	return conn.kill("KILL QUERY ", threadID)
+}
+
+// KillConnection closes the connection with the given thread id on the server.
+func (conn *Conn) KillConnection(threadID uint32) error {
+	return conn.kill("KILL ", threadID)
+}
+
+func (conn *Conn) kill(cmd string, threadID uint32) error {
+	if err := conn.connect(); err != nil {
+		return err
+	}
+	return conn.exec(cmd + strconv.FormatUint(uint64(threadID), 10))
+}
+
+// Statistics returns the human readable status string of the server, which
+// contains e.g. the uptime, the number of threads and the queries per second.
+func (conn *Conn) Statistics() (string, error) {
+	if err := conn.connect(); err != nil {
+		return "", err
+	}
+
+	if err := conn.writeCommandPacket(comStatistics); err != nil {
+		return "", err
+	}
+
+	// The response is a plain string instead of an OK packet
+	data, err := conn.readPacket()
+	if err != nil {
+		return "", err
+	}
+	if data[0] == iERR {
+		return "", conn.handleErrorPacket(data)
+	}
+	return string(data), nil
+}
+
+// ResetSession resets the session state of the connection without
+// reconnecting, like a new connection. Temporary tables are dropped, user
+// variables are unset and prepared statements are closed.
+// It requires MySQL 5.7.3 or newer. Older servers return an *Error.
+func (conn *Conn) ResetSession() error {
+	if err := conn.connect(); err != nil {
+		return err
+	}
+
+	if err := conn.writeCommandPacket(comResetConnection); err != nil {
+		return err
+	}
+	if err := conn.readResultOK(); err != nil {
+		return err
+	}
+
+	// the server closed all prepared statements
+	if conn.stmtCache != nil {
+		conn.stmtCache.clear()
+	}
+	return nil
+}
+
+// ChangeUser authenticates as another user on the same network connection and
+// makes db the default database. Like a new login, this resets the session:
+// prepared statements are closed, temporary tables are dropped and session
+// variables are reset. The DSN params are applied again afterwards.
+func (conn *Conn) ChangeUser(user, passwd, db string) error {
+	if err := conn.connect(); err != nil {
+		return err
+	}
+
+	// Copy the config, it might be shared with other connections
+	oldCfg := conn.cfg
+	cfg := *oldCfg
+	cfg.User = user
+	cfg.Passwd = passwd
+	cfg.DBName = db
+	conn.cfg = &cfg
+
+	if err := conn.writeChangeUserPacket(conn.cipher); err != nil {
+		conn.cfg = oldCfg
+		return err
+	}
+	if err := conn.handleAuthResult(conn.cipher); err != nil {
+		conn.cfg = oldCfg
+		return err
+	}
+	conn.currentDB = db
+
+	// the server closed all prepared statements
+	if conn.stmtCache != nil {
+		conn.stmtCache.clear()
+	}
+	return conn.handleParams()
+}
+
 // cleanup closes the network connection and unsets internal variables.
 // Do not call this function after successfully authentication, call Close
 // instead. This function is called before auth or on auth failure because MySQL
@@ -216,10 +617,42 @@ func (conn *Conn) cleanup() {
 		}
 		conn.netConn = nil
 	}
+	if conn.stmtCache != nil {
+		conn.stmtCache.clear()
+	}
+	conn.splitBuf = nil
+	conn.lazy = false
 	conn.cfg = nil
 	conn.buf.nc = nil
 }
 
+// setDeadline limits the time for reading the result of the following command
+// to d. The returned function must be called once the command is finished.
+func (conn *Conn) setDeadline(d time.Duration) (clear func()) {
+	conn.buf.deadline = time.Now().Add(d)
+	return func() {
+		conn.buf.deadline = time.Time{}
+		if conn.netConn != nil && conn.buf.timeout <= 0 {
+			conn.netConn.SetReadDeadline(time.Time{})
+		}
+	}
+}
+
+// convertArg converts a query argument like the function convertArg and
+// applies the zeroDateTimeBehavior to zero time.Time values.
+func (conn *Conn) convertArg(arg interface{}) (interface{}, error) {
+	arg, err := convertArg(arg)
+	if v, ok := arg.(time.Time); ok && v.IsZero() {
+		switch conn.cfg.ZeroDateTimeBehavior {
+		case "null":
+			return nil, nil
+		case "error":
+			return nil, errZeroDateTime
+		}
+	}
+	return arg, err
+}
+
 func (conn *Conn) interpolateParams(query string, args []interface{}) (string, error) {
 	buf := conn.buf.takeCompleteBuffer()
 	if buf == nil {
@@ -238,93 +671,31 @@ func (conn *Conn) interpolateParams(query string, args []interface{}) (string, e
 		buf = append(buf, query[i:i+q]...)
 		i += q
 
-		arg := args[argPos]
-		argPos++
-
-		if arg == nil {
-			buf = append(buf, "NULL"...)
-			continue
+		arg, err := conn.convertArg(args[argPos])
+		if err != nil {
+			return "", err
 		}
+		argPos++
 
-		switch v := arg.(type) {
-		case int64:
-			buf = strconv.AppendInt(buf, v, 10)
-		case float64:
-			buf = strconv.AppendFloat(buf, v, 'g', -1, 64)
-		case bool:
-			if v {
-				buf = append(buf, '1')
-			} else {
-				buf = append(buf, '0')
+		if rv := reflect.ValueOf(arg); rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() != reflect.Uint8 {
+			// other slices than []byte are expanded into a list of values,
+			// e.g. for IN (?)
+			if rv.Len() == 0 {
+				buf = append(buf, "NULL"...)
 			}
-		case time.Time:
-			if v.IsZero() {
-				buf = append(buf, "'0000-00-00'"...)
-			} else {
-				v := v.In(conn.cfg.Loc)
-				v = v.Add(time.Nanosecond * 500) // To round under microsecond
-				year := v.Year()
-				year100 := year / 100
-				year1 := year % 100
-				month := v.Month()
-				day := v.Day()
-				hour := v.Hour()
-				minute := v.Minute()
-				second := v.Second()
-				micro := v.Nanosecond() / 1000
-
-				buf = append(buf, []byte{
-					'\'',
-					digits10[year100], digits01[year100],
-					digits10[year1], digits01[year1],
-					'-',
-					digits10[month], digits01[month],
-					'-',
-					digits10[day], digits01[day],
-					' ',
-					digits10[hour], digits01[hour],
-					':',
-					digits10[minute], digits01[minute],
-					':',
-					digits10[second], digits01[second],
-				}...)
-
-				if micro != 0 {
-					micro10000 := micro / 10000
-					micro100 := micro / 100 % 100
-					micro1 := micro % 100
-					buf = append(buf, []byte{
-						'.',
-						digits10[micro10000], digits01[micro10000],
-						digits10[micro100], digits01[micro100],
-						digits10[micro1], digits01[micro1],
-					}...)
+			for j := 0; j < rv.Len(); j++ {
+				if j > 0 {
+					buf = append(buf, ',')
 				}
-				buf = append(buf, '\'')
-			}
-		case []byte:
-			if v == nil {
-				buf = append(buf, "NULL"...)
-			} else {
-				buf = append(buf, "_binary'"...)
-				if conn.status&statusNoBackslashEscapes == 0 {
-					buf = escapeBytesBackslash(buf, v)
-				} else {
-					buf = escapeBytesQuotes(buf, v)
+				if arg, err = conn.convertArg(rv.Index(j).Interface()); err != nil {
+					return "", err
+				}
+				if buf, err = conn.appendInterpolatedArg(buf, arg); err != nil {
+					return "", err
 				}
-				buf = append(buf, '\'')
-			}
-		case string:
-			buf = append(buf, '\'')
-			if conn.status&statusNoBackslashEscapes == 0 {
-				buf = escapeStringBackslash(buf, v)
-			} else {
-				buf = escapeStringQuotes(buf, v)
 			}
-			buf = append(buf, '\'')
-		default:
-			//fmt.Printf("arg: %#v \n", arg) // DEBUG
-			return "", ErrUnsafeInterpolate
+		} else if buf, err = conn.appendInterpolatedArg(buf, arg); err != nil {
+			return "", err
 		}
 
 		if len(buf)+4 > conn.maxPacketAllowed {
@@ -337,31 +708,158 @@ func (conn *Conn) interpolateParams(query string, args []interface{}) (string, e
 	return string(buf), nil
 }
 
+// appendInterpolatedArg appends the converted arg as an escaped SQL literal
+func (conn *Conn) appendInterpolatedArg(buf []byte, arg interface{}) ([]byte, error) {
+	switch v := arg.(type) {
+	case nil:
+		buf = append(buf, "NULL"...)
+	case int64:
+		buf = strconv.AppendInt(buf, v, 10)
+	case uint64:
+		buf = strconv.AppendUint(buf, v, 10)
+	case float64:
+		buf = strconv.AppendFloat(buf, v, 'g', -1, 64)
+	case bool:
+		if v {
+			buf = append(buf, '1')
+		} else {
+			buf = append(buf, '0')
+		}
+	case time.Time:
+		if v.IsZero() {
+			buf = append(buf, "'0000-00-00'"...)
+		} else {
+			buf = append(buf, '\'')
+			buf = appendDateTime(buf, v.In(conn.cfg.Loc))
+			buf = append(buf, '\'')
+		}
+	case []byte:
+		if v == nil {
+			buf = append(buf, "NULL"...)
+		} else {
+			buf = append(buf, "_binary'"...)
+			if conn.status&statusNoBackslashEscapes == 0 {
+				buf = escapeBytesBackslash(buf, v)
+			} else {
+				buf = escapeBytesQuotes(buf, v)
+			}
+			buf = append(buf, '\'')
+		}
+	case string:
+		buf = append(buf, '\'')
+		if conn.status&statusNoBackslashEscapes == 0 {
+			buf = escapeStringBackslash(buf, v)
+		} else {
+			buf = escapeStringQuotes(buf, v)
+		}
+		buf = append(buf, '\'')
+	default:
+		//fmt.Printf("arg: %#v \n", arg) // DEBUG
+		return buf, ErrUnsafeInterpolate
+	}
+	return buf, nil
+}
+
 // Exec executes a query without returning any rows.
-// The args are for any placeholder parameters in the query.
+// The args are for any placeholder parameters in the query. They are
+// interpolated into the query if possible. Otherwise, e.g. if the values are
+// too large or if interpolateParams=false is set, a temporary prepared
+// statement is used instead. Slice args other than []byte are interpolated as a
+// comma-separated list of values, e.g. for IN (?), or as NULL if they are empty.
+// If the query can not be interpolated, they fail with an error, since
+// prepared statements do not support them.
+// In the strict mode, the Result is returned together with the Warnings error
+// if the query succeeded with warnings.
 func (conn *Conn) Exec(query string, args ...interface{}) (res Result, err error) {
-	if conn.netConn == nil {
-		err = ErrInvalidConn
+	if err = conn.connect(); err != nil {
 		return
 	}
 	if len(args) != 0 {
+		if conn.cfg.NoInterpolateParams {
+			return conn.execPrepared(query, args)
+		}
+
 		// try to interpolate the parameters to save extra roundtrips for preparing and closing a statement
-		query, err = conn.interpolateParams(query, args)
+		var iquery string
+		iquery, err = conn.interpolateParams(query, args)
+		if err == ErrUnsafeInterpolate || err == ErrPktTooLarge {
+			// Prepared statements can handle these args, e.g. by sending
+			// large values separately
+			return conn.execPrepared(query, args)
+		}
 		if err != nil {
 			return
 		}
+		query = iquery
 		args = nil
 	}
 	conn.affectedRows = 0
 	conn.insertID = 0
+	conn.warnings = 0
+	conn.info = ""
 
-	if err = conn.exec(query); err == nil {
+	done := conn.runHooks(query)
+	err = conn.exec(query)
+	done(err)
+	if _, ok := err.(Warnings); err == nil || ok {
 		res.affectedRows = int64(conn.affectedRows)
 		res.insertID = int64(conn.insertID)
+		res.warnings = int(conn.warnings)
+		res.info = conn.info
 	}
 	return
 }
 
+// ExecStrict executes a query like Exec, but in the strict mode, regardless of
+// the strict DSN param. If the query generates warnings, they are returned as
+// error of the type Warnings.
+func (conn *Conn) ExecStrict(query string, args ...interface{}) (Result, error) {
+	strict := conn.strict
+	conn.strict = true
+	defer func() { conn.strict = strict }()
+	return conn.Exec(query, args...)
+}
+
+// execPrepared executes the query with a temporary prepared statement
+func (conn *Conn) execPrepared(query string, args []interface{}) (Result, error) {
+	stmt, err := conn.Prepare(query)
+	if err != nil {
+		return Result{}, err
+	}
+	res, err := stmt.Exec(args...)
+	if cerr := stmt.Close(); err == nil {
+		err = cerr
+	}
+	if res == nil {
+		return Result{}, err
+	}
+	return *res, err
+}
+
+// queryPrepared executes the query with a temporary prepared statement, which
+// is closed together with the returned rows
+func (conn *Conn) queryPrepared(query string, args []interface{}) (Rows, error) {
+	stmt, err := conn.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := stmt.Query(args...)
+	if err != nil {
+		stmt.Close()
+		return nil, err
+	}
+	br, ok := rows.(*binaryRows)
+	if !ok {
+		// no rows, the statement is not needed anymore
+		if err = stmt.Close(); err != nil {
+			return nil, err
+		}
+		return rows, nil
+	}
+	br.stmt = stmt
+	return br, nil
+}
+
 // Internal function to execute commands
 func (conn *Conn) exec(query string) error {
 	// Send command
@@ -379,17 +877,73 @@ func (conn *Conn) exec(query string) error {
 
 		err = conn.readUntilEOF()
 	}
+	if err != nil {
+		return err
+	}
 
-	return err
+	// Read results of further statements, if any
+	return conn.discardResults()
 }
 
 // Query executes a query that returns rows, typically a SELECT.
-// The args are for any placeholder parameters in the query.
-func (conn *Conn) Query(query string, args ...interface{}) (rows Rows, err error) {
-	if conn.netConn == nil {
-		return nil, ErrInvalidConn
+// The args are for any placeholder parameters in the query. They are
+// interpolated into the query, unless interpolateParams=false is set. A
+// temporary prepared statement is used then, which is closed once the rows are
+// read completely or closed.
+// Slice args other than []byte are interpolated as a comma-separated list of
+// values, e.g. for IN (?), or as NULL if they are empty. They fail with an
+// error with interpolateParams=false, since prepared statements do not support
+// them.
+// With autoReconnect=true, a read-only query like a SELECT is retried once on a
+// new connection if the server closed the connection before answering it, but
+// not within a transaction. Other statements are only retried with
+// autoReconnectWrites=true.
+func (conn *Conn) Query(query string, args ...interface{}) (Rows, error) {
+	cfg := conn.cfg
+	inTrans := conn.status&statusInTrans != 0
+	rows, err := conn.query(query, args)
+	if isBadConn(err) && conn.idleBroken && !inTrans && cfg != nil && cfg.AutoReconnect &&
+		(cfg.AutoReconnectWrites || isReadQuery(query)) {
+		if err = conn.reconnect(cfg); err != nil {
+			return nil, err
+		}
+		return conn.query(query, args)
+	}
+	return rows, err
+}
+
+// reconnect replaces the broken connection with a new one using cfg.
+// The traffic counters are kept. Statements prepared on the broken connection
+// are invalidated.
+func (conn *Conn) reconnect(cfg *Config) error {
+	conn.cleanup()
+	nc, err := OpenConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	stats := conn.stats
+	nc.generation = conn.generation + 1
+	*conn = *nc
+	if conn.compIO != nil {
+		conn.compIO.conn = conn
+	}
+	conn.stats.BytesRead += stats.BytesRead
+	conn.stats.BytesWritten += stats.BytesWritten
+	conn.stats.PacketsRead += stats.PacketsRead
+	conn.stats.PacketsWritten += stats.PacketsWritten
+	return nil
+}
+
+func (conn *Conn) query(query string, args []interface{}) (rows Rows, err error) {
+	if err = conn.connect(); err != nil {
+		return
 	}
 	if len(args) != 0 {
+		if conn.cfg.NoInterpolateParams {
+			return conn.queryPrepared(query, args)
+		}
+
 		// try client-side prepare to reduce roundtrip
 		query, err = conn.interpolateParams(query, args)
 		if err != nil {
@@ -397,6 +951,9 @@ func (conn *Conn) Query(query string, args ...interface{}) (rows Rows, err error
 		}
 		args = nil
 	}
+	done := conn.runHooks(query)
+	defer func() { done(err) }()
+
 	// Send command
 	if err = conn.writeCommandPacketStr(comQuery, query); err == nil {
 		// Read Result
@@ -407,8 +964,13 @@ func (conn *Conn) Query(query string, args ...interface{}) (rows Rows, err error
 			tr.conn = conn
 
 			if resLen == 0 {
-				// no columns, no more data
-				return emptyRows{}, nil
+				if conn.status&statusMoreResultsExists == 0 {
+					// no columns, no more data
+					return emptyRows{}, nil
+				}
+				// no columns, but further result sets follow
+				tr.done = true
+				return tr, nil
 			}
 			// Columns
 			tr.columns, err = conn.readColumns(resLen)
@@ -418,8 +980,88 @@ func (conn *Conn) Query(query string, args ...interface{}) (rows Rows, err error
 	return
 }
 
+// QueryWithMaxExecTime executes a SELECT query like Query, but adds a
+// MAX_EXECUTION_TIME optimizer hint, so the server aborts the query with error
+// 3024 (ER_QUERY_TIMEOUT) if it runs longer than ms milliseconds. Unlike a
+// timeout of the network connection, the connection stays usable.
+// The hint requires MySQL 5.7.8+ and is ignored by other servers.
+func (conn *Conn) QueryWithMaxExecTime(ms int, query string, args ...interface{}) (Rows, error) {
+	query, ok := addMaxExecTimeHint(query, ms)
+	if !ok {
+		return nil, errMaxExecTimeNoSelect
+	}
+	return conn.Query(query, args...)
+}
+
+// QueryPrepared executes a query like Query, but always uses a temporary
+// prepared statement, regardless of the interpolateParams DSN param and of the
+// args. The rows are sent in the binary protocol then. The statement is closed
+// once the rows are read completely or closed.
+func (conn *Conn) QueryPrepared(query string, args ...interface{}) (Rows, error) {
+	if err := conn.connect(); err != nil {
+		return nil, err
+	}
+	return conn.queryPrepared(query, args)
+}
+
+// DescribeQuery returns the column information of the rows the query would
+// return, without executing it. The query is prepared and the statement is
+// closed again right away, so any placeholders in it must not be bound. It
+// returns nil if the query returns no rows, e.g. for an INSERT.
+func (conn *Conn) DescribeQuery(query string) ([]*ColumnType, error) {
+	stmt, err := conn.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	types := stmt.ColumnTypes()
+	return types, stmt.Close()
+}
+
+// QueryRow executes a query that is expected to return at most one row.
+// QueryRow always returns a non-nil value. Errors are deferred until
+// Row's Scan method is called.
+func (conn *Conn) QueryRow(query string, args ...interface{}) *Row {
+	rows, err := conn.Query(query, args...)
+	return &Row{rows: rows, err: err}
+}
+
+// QueryRowMap executes a query that is expected to return at most one row and
+// returns its columns as a map from the column names to the values, see
+// Rows.ScanMap. If no row matches the query, ErrNoRows is returned.
+func (conn *Conn) QueryRowMap(query string, args ...interface{}) (map[string]interface{}, error) {
+	return conn.QueryRow(query, args...).ScanMap()
+}
+
+// SetSessionVar sets the session value of the system variable name, e.g.
+// group_concat_max_len. Decimal numbers are sent as numbers, other values as
+// escaped strings.
+func (conn *Conn) SetSessionVar(name, value string) error {
+	if !isVarName(name) {
+		return errInvalidVarName
+	}
+	var err error
+	if isDecimal(value) {
+		_, err = conn.Exec("SET SESSION " + name + "=" + value)
+	} else {
+		_, err = conn.Exec("SET SESSION "+name+"=?", value)
+	}
+	return err
+}
+
+// GetSessionVar returns the session value of the system variable name. NULL is
+// returned as empty string.
+func (conn *Conn) GetSessionVar(name string) (string, error) {
+	if !isVarName(name) {
+		return "", errInvalidVarName
+	}
+	var value []byte
+	if err := conn.QueryRow("SELECT @@SESSION." + name).Scan(&value); err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
+
 // Gets the value of the given MySQL System Variable
-// The returned byte slice is only valid until the next read
 func (conn *Conn) getSystemVar(name string) ([]byte, error) {
 	// Send command
 	if err := conn.writeCommandPacketStr(comQuery, "SELECT @@"+name); err != nil {
@@ -440,10 +1082,10 @@ func (conn *Conn) getSystemVar(name string) ([]byte, error) {
 			}
 		}
 
-		dest := []interface{}{[]byte{}}
+		var val []byte
 		if err = tr.readRow(); err == nil {
-			if err = tr.convert(dest); err == nil {
-				return dest[0].([]byte), conn.readUntilEOF()
+			if err = tr.convert([]interface{}{&val}); err == nil {
+				return val, conn.readUntilEOF()
 			}
 		}
 	}
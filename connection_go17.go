@@ -0,0 +1,212 @@
+// gmysql - A MySQL package for Go
+//
+// Copyright 2016 The gmysql Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// +build go1.7
+
+package gmysql
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// aLongTimeAgo is a non-zero time, far in the past, used for immediate
+// cancellation of network operations.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// DialContextFunc is a function which can be used to establish the network
+// connection. Custom dial functions must be registered with
+// RegisterDialContext.
+type DialContextFunc func(ctx context.Context, addr string) (net.Conn, error)
+
+var dialsContext map[string]DialContextFunc
+
+// RegisterDialContext registers a custom dial function which honors the
+// cancellation and deadline of the context. It can then be used by the network
+// address mynet(addr), where mynet is the registered new network. OpenContext
+// prefers it over a dial function registered with RegisterDial for the same
+// network, Open calls it with context.Background().
+func RegisterDialContext(network string, dial DialContextFunc) {
+	if dialsContext == nil {
+		dialsContext = make(map[string]DialContextFunc)
+	}
+	dialsContext[network] = dial
+
+	RegisterDial(network, func(addr string) (net.Conn, error) {
+		return dial(context.Background(), addr)
+	})
+}
+
+// OpenContext opens a new connection like Open. If ctx is cancelled before the
+// connection is established, the attempt is aborted and ctx.Err() is
+// returned.
+func OpenContext(ctx context.Context, dsn string) (*Conn, error) {
+	cfg, err := ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return OpenConfigContext(ctx, cfg)
+}
+
+// OpenConfigContext opens a new connection using the given Config like
+// OpenConfig. If ctx is cancelled before the connection is established, the
+// attempt is aborted and ctx.Err() is returned.
+func OpenConfigContext(ctx context.Context, cfg *Config) (*Conn, error) {
+	conn, err := newConn(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Connect to Server
+	dialCtx := ctx
+	if conn.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		dialCtx, cancel = context.WithTimeout(ctx, conn.cfg.Timeout)
+		defer cancel()
+	}
+	if dial, ok := dialsContext[conn.cfg.Net]; ok {
+		conn.netConn, err = dial(dialCtx, conn.cfg.Addr)
+	} else if dial, ok := dials[conn.cfg.Net]; ok {
+		conn.netConn, err = dial(conn.cfg.Addr)
+	} else {
+		var nd net.Dialer
+		conn.netConn, err = nd.DialContext(dialCtx, conn.cfg.Net, conn.cfg.Addr)
+	}
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+
+	finish, err := conn.watchCancel(ctx)
+	if err != nil {
+		conn.netConn.Close()
+		return nil, err
+	}
+	err = conn.handshake()
+	if finish() && err != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// watchCancel starts a goroutine which interrupts any pending network I/O on
+// the connection as soon as ctx is done. The returned function must be called
+// once the command is finished. It reports whether the command was
+// interrupted.
+func (conn *Conn) watchCancel(ctx context.Context) (finish func() bool, err error) {
+	if ctx.Done() == nil {
+		// context can never be cancelled
+		return func() bool { return false }, nil
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	nc := conn.netConn
+	done := make(chan struct{})
+	interrupted := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// unblock pending reads and writes
+			nc.SetDeadline(aLongTimeAgo)
+			interrupted <- true
+		case <-done:
+			interrupted <- false
+		}
+	}()
+
+	return func() bool {
+		close(done)
+		if <-interrupted {
+			// The command might have finished anyway. Clear the deadline,
+			// so that the connection stays usable in that case.
+			nc.SetDeadline(time.Time{})
+			return true
+		}
+		return false
+	}, nil
+}
+
+// killQuery aborts the statement the connection with the given thread id is
+// executing, using a new connection opened with cfg. The server would keep
+// executing it after a cancelled command closed the connection otherwise.
+// It runs in the background, errors are only logged.
+func killQuery(cfg *Config, threadID uint32) {
+	go func() {
+		kc, err := OpenConfig(cfg)
+		if err != nil {
+			errLog.Print("killing the query of a cancelled command: ", err)
+			return
+		}
+		defer kc.Close()
+		err = kc.KillQuery(threadID)
+		if me, ok := err.(*Error); ok && me.Number == 1094 {
+			// ER_NO_SUCH_THREAD: the connection ended in the meantime
+			return
+		}
+		if err != nil {
+			errLog.Print("killing the query of a cancelled command: ", err)
+		}
+	}()
+}
+
+// ExecContext executes a query without returning any rows, like Exec.
+// If ctx is cancelled before the result was received, the command is aborted
+// and ctx.Err() is returned. The connection is closed in that case, since its
+// state is unknown, and the statement is aborted on the server with KILL QUERY
+// sent over a new connection.
+func (conn *Conn) ExecContext(ctx context.Context, query string, args ...interface{}) (Result, error) {
+	if err := conn.connect(); err != nil {
+		return Result{}, err
+	}
+	finish, err := conn.watchCancel(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+
+	cfg, threadID := conn.cfg, conn.threadID
+	res, err := conn.Exec(query, args...)
+	if finish() && err != nil {
+		killQuery(cfg, threadID)
+		return Result{}, ctx.Err()
+	}
+	return res, err
+}
+
+// QueryContext executes a query that returns rows, like Query.
+// If ctx is cancelled before the result set header and the columns were
+// received, the command is aborted and ctx.Err() is returned. The connection
+// is closed in that case, since its state is unknown, and the statement is
+// aborted on the server with KILL QUERY sent over a new connection.
+// Reading the rows afterwards is not affected by ctx.
+func (conn *Conn) QueryContext(ctx context.Context, query string, args ...interface{}) (Rows, error) {
+	if err := conn.connect(); err != nil {
+		return nil, err
+	}
+	finish, err := conn.watchCancel(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, threadID := conn.cfg, conn.threadID
+	rows, err := conn.Query(query, args...)
+	if finish() && err != nil {
+		killQuery(cfg, threadID)
+		return nil, ctx.Err()
+	}
+	return rows, err
+}
@@ -0,0 +1,150 @@
+// gmysql - A MySQL package for Go
+//
+// Copyright 2016 The gmysql Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// +build go1.7
+
+package gmysql
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestContextCancelQuery(t *testing.T) {
+	// the server reads all commands, but never replies
+	conn, _, _ := newResponderConn(nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := conn.QueryContext(ctx, "SELECT SLEEP(10)"); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("QueryContext did not return promptly: %v", d)
+	}
+	if conn.netConn != nil {
+		t.Error("expected connection to be closed")
+	}
+}
+
+func TestContextCancelExec(t *testing.T) {
+	conn, _, _ := newResponderConn(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+
+	if _, err := conn.ExecContext(ctx, "DO SLEEP(10)"); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if _, err := conn.ExecContext(context.Background(), "DO 1"); err != ErrInvalidConn {
+		t.Errorf("expected ErrInvalidConn, got %v", err)
+	}
+}
+
+func TestContextCancelKillsQuery(t *testing.T) {
+	dialed := make(chan string, 1)
+	RegisterDial("killdial", func(addr string) (net.Conn, error) {
+		dialed <- addr
+		return nil, errors.New("dial failed")
+	})
+	conn, _, _ := newResponderConn(&Config{Net: "killdial", Addr: "killhost"})
+	conn.threadID = 42
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := conn.ExecContext(ctx, "DO SLEEP(10)"); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	// a new connection is opened to send KILL QUERY
+	select {
+	case addr := <-dialed:
+		if addr != "killhost" {
+			t.Errorf("unexpected address %q", addr)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("expected a connection to kill the query")
+	}
+}
+
+func TestContextAlreadyCancelled(t *testing.T) {
+	conn, _, _ := newResponderConn(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := conn.QueryContext(ctx, "SELECT 1"); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if conn.netConn == nil {
+		t.Error("connection must not be closed if no command was sent")
+	}
+}
+
+func TestOpenContextCancelDial(t *testing.T) {
+	RegisterDialContext("blockdial", func(ctx context.Context, addr string) (net.Conn, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	if _, err := OpenContext(ctx, "user@blockdial(foo)/dbname"); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("OpenContext did not return promptly: %v", d)
+	}
+}
+
+func TestOpenContextCancelHandshake(t *testing.T) {
+	RegisterDialContext("silentdial", func(ctx context.Context, addr string) (net.Conn, error) {
+		// a server which never sends the handshake packet
+		client, server := net.Pipe()
+		go io.Copy(ioutil.Discard, server)
+		return client, nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := OpenContext(ctx, "user@silentdial(foo)/dbname"); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestOpenUsesDialContext(t *testing.T) {
+	dialErr := errors.New("dial failed")
+	var dialCtx context.Context
+	RegisterDialContext("ctxdial", func(ctx context.Context, addr string) (net.Conn, error) {
+		dialCtx = ctx
+		return nil, dialErr
+	})
+
+	if _, err := Open("user@ctxdial(foo)/dbname"); err != dialErr {
+		t.Errorf("expected dial error, got %v", err)
+	}
+	if dialCtx != context.Background() {
+		t.Errorf("expected context.Background(), got %v", dialCtx)
+	}
+}
@@ -0,0 +1,534 @@
+// gmysql - A MySQL package for Go
+//
+// Copyright 2016 The gmysql Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package gmysql
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// newTestConn returns a connection over nc, which is not connected to a real
+// server, e.g. a loopbackConn or one end of a net.Pipe. nc may be nil for
+// tests which do not send anything. A nil cfg is replaced by an empty Config.
+func newTestConn(nc net.Conn, cfg *Config) *Conn {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	if cfg.Loc == nil {
+		cfg.Loc = time.UTC
+	}
+	return &Conn{
+		netConn:          nc,
+		buf:              newBuffer(nc),
+		cfg:              cfg,
+		maxPacketAllowed: maxPacketSize,
+		maxWriteSize:     maxPacketSize - 1,
+	}
+}
+
+// newResponderConn returns a connection to a server which answers each packet
+// it reads with the next of the responses. A nil response reads a packet
+// without answering it. The payloads of the packets are sent to the returned
+// channel. All packets after the last response are discarded.
+func newResponderConn(cfg *Config, responses ...[]byte) (*Conn, net.Conn, <-chan []byte) {
+	nc, server := net.Pipe()
+	received := make(chan []byte, len(responses))
+	go func() {
+		header := make([]byte, 4)
+		for _, response := range responses {
+			if _, err := io.ReadFull(server, header); err != nil {
+				return
+			}
+			pkt := make([]byte, int(header[0])|int(header[1])<<8|int(header[2])<<16)
+			if _, err := io.ReadFull(server, pkt); err != nil {
+				return
+			}
+			received <- pkt
+			if response != nil {
+				server.Write(response)
+			}
+		}
+		io.Copy(ioutil.Discard, server)
+	}()
+
+	return newTestConn(nc, cfg), server, received
+}
+
+// the OK packet answering a command
+var testOkPacket = []byte{0x07, 0x00, 0x00, 0x01, iOK, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00}
+
+type testID int32
+type testName string
+
+func TestInterpolateParamsNumeric(t *testing.T) {
+	conn := newTestConn(nil, nil)
+
+	args := []interface{}{
+		int(-1),
+		int8(-8),
+		int16(-16),
+		int32(-32),
+		uint(1),
+		uint8(8),
+		uint16(16),
+		uint32(math.MaxUint32),
+		uint64(math.MaxUint64),
+		float32(0.5),
+		testID(42),
+		testName("foo"),
+	}
+	q, err := conn.interpolateParams("SELECT ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?", args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "SELECT -1, -8, -16, -32, 1, 8, 16, 4294967295, 18446744073709551615, 0.5, 42, 'foo'"
+	if q != expected {
+		t.Errorf("expected %q, got %q", expected, q)
+	}
+}
+
+func TestInterpolateParamsBigInt(t *testing.T) {
+	conn := newTestConn(nil, nil)
+
+	huge, _ := new(big.Int).SetString("1180591620717411303424", 10) // 2^70
+	args := []interface{}{
+		big.NewInt(math.MinInt64),
+		big.NewInt(42),
+		new(big.Int).SetUint64(math.MaxUint64),
+		huge,
+		new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(3), 63)), // -(2^64 + 2^63)
+		(*big.Int)(nil),
+		uint(math.MaxUint32),
+	}
+	q, err := conn.interpolateParams("SELECT ?, ?, ?, ?, ?, ?, ?", args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "SELECT -9223372036854775808, 42, 18446744073709551615, '1180591620717411303424', '-27670116110564327424', NULL, 4294967295"
+	if q != expected {
+		t.Errorf("expected %q, got %q", expected, q)
+	}
+}
+
+func TestInterpolateParamsStringer(t *testing.T) {
+	conn := newTestConn(nil, nil)
+
+	args := []interface{}{
+		json.RawMessage(`{"name": "O'Reilly"}`),
+		net.IPv4(127, 0, 0, 1),
+	}
+	q, err := conn.interpolateParams("INSERT INTO test VALUES (?, ?)", args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `INSERT INTO test VALUES ('{\"name\": \"O\'Reilly\"}', '127.0.0.1')`
+	if q != expected {
+		t.Errorf("expected %q, got %q", expected, q)
+	}
+}
+
+type testStatus int
+
+func (s testStatus) String() string {
+	return "active"
+}
+
+func TestInterpolateParamsNumericStringer(t *testing.T) {
+	conn := newTestConn(nil, nil)
+
+	// numeric types are not sent as their String
+	args := []interface{}{
+		testStatus(1),
+		3 * time.Second,
+	}
+	q, err := conn.interpolateParams("SELECT ?, ?", args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "SELECT 1, 3000000000"
+	if q != expected {
+		t.Errorf("expected %q, got %q", expected, q)
+	}
+}
+
+func TestInterpolateParamsSlice(t *testing.T) {
+	conn := newTestConn(nil, nil)
+
+	args := []interface{}{
+		[]int{1, 2, 3},
+		[]string{"a", "it's"},
+		[]interface{}{testID(42), nil, []byte("b")},
+		[]int64{},
+		[]byte("c"),
+	}
+	q, err := conn.interpolateParams("SELECT * FROM test WHERE id IN (?) AND name IN (?) AND x IN (?) AND y IN (?) AND z = ?", args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `SELECT * FROM test WHERE id IN (1,2,3) AND name IN ('a','it\'s') AND x IN (42,NULL,_binary'b') AND y IN (NULL) AND z = _binary'c'`
+	if q != expected {
+		t.Errorf("expected %q, got %q", expected, q)
+	}
+
+	// nested slices are not expanded
+	if _, err = conn.interpolateParams("SELECT ?", []interface{}{[][]int{{1}}}); err != ErrUnsafeInterpolate {
+		t.Errorf("expected %v, got %v", ErrUnsafeInterpolate, err)
+	}
+}
+
+func TestWriteExecutePacketSlice(t *testing.T) {
+	conn := newTestConn(new(loopbackConn), nil)
+	stmt := &Stmt{conn: conn, paramCount: 1}
+
+	if err := stmt.writeExecutePacket([]interface{}{[]int{1, 2}}); err != errSliceArg {
+		t.Errorf("expected %v, got %v", errSliceArg, err)
+	}
+	// []byte is a single value
+	if err := stmt.writeExecutePacket([]interface{}{[]byte("a")}); err != nil {
+		t.Error(err)
+	}
+}
+
+type testMoney int64
+
+func (m testMoney) Value() (driver.Value, error) {
+	return int64(m), nil
+}
+
+type testBlob string
+
+func (b testBlob) Value() (driver.Value, error) {
+	return []byte(b), nil
+}
+
+type testBadValuer struct{}
+
+func (testBadValuer) Value() (driver.Value, error) {
+	return testBadValuer{}, nil
+}
+
+type testErrValuer struct{ err error }
+
+func (v testErrValuer) Value() (driver.Value, error) {
+	return nil, v.err
+}
+
+func TestInterpolateParamsValuer(t *testing.T) {
+	conn := newTestConn(nil, nil)
+
+	args := []interface{}{
+		testMoney(1999),
+		testBlob("it's"),
+		sql.NullString{},
+		sql.NullInt64{Int64: 42, Valid: true},
+	}
+	q, err := conn.interpolateParams("SELECT ?, ?, ?, ?", args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `SELECT 1999, _binary'it\'s', NULL, 42`
+	if q != expected {
+		t.Errorf("expected %q, got %q", expected, q)
+	}
+
+	if _, err = conn.interpolateParams("SELECT ?", []interface{}{testBadValuer{}}); err == nil {
+		t.Error("expected error for invalid driver.Value, got nil")
+	}
+
+	// errors of Value are passed through
+	valuerErr := errors.New("valuer error")
+	if _, err = conn.interpolateParams("SELECT ?", []interface{}{testErrValuer{valuerErr}}); err != valuerErr {
+		t.Errorf("expected %v, got %v", valuerErr, err)
+	}
+}
+
+func TestInterpolateParamsNullTypes(t *testing.T) {
+	conn := newTestConn(nil, nil)
+
+	args := []interface{}{
+		sql.NullString{},
+		sql.NullString{String: "it's", Valid: true},
+		sql.NullInt64{},
+		sql.NullInt64{Int64: -1, Valid: true},
+		sql.NullFloat64{},
+		sql.NullFloat64{Float64: 0.5, Valid: true},
+		sql.NullBool{},
+		sql.NullBool{Bool: true, Valid: true},
+	}
+	q, err := conn.interpolateParams("INSERT INTO test VALUES (?, ?, ?, ?, ?, ?, ?, ?)", args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `INSERT INTO test VALUES (NULL, 'it\'s', NULL, -1, NULL, 0.5, NULL, 1)`
+	if q != expected {
+		t.Errorf("expected %q, got %q", expected, q)
+	}
+}
+
+func TestInterpolateParamsZeroTime(t *testing.T) {
+	conn := newTestConn(nil, nil)
+	args := []interface{}{time.Time{}}
+
+	var zeroTests = []struct {
+		behavior string
+		expected string
+	}{
+		{"", "SELECT '0000-00-00'"},
+		{"null", "SELECT NULL"},
+	}
+	for _, tst := range zeroTests {
+		conn.cfg.ZeroDateTimeBehavior = tst.behavior
+		q, err := conn.interpolateParams("SELECT ?", args)
+		if err != nil {
+			t.Errorf("%q: expected err=nil, got %v", tst.behavior, err)
+			continue
+		}
+		if q != tst.expected {
+			t.Errorf("%q: expected %q, got %q", tst.behavior, tst.expected, q)
+		}
+	}
+
+	conn.cfg.ZeroDateTimeBehavior = "error"
+	if _, err := conn.interpolateParams("SELECT ?", args); err != errZeroDateTime {
+		t.Errorf("expected %v, got %v", errZeroDateTime, err)
+	}
+	// other times are not affected
+	if _, err := conn.interpolateParams("SELECT ?", []interface{}{time.Unix(0, 0)}); err != nil {
+		t.Errorf("expected err=nil, got %v", err)
+	}
+}
+
+func TestHandleParamsUnknownCollation(t *testing.T) {
+	conn, server, received := newResponderConn(&Config{UnknownCollation: "utf8mb4_0900_ai_ci"}, testOkPacket)
+	defer server.Close()
+
+	if err := conn.handleParams(); err != nil {
+		t.Fatal(err)
+	}
+	expected := "SET NAMES utf8mb4 COLLATE utf8mb4_0900_ai_ci"
+	if q := string((<-received)[1:]); q != expected {
+		t.Errorf("expected %q, got %q", expected, q)
+	}
+}
+
+// newClosingConn returns a connection to a server which closes the connection
+// after it read a command, like a server closing an idle connection
+func newClosingConn(cfg *Config) *Conn {
+	conn, server, received := newResponderConn(cfg, nil)
+	go func() {
+		<-received
+		server.Close()
+	}()
+	return conn
+}
+
+func TestQueryAutoReconnect(t *testing.T) {
+	dialErr := errors.New("dial failed")
+	RegisterDial("faildial", func(addr string) (net.Conn, error) {
+		return nil, dialErr
+	})
+
+	// without autoReconnect the error is returned
+	conn := newClosingConn(&Config{Net: "faildial", Addr: "localhost"})
+	if _, err := conn.Query("SELECT 1"); err != ErrBadConn {
+		t.Errorf("expected ErrBadConn, got %v", err)
+	}
+	if !conn.idleBroken {
+		t.Error("expected idleBroken to be set")
+	}
+
+	// the reconnect is attempted
+	conn = newClosingConn(&Config{Net: "faildial", Addr: "localhost", AutoReconnect: true})
+	if _, err := conn.Query("SELECT 1"); err != dialErr {
+		t.Errorf("expected %v, got %v", dialErr, err)
+	}
+
+	// Exec is not retried
+	conn = newClosingConn(&Config{Net: "faildial", Addr: "localhost", AutoReconnect: true})
+	if _, err := conn.Exec("DO 1"); err != ErrBadConn {
+		t.Errorf("expected ErrBadConn, got %v", err)
+	}
+
+	// the connection is not reconnected by the next query
+	if _, err := conn.Query("SELECT 1"); err != ErrInvalidConn {
+		t.Errorf("expected ErrInvalidConn, got %v", err)
+	}
+
+	// writes are only retried with autoReconnectWrites
+	conn = newClosingConn(&Config{Net: "faildial", Addr: "localhost", AutoReconnect: true})
+	if _, err := conn.Query("DELETE FROM test"); err != ErrBadConn {
+		t.Errorf("expected ErrBadConn, got %v", err)
+	}
+	conn = newClosingConn(&Config{Net: "faildial", Addr: "localhost", AutoReconnect: true, AutoReconnectWrites: true})
+	if _, err := conn.Query("DELETE FROM test"); err != dialErr {
+		t.Errorf("expected %v, got %v", dialErr, err)
+	}
+
+	// nothing is retried within a transaction
+	conn = newClosingConn(&Config{Net: "faildial", Addr: "localhost", AutoReconnect: true})
+	conn.status |= statusInTrans
+	if _, err := conn.Query("SELECT 1"); err != ErrBadConn {
+		t.Errorf("expected ErrBadConn, got %v", err)
+	}
+
+	// timeouts are no idle breaks
+	conn, server, _ := newResponderConn(&Config{Net: "faildial", Addr: "localhost", AutoReconnect: true})
+	defer server.Close()
+	conn.buf.timeout = 50 * time.Millisecond
+	if _, err := conn.Query("SELECT SLEEP(10)"); err != ErrBadConn {
+		t.Errorf("expected ErrBadConn, got %v", err)
+	}
+	if conn.idleBroken {
+		t.Error("expected idleBroken not to be set after a timeout")
+	}
+}
+
+func TestIsReadQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		read  bool
+	}{
+		{"SELECT 1", true},
+		{"  select * FROM test", true},
+		{"(SELECT 1) UNION (SELECT 2)", true},
+		{"SHOW TABLES", true},
+		{"DESC test", true},
+		{"EXPLAIN SELECT 1", true},
+		{"SELECTED", false},
+		{"DELETE FROM test", false},
+		{"INSERT INTO test SELECT 1", false},
+		{"CALL p()", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		if read := isReadQuery(test.query); read != test.read {
+			t.Errorf("%q: expected %v, got %v", test.query, test.read, read)
+		}
+	}
+}
+
+func TestTxOfOldGeneration(t *testing.T) {
+	conn, server, _ := newResponderConn(nil)
+	defer server.Close()
+
+	tx := &Tx{conn: conn}
+	conn.generation++ // reconnected
+	if _, err := tx.Exec("DO 1"); err != ErrInvalidConn {
+		t.Errorf("Exec: expected ErrInvalidConn, got %v", err)
+	}
+	if _, err := tx.Query("SELECT 1"); err != ErrInvalidConn {
+		t.Errorf("Query: expected ErrInvalidConn, got %v", err)
+	}
+	if err := tx.Commit(); err != ErrInvalidConn {
+		t.Errorf("Commit: expected ErrInvalidConn, got %v", err)
+	}
+	if err := tx.Rollback(); err != ErrTxDone {
+		t.Errorf("Rollback: expected ErrTxDone, got %v", err)
+	}
+}
+
+func TestStmtOfOldGeneration(t *testing.T) {
+	conn, server, _ := newResponderConn(nil)
+	defer server.Close()
+
+	stmt := &Stmt{conn: conn, query: "DO ?"}
+	conn.generation++ // reconnected
+	if _, err := stmt.Exec(1); err != ErrInvalidConn {
+		t.Errorf("Exec: expected ErrInvalidConn, got %v", err)
+	}
+	if _, err := stmt.Query(1); err != ErrInvalidConn {
+		t.Errorf("Query: expected ErrInvalidConn, got %v", err)
+	}
+	if _, err := stmt.ExecBatch([][]interface{}{{1}}); err != ErrInvalidConn {
+		t.Errorf("ExecBatch: expected ErrInvalidConn, got %v", err)
+	}
+	// the statement id might be reused on the new connection, it must not
+	// be closed there
+	if err := stmt.Close(); err != ErrInvalidConn {
+		t.Errorf("Close: expected ErrInvalidConn, got %v", err)
+	}
+	if stmt.conn != nil {
+		t.Error("expected the statement to be detached from the connection")
+	}
+}
+
+func TestNewLazyConn(t *testing.T) {
+	dialErr := errors.New("dial failed")
+	dialed := 0
+	RegisterDial("lazydial", func(addr string) (net.Conn, error) {
+		dialed++
+		return nil, dialErr
+	})
+
+	conn, err := NewLazyConn(&Config{Net: "lazydial", Addr: "localhost"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dialed != 0 {
+		t.Fatal("expected no dial before the first command")
+	}
+
+	// the first command connects and returns the error
+	if err = conn.Ping(); err != dialErr {
+		t.Errorf("expected %v, got %v", dialErr, err)
+	}
+	if _, err = conn.Query("SELECT 1"); err != ErrInvalidConn {
+		t.Errorf("expected ErrInvalidConn, got %v", err)
+	}
+	if dialed != 1 {
+		t.Errorf("expected 1 dial, got %d", dialed)
+	}
+
+	// closed before the first command
+	if conn, err = NewLazyConn(&Config{Net: "lazydial", Addr: "localhost"}); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if _, err = conn.Exec("DO 1"); err != ErrInvalidConn {
+		t.Errorf("expected ErrInvalidConn, got %v", err)
+	}
+	if dialed != 1 {
+		t.Errorf("expected no dial after Close, got %d", dialed-1)
+	}
+
+	if _, err = NewLazyConn(&Config{Net: "lazydial", Addr: "localhost", Params: map[string]string{"charset": "gbk"}, MultiStatements: true}); err != errInvalidDSNUnsafeCharset {
+		t.Errorf("expected %v, got %v", errInvalidDSNUnsafeCharset, err)
+	}
+}
+
+func TestStmtClosedConn(t *testing.T) {
+	// statement closed itself or of a closed connection
+	for _, stmt := range []*Stmt{{}, {conn: &Conn{}}} {
+		if _, err := stmt.Exec(); err != ErrInvalidConn {
+			t.Errorf("Exec: expected ErrInvalidConn, got %v", err)
+		}
+		if _, err := stmt.Query(); err != ErrInvalidConn {
+			t.Errorf("Query: expected ErrInvalidConn, got %v", err)
+		}
+		if err := stmt.QueryRow().Scan(); err != ErrInvalidConn {
+			t.Errorf("QueryRow: expected ErrInvalidConn, got %v", err)
+		}
+	}
+}
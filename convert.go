@@ -9,10 +9,16 @@
 package gmysql
 
 import (
+	"database/sql/driver"
 	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -29,34 +35,52 @@ func (rows *textRows) convert(dest []interface{}) error {
 			return err
 		}
 
-		//switch v := dest.(type) {
-		switch dest[i].(type) {
-		case interface{}:
+		// Fast path without boxing the value in an interface
+		if rb, ok := dest[i].(*RawBytes); ok && rb != nil {
 			if isNull {
-				dest[i] = nil
+				*rb = nil
 			} else {
-				dest[i] = val
+				*rb = val
 			}
-		case []byte:
-			if isNull {
-				dest[i] = 0
-			} else {
-				dest[i] = val
+			continue
+		}
+
+		var src interface{}
+		if !isNull {
+			src = val
+
+			switch f := &rows.columns[i]; {
+			case f.fieldType == fieldTypeBit:
+				src = convertBit(val, dest[i])
+			case f.isSet():
+				src = convertSet(val, dest[i])
+			case f.fieldType == fieldTypeTime:
+				if _, ok := dest[i].(*time.Duration); ok {
+					if src, err = parseDuration(string(val)); err != nil {
+						return fmt.Errorf("scan error on column index %d: %v", i, err)
+					}
+				}
 			}
-		case time.Time:
-			if isNull {
-				dest[i] = time.Time{}
-			} else {
-				dest[i], err = parseDateTime(
-					string(dest[i].([]byte)),
-					rows.conn.cfg.Loc,
-				)
-				if err != nil {
-					return err
+
+			// Parse the value to time.Time if scanning into a time.Time or if
+			// requested for DATE, DATETIME and TIMESTAMP values
+			_, isTime := dest[i].(*time.Time)
+			if !isTime && rows.conn.cfg.ParseTime {
+				switch rows.columns[i].fieldType {
+				case fieldTypeTimestamp, fieldTypeDateTime,
+					fieldTypeDate, fieldTypeNewDate:
+					isTime = true
+				}
+			}
+			if isTime {
+				if src, err = parseDateTime(string(val), rows.conn.cfg.Loc); err != nil {
+					return fmt.Errorf("scan error on column index %d: %v", i, err)
 				}
 			}
-		default:
-			return errors.New("unsupported scan type")
+		}
+
+		if err = convertAssign(dest[i], src); err != nil {
+			return fmt.Errorf("scan error on column index %d: %v", i, err)
 		}
 	}
 	return nil
@@ -67,104 +91,112 @@ func (rows *binaryRows) convert(dest []interface{}) error {
 	pos := 0
 
 	for i := range dest {
+		var src interface{}
+		var err error
+
 		// Field is NULL
 		// (byte >> bit-pos) % 2 == 1
 		if ((rows.nullMask[(i+2)>>3] >> uint((i+2)&7)) & 1) == 1 {
-			dest[i] = nil
+			if err = convertAssign(dest[i], nil); err != nil {
+				return fmt.Errorf("scan error on column index %d: %v", i, err)
+			}
 			continue
 		}
 
 		// Convert to byte-coded string
 		switch rows.columns[i].fieldType {
 		case fieldTypeNULL:
-			dest[i] = nil
-			continue
+			src = nil
 
 		// Numeric Types
 		case fieldTypeTiny:
 			if rows.columns[i].flags&flagUnsigned != 0 {
-				dest[i] = int64(data[pos])
+				src = int64(data[pos])
 			} else {
-				dest[i] = int64(int8(data[pos]))
+				src = int64(int8(data[pos]))
 			}
 			pos++
-			continue
 
 		case fieldTypeShort, fieldTypeYear:
 			if rows.columns[i].flags&flagUnsigned != 0 {
-				dest[i] = int64(binary.LittleEndian.Uint16(data[pos : pos+2]))
+				src = int64(binary.LittleEndian.Uint16(data[pos : pos+2]))
 			} else {
-				dest[i] = int64(int16(binary.LittleEndian.Uint16(data[pos : pos+2])))
+				src = int64(int16(binary.LittleEndian.Uint16(data[pos : pos+2])))
 			}
 			pos += 2
-			continue
 
 		case fieldTypeInt24, fieldTypeLong:
 			if rows.columns[i].flags&flagUnsigned != 0 {
-				dest[i] = int64(binary.LittleEndian.Uint32(data[pos : pos+4]))
+				src = int64(binary.LittleEndian.Uint32(data[pos : pos+4]))
 			} else {
-				dest[i] = int64(int32(binary.LittleEndian.Uint32(data[pos : pos+4])))
+				src = int64(int32(binary.LittleEndian.Uint32(data[pos : pos+4])))
 			}
 			pos += 4
-			continue
 
 		case fieldTypeLongLong:
 			if rows.columns[i].flags&flagUnsigned != 0 {
 				val := binary.LittleEndian.Uint64(data[pos : pos+8])
 				if val > math.MaxInt64 {
-					dest[i] = uint64ToString(val)
+					src = uint64ToString(val)
 				} else {
-					dest[i] = int64(val)
+					src = int64(val)
 				}
 			} else {
-				dest[i] = int64(binary.LittleEndian.Uint64(data[pos : pos+8]))
+				src = int64(binary.LittleEndian.Uint64(data[pos : pos+8]))
 			}
 			pos += 8
-			continue
 
 		case fieldTypeFloat:
-			dest[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(data[pos : pos+4])))
+			src = float64(math.Float32frombits(binary.LittleEndian.Uint32(data[pos : pos+4])))
 			pos += 4
-			continue
 
 		case fieldTypeDouble:
-			dest[i] = math.Float64frombits(binary.LittleEndian.Uint64(data[pos : pos+8]))
+			src = math.Float64frombits(binary.LittleEndian.Uint64(data[pos : pos+8]))
 			pos += 8
-			continue
 
 		// Length coded Binary Strings
 		case fieldTypeDecimal, fieldTypeNewDecimal, fieldTypeVarChar,
-			fieldTypeBit, fieldTypeEnum, fieldTypeSet, fieldTypeTinyBLOB,
+			fieldTypeEnum, fieldTypeSet, fieldTypeTinyBLOB,
 			fieldTypeMediumBLOB, fieldTypeLongBLOB, fieldTypeBLOB,
-			fieldTypeVarString, fieldTypeString, fieldTypeGeometry:
-			var isNull bool
-			var n int
-			var err error
-			dest[i], isNull, n, err = readLengthEncodedString(data[pos:])
+			fieldTypeVarString, fieldTypeString, fieldTypeGeometry, fieldTypeJSON:
+			val, isNull, n, err := readLengthEncodedString(data[pos:])
 			pos += n
-			if err == nil {
-				if !isNull {
-					continue
-				} else {
-					dest[i] = nil
-					continue
+			if err != nil {
+				return err
+			}
+			if !isNull {
+				src = val
+				if rows.columns[i].isSet() {
+					src = convertSet(val, dest[i])
 				}
 			}
-			return err
+
+		case fieldTypeBit:
+			val, isNull, n, err := readLengthEncodedString(data[pos:])
+			pos += n
+			if err != nil {
+				return err
+			}
+			if !isNull {
+				src = convertBit(val, dest[i])
+			}
 
 		case
 			fieldTypeDate, fieldTypeNewDate, // Date YYYY-MM-DD
 			fieldTypeTime,                         // Time [-][H]HH:MM:SS[.fractal]
 			fieldTypeTimestamp, fieldTypeDateTime: // Timestamp YYYY-MM-DD HH:MM:SS[.fractal]
 
-			var err error
 			num, isNull, n := readLengthEncodedInteger(data[pos:])
 			pos += n
 
+			_, isTime := dest[i].(*time.Time)
+			_, isDuration := dest[i].(*time.Duration)
+
 			switch {
 			case isNull:
-				dest[i] = nil
-				continue
+				src = nil
+			case rows.columns[i].fieldType == fieldTypeTime && isDuration:
+				src, err = parseBinaryDuration(data[pos : pos+int(num)])
 			case rows.columns[i].fieldType == fieldTypeTime:
 				// database/sql does not support an equivalent to TIME, return a string
 				var dstlen uint8
@@ -179,9 +211,9 @@ func (rows *binaryRows) convert(dest []interface{}) error {
 						rows.columns[i].decimals,
 					)
 				}
-				dest[i], err = formatBinaryDateTime(data[pos:pos+int(num)], dstlen, true)
-			//case rows.conn.parseTime:
-			//	dest[i], err = parseBinaryDateTime(num, data[pos:], rows.conn.cfg.Loc)
+				src, err = formatBinaryDateTime(data[pos:pos+int(num)], dstlen, true)
+			case isTime || rows.conn.cfg.ParseTime:
+				src, err = parseBinaryDateTime(num, data[pos:], rows.conn.cfg.Loc)
 			default:
 				var dstlen uint8
 				if rows.columns[i].fieldType == fieldTypeDate {
@@ -199,20 +231,511 @@ func (rows *binaryRows) convert(dest []interface{}) error {
 						)
 					}
 				}
-				dest[i], err = formatBinaryDateTime(data[pos:pos+int(num)], dstlen, false)
+				src, err = formatBinaryDateTime(data[pos:pos+int(num)], dstlen, false)
 			}
 
-			if err == nil {
-				pos += int(num)
-				continue
-			} else {
+			if err != nil {
 				return err
 			}
+			pos += int(num)
 
 		// Please report if this happens!
 		default:
 			return fmt.Errorf("Unknown FieldType %d", rows.columns[i].fieldType)
 		}
+
+		if err = convertAssign(dest[i], src); err != nil {
+			return fmt.Errorf("scan error on column index %d: %v", i, err)
+		}
 	}
 	return nil
 }
+
+// Scanner is an interface used by Scan.
+// It is identical to the Scanner interface of database/sql, thus all types
+// implementing sql.Scanner, like sql.NullString, can be used as destinations.
+type Scanner interface {
+	// Scan assigns a value from a database driver.
+	//
+	// The src value will be of one of the following types:
+	//
+	//    int64
+	//    float64
+	//    bool
+	//    []byte
+	//    string
+	//    time.Time
+	//    nil - for NULL values
+	//
+	// A []byte value is only valid until the next call of Next. Scan must
+	// copy it if the data should be retained.
+	//
+	// An error should be returned if the value can not be stored
+	// without loss of information.
+	Scan(src interface{}) error
+}
+
+var errNilPtr = errors.New("destination pointer is nil") // embedded in descriptive error
+
+// convertBit returns the value of a BIT column as uint64 if it is scanned into
+// an integer. Otherwise the raw big-endian bytes are returned.
+func convertBit(val []byte, dest interface{}) interface{} {
+	switch dest.(type) {
+	case *int, *int8, *int16, *int32, *int64,
+		*uint, *uint8, *uint16, *uint32, *uint64:
+		var n uint64
+		for _, b := range val {
+			n = n<<8 | uint64(b)
+		}
+		return n
+	}
+	return val
+}
+
+// convertSet returns the members of a SET value as []string if it is scanned
+// into a *[]string. Otherwise the comma separated members are returned.
+func convertSet(val []byte, dest interface{}) interface{} {
+	if _, ok := dest.(*[]string); !ok {
+		return val
+	}
+	if len(val) == 0 {
+		return []string{}
+	}
+	return strings.Split(string(val), ",")
+}
+
+// convertAssign copies to dest the value in src, converting it if possible.
+// An error is returned if the copy would result in loss of information.
+// dest should be a pointer type.
+// The conversion rules follow those of database/sql's Scan.
+func convertAssign(dest, src interface{}) error {
+	// Common cases, without reflect.
+	switch s := src.(type) {
+	case string:
+		switch d := dest.(type) {
+		case *string:
+			if d == nil {
+				return errNilPtr
+			}
+			*d = s
+			return nil
+		case *[]byte:
+			if d == nil {
+				return errNilPtr
+			}
+			*d = []byte(s)
+			return nil
+		case *RawBytes:
+			if d == nil {
+				return errNilPtr
+			}
+			*d = append((*d)[:0], s...)
+			return nil
+		}
+	case []byte:
+		switch d := dest.(type) {
+		case *RawBytes:
+			if d == nil {
+				return errNilPtr
+			}
+			// no copy, only valid until the next read
+			*d = s
+			return nil
+		case *string:
+			if d == nil {
+				return errNilPtr
+			}
+			*d = string(s)
+			return nil
+		case *interface{}:
+			if d == nil {
+				return errNilPtr
+			}
+			*d = cloneBytes(s)
+			return nil
+		case *[]byte:
+			if d == nil {
+				return errNilPtr
+			}
+			*d = cloneBytes(s)
+			return nil
+		case *json.RawMessage:
+			if d == nil {
+				return errNilPtr
+			}
+			*d = cloneBytes(s)
+			return nil
+		}
+	case time.Duration:
+		switch d := dest.(type) {
+		case *time.Duration:
+			if d == nil {
+				return errNilPtr
+			}
+			*d = s
+			return nil
+		}
+	case time.Time:
+		switch d := dest.(type) {
+		case *time.Time:
+			if d == nil {
+				return errNilPtr
+			}
+			*d = s
+			return nil
+		case *string:
+			if d == nil {
+				return errNilPtr
+			}
+			*d = s.Format(time.RFC3339Nano)
+			return nil
+		case *[]byte:
+			if d == nil {
+				return errNilPtr
+			}
+			*d = []byte(s.Format(time.RFC3339Nano))
+			return nil
+		case *RawBytes:
+			if d == nil {
+				return errNilPtr
+			}
+			*d = append((*d)[:0], s.Format(time.RFC3339Nano)...)
+			return nil
+		}
+	case nil:
+		switch d := dest.(type) {
+		case *interface{}:
+			if d == nil {
+				return errNilPtr
+			}
+			*d = nil
+			return nil
+		case *[]byte:
+			if d == nil {
+				return errNilPtr
+			}
+			*d = nil
+			return nil
+		case *RawBytes:
+			if d == nil {
+				return errNilPtr
+			}
+			*d = nil
+			return nil
+		case *json.RawMessage:
+			if d == nil {
+				return errNilPtr
+			}
+			*d = nil
+			return nil
+		}
+	}
+
+	var sv reflect.Value
+
+	switch d := dest.(type) {
+	case Scanner:
+		return d.Scan(src)
+	case *string:
+		sv = reflect.ValueOf(src)
+		switch sv.Kind() {
+		case reflect.Bool,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			*d = asString(src)
+			return nil
+		}
+	case *[]byte:
+		sv = reflect.ValueOf(src)
+		if b, ok := asBytes(nil, sv); ok {
+			*d = b
+			return nil
+		}
+	case *RawBytes:
+		sv = reflect.ValueOf(src)
+		if b, ok := asBytes([]byte(*d)[:0], sv); ok {
+			*d = RawBytes(b)
+			return nil
+		}
+	case *bool:
+		bv, err := asBool(src)
+		if err == nil {
+			*d = bv
+		}
+		return err
+	case *interface{}:
+		*d = src
+		return nil
+	}
+
+	dpv := reflect.ValueOf(dest)
+	if dpv.Kind() != reflect.Ptr {
+		return errors.New("destination not a pointer")
+	}
+	if dpv.IsNil() {
+		return errNilPtr
+	}
+
+	if !sv.IsValid() {
+		sv = reflect.ValueOf(src)
+	}
+
+	dv := reflect.Indirect(dpv)
+	if sv.IsValid() && sv.Type().AssignableTo(dv.Type()) {
+		switch b := src.(type) {
+		case []byte:
+			dv.Set(reflect.ValueOf(cloneBytes(b)))
+		default:
+			dv.Set(sv)
+		}
+		return nil
+	}
+
+	if dv.Kind() == sv.Kind() && sv.Type().ConvertibleTo(dv.Type()) {
+		dv.Set(sv.Convert(dv.Type()))
+		return nil
+	}
+
+	// The following conversions use a string value as an intermediate
+	// representation to convert between various numeric types.
+	switch dv.Kind() {
+	case reflect.Ptr:
+		if src == nil {
+			dv.Set(reflect.Zero(dv.Type()))
+			return nil
+		}
+		dv.Set(reflect.New(dv.Type().Elem()))
+		return convertAssign(dv.Interface(), src)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if src == nil {
+			return fmt.Errorf("converting NULL to %s is unsupported", dv.Kind())
+		}
+		s := asString(src)
+		i64, err := strconv.ParseInt(s, 10, dv.Type().Bits())
+		if err != nil {
+			err = strconvErr(err)
+			return fmt.Errorf("converting driver.Value type %T (%q) to a %s: %v", src, s, dv.Kind(), err)
+		}
+		dv.SetInt(i64)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if src == nil {
+			return fmt.Errorf("converting NULL to %s is unsupported", dv.Kind())
+		}
+		s := asString(src)
+		u64, err := strconv.ParseUint(s, 10, dv.Type().Bits())
+		if err != nil {
+			err = strconvErr(err)
+			return fmt.Errorf("converting driver.Value type %T (%q) to a %s: %v", src, s, dv.Kind(), err)
+		}
+		dv.SetUint(u64)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		if src == nil {
+			return fmt.Errorf("converting NULL to %s is unsupported", dv.Kind())
+		}
+		s := asString(src)
+		f64, err := strconv.ParseFloat(s, dv.Type().Bits())
+		if err != nil {
+			err = strconvErr(err)
+			return fmt.Errorf("converting driver.Value type %T (%q) to a %s: %v", src, s, dv.Kind(), err)
+		}
+		dv.SetFloat(f64)
+		return nil
+	case reflect.String:
+		if src == nil {
+			return fmt.Errorf("converting NULL to %s is unsupported", dv.Kind())
+		}
+		switch v := src.(type) {
+		case string:
+			dv.SetString(v)
+			return nil
+		case []byte:
+			dv.SetString(string(v))
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unsupported Scan, storing driver.Value type %T into type %T", src, dest)
+}
+
+func strconvErr(err error) error {
+	if ne, ok := err.(*strconv.NumError); ok {
+		return ne.Err
+	}
+	return err
+}
+
+func cloneBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	c := make([]byte, len(b))
+	copy(c, b)
+	return c
+}
+
+func asString(src interface{}) string {
+	switch v := src.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	rv := reflect.ValueOf(src)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10)
+	case reflect.Float64:
+		return strconv.FormatFloat(rv.Float(), 'g', -1, 64)
+	case reflect.Float32:
+		return strconv.FormatFloat(rv.Float(), 'g', -1, 32)
+	case reflect.Bool:
+		return strconv.FormatBool(rv.Bool())
+	}
+	return fmt.Sprintf("%v", src)
+}
+
+func asBytes(buf []byte, rv reflect.Value) (b []byte, ok bool) {
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.AppendInt(buf, rv.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.AppendUint(buf, rv.Uint(), 10), true
+	case reflect.Float32:
+		return strconv.AppendFloat(buf, rv.Float(), 'g', -1, 32), true
+	case reflect.Float64:
+		return strconv.AppendFloat(buf, rv.Float(), 'g', -1, 64), true
+	case reflect.Bool:
+		return strconv.AppendBool(buf, rv.Bool()), true
+	case reflect.String:
+		s := rv.String()
+		return append(buf, s...), true
+	}
+	return
+}
+
+// asBool converts the value to a bool like database/sql/driver.Bool does.
+// Integers must be 0 or 1, strings and byte slices are parsed with
+// strconv.ParseBool.
+func asBool(src interface{}) (bool, error) {
+	switch s := src.(type) {
+	case bool:
+		return s, nil
+	case string:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return false, fmt.Errorf("couldn't convert %q into type bool", s)
+		}
+		return b, nil
+	case []byte:
+		b, err := strconv.ParseBool(string(s))
+		if err != nil {
+			return false, fmt.Errorf("couldn't convert %q into type bool", s)
+		}
+		return b, nil
+	case nil:
+		return false, errors.New("converting NULL to bool is unsupported")
+	}
+
+	sv := reflect.ValueOf(src)
+	switch sv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch iv := sv.Int(); iv {
+		case 1:
+			return true, nil
+		case 0:
+			return false, nil
+		default:
+			return false, fmt.Errorf("couldn't convert %d into type bool", iv)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		switch uv := sv.Uint(); uv {
+		case 1:
+			return true, nil
+		case 0:
+			return false, nil
+		default:
+			return false, fmt.Errorf("couldn't convert %d into type bool", uv)
+		}
+	}
+	return false, fmt.Errorf("couldn't convert %v (%T) into type bool", src, src)
+}
+
+// convertArg converts a query argument to one of the types handled by
+// interpolateParams and writeExecutePacket. Implementations of driver.Valuer
+// are converted to the value returned by their Value method, e.g. the
+// sql.NullXxx types to nil if they are not Valid. Integers and
+// floats of all sizes, including named types like `type ID int32`, are
+// converted to int64, uint64 and float64. A *big.Int is converted to int64 or
+// uint64 if it fits, otherwise to its decimal string. Named bool and string
+// types are converted to their underlying type. This takes precedence over
+// fmt.Stringer, e.g. a time.Duration is sent as its number of nanoseconds.
+// json.RawMessage and other implementations of fmt.Stringer, like net.IP, are
+// converted to a string. Other named []byte types are converted to []byte.
+// Arguments which can not be converted are returned unchanged.
+func convertArg(arg interface{}) (interface{}, error) {
+	switch v := arg.(type) {
+	case nil, int64, uint64, float64, bool, []byte, string, time.Time:
+		return arg, nil
+	case driver.Valuer:
+		value, err := v.Value()
+		if err != nil {
+			return nil, err
+		}
+		if !driver.IsValue(value) {
+			return nil, fmt.Errorf("non-Value type %T returned from Value", value)
+		}
+		return value, nil
+	case int:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case float32:
+		return float64(v), nil
+	case *big.Int:
+		switch {
+		case v == nil:
+			return nil, nil
+		case v.BitLen() < 64, v.BitLen() == 64 && v.Sign() < 0 && v.Int64() == math.MinInt64:
+			return v.Int64(), nil
+		case v.Sign() > 0 && v.BitLen() == 64:
+			return v.Uint64(), nil
+		}
+		return v.String(), nil
+	case json.RawMessage:
+		// JSON columns reject strings with the binary character set
+		return string(v), nil
+	}
+
+	// Named numeric types are converted to their value, even if they
+	// implement fmt.Stringer, like time.Duration
+	rv := reflect.ValueOf(arg)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return int64(rv.Uint()), nil
+	case reflect.Uint, reflect.Uint64:
+		return rv.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	case reflect.Bool:
+		return rv.Bool(), nil
+	case reflect.String:
+		return rv.String(), nil
+	}
+
+	if v, ok := arg.(fmt.Stringer); ok {
+		return v.String(), nil
+	}
+	if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8 {
+		return rv.Bytes(), nil
+	}
+	return arg, nil
+}
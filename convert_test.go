@@ -0,0 +1,508 @@
+// gmysql - A MySQL package for Go
+//
+// Copyright 2016 The gmysql Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package gmysql
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestConvertAssign(t *testing.T) {
+	var (
+		i    int
+		i8   int8
+		i64  int64
+		u64  uint64
+		f64  float64
+		s    string
+		b    []byte
+		bl   bool
+		ifc  interface{}
+		pi64 *int64
+	)
+
+	var convertTests = []struct {
+		src   interface{}
+		dest  interface{}
+		want  interface{}
+		error bool
+	}{
+		{[]byte("42"), &i, 42, false},
+		{int64(42), &i, 42, false},
+		{[]byte("-1"), &i64, int64(-1), false},
+		{int64(-7), &i64, int64(-7), false},
+		{[]byte("18446744073709551615"), &u64, uint64(18446744073709551615), false},
+		{int64(1), &u64, uint64(1), false},
+		{[]byte("3.25"), &f64, 3.25, false},
+		{float64(2.5), &f64, 2.5, false},
+		{[]byte("foo"), &s, "foo", false},
+		{int64(42), &s, "42", false},
+		{[]byte("bar"), &b, []byte("bar"), false},
+		{int64(7), &b, []byte("7"), false},
+		{[]byte("1"), &bl, true, false},
+		{int64(0), &bl, false, false},
+		{[]byte("abc"), &ifc, []byte("abc"), false},
+		{int64(9), &pi64, int64(9), false},
+
+		{[]byte("300"), &i8, nil, true},
+		{[]byte("foo"), &i, nil, true},
+		{[]byte("-1"), &u64, nil, true},
+		{int64(2), &bl, nil, true},
+		{nil, &i, nil, true},
+		{nil, &s, nil, true},
+		{[]byte("1"), i, nil, true},
+		{tDateTime, (*time.Time)(nil), nil, true},
+		{tDateTime, (*string)(nil), nil, true},
+	}
+
+	for n, tst := range convertTests {
+		err := convertAssign(tst.dest, tst.src)
+		if (err != nil) != tst.error {
+			t.Errorf("%d: expected error status %t, got %v", n, tst.error, err)
+			continue
+		}
+		if tst.error {
+			continue
+		}
+
+		var got interface{}
+		switch d := tst.dest.(type) {
+		case *int:
+			got = *d
+		case *int64:
+			got = *d
+		case *uint64:
+			got = *d
+		case *float64:
+			got = *d
+		case *string:
+			got = *d
+		case *[]byte:
+			if !bytes.Equal(*d, tst.want.([]byte)) {
+				t.Errorf("%d: expected %q, got %q", n, tst.want, *d)
+			}
+			continue
+		case *bool:
+			got = *d
+		case *interface{}:
+			if !bytes.Equal((*d).([]byte), tst.want.([]byte)) {
+				t.Errorf("%d: expected %q, got %q", n, tst.want, *d)
+			}
+			continue
+		case **int64:
+			got = **d
+		}
+		if got != tst.want {
+			t.Errorf("%d: expected %v, got %v", n, tst.want, got)
+		}
+	}
+}
+
+func TestConvertAssignNullBytes(t *testing.T) {
+	b := []byte("not nil")
+	if err := convertAssign(&b, nil); err != nil {
+		t.Fatal(err)
+	}
+	if b != nil {
+		t.Errorf("expected nil, got %q", b)
+	}
+
+	// a copy must be made
+	src := []byte("foo")
+	if err := convertAssign(&b, src); err != nil {
+		t.Fatal(err)
+	}
+	src[0] = 'b'
+	if string(b) != "foo" {
+		t.Errorf("expected %q, got %q", "foo", b)
+	}
+}
+
+func TestConvertAssignRawBytes(t *testing.T) {
+	// []byte values are not copied
+	src := []byte("foo")
+	var rb RawBytes
+	if err := convertAssign(&rb, src); err != nil {
+		t.Fatal(err)
+	}
+	src[0] = 'b'
+	if string(rb) != "boo" {
+		t.Errorf("expected RawBytes to reference the source, got %q", rb)
+	}
+
+	// other values reuse the memory of the RawBytes
+	rb = make(RawBytes, 0, 8)
+	if err := convertAssign(&rb, int64(42)); err != nil {
+		t.Fatal(err)
+	}
+	if string(rb) != "42" || cap(rb) != 8 {
+		t.Errorf("expected %q with cap 8, got %q with cap %d", "42", rb, cap(rb))
+	}
+
+	if err := convertAssign(&rb, nil); err != nil {
+		t.Fatal(err)
+	}
+	if rb != nil {
+		t.Errorf("expected nil, got %q", rb)
+	}
+}
+
+type testScanner struct {
+	val   string
+	valid bool
+}
+
+func (ts *testScanner) Scan(src interface{}) error {
+	if src == nil {
+		ts.val, ts.valid = "", false
+		return nil
+	}
+	b, ok := src.([]byte)
+	if !ok {
+		return errors.New("unexpected type")
+	}
+	ts.val, ts.valid = string(b), true
+	return nil
+}
+
+func TestConvertAssignScanner(t *testing.T) {
+	var ts testScanner
+	if err := convertAssign(&ts, []byte("foo")); err != nil {
+		t.Fatal(err)
+	}
+	if !ts.valid || ts.val != "foo" {
+		t.Errorf("expected valid %q, got %+v", "foo", ts)
+	}
+
+	if err := convertAssign(&ts, nil); err != nil {
+		t.Fatal(err)
+	}
+	if ts.valid {
+		t.Errorf("expected NULL, got %+v", ts)
+	}
+
+	// errors are passed through
+	if err := convertAssign(&ts, int64(1)); err == nil {
+		t.Error("expected error, got nil")
+	}
+
+	var nt NullTime
+	if err := convertAssign(&nt, []byte(sDateTime)); err != nil {
+		t.Fatal(err)
+	}
+	if !nt.Valid || nt.Time != tDateTime {
+		t.Errorf("expected %v, got %+v", tDateTime, nt)
+	}
+}
+
+func TestBinaryRowsParseTime(t *testing.T) {
+	rows := &binaryRows{
+		iRows: iRows{
+			conn: &Conn{cfg: &Config{Loc: time.UTC, ParseTime: true}},
+			columns: []Field{
+				{name: "datetime", fieldType: fieldTypeDateTime},
+				{name: "date", fieldType: fieldTypeDate},
+				{name: "zero", fieldType: fieldTypeDateTime},
+				{name: "time", fieldType: fieldTypeTime},
+				{name: "null", fieldType: fieldTypeDateTime},
+			},
+			data: []byte{
+				7, 0xdb, 0x07, 11, 20, 21, 27, 37, // 2011-11-20 21:27:37
+				4, 0xdc, 0x07, 6, 14, // 2012-06-14
+				0,                         // 0000-00-00 00:00:00
+				8, 0, 0, 0, 0, 0, 1, 2, 3, // 01:02:03
+			},
+		},
+		nullMask: []byte{0x80}, // column 4 (bit offset 2)
+	}
+
+	var datetime, date, zero interface{}
+	var tm string
+	var null NullTime
+	if err := rows.convert([]interface{}{&datetime, &date, &zero, &tm, &null}); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, ok := datetime.(time.Time); !ok || v != tDateTime {
+		t.Errorf("expected %v, got %#v", tDateTime, datetime)
+	}
+	if v, ok := date.(time.Time); !ok || v != tDate {
+		t.Errorf("expected %v, got %#v", tDate, date)
+	}
+	if v, ok := zero.(time.Time); !ok || !v.IsZero() {
+		t.Errorf("expected zero time, got %#v", zero)
+	}
+	if tm != "01:02:03" {
+		t.Errorf("expected %q, got %q", "01:02:03", tm)
+	}
+	if null.Valid {
+		t.Errorf("expected NULL, got %+v", null)
+	}
+
+	// without parseTime DATE and DATETIME values are returned as []byte,
+	// unless they are scanned into a time.Time
+	rows.conn.cfg.ParseTime = false
+	var dt time.Time
+	if err := rows.convert([]interface{}{&dt, &date, &zero, &tm, &null}); err != nil {
+		t.Fatal(err)
+	}
+	if dt != tDateTime {
+		t.Errorf("expected %v, got %v", tDateTime, dt)
+	}
+	if v, ok := date.([]byte); !ok || string(v) != sDate {
+		t.Errorf("expected %q, got %#v", sDate, date)
+	}
+}
+
+func TestBinaryRowsJSON(t *testing.T) {
+	rows := &binaryRows{
+		iRows: iRows{
+			conn: &Conn{cfg: &Config{Loc: time.UTC}},
+			columns: []Field{
+				{name: "raw", fieldType: fieldTypeJSON},
+				{name: "str", fieldType: fieldTypeJSON},
+				{name: "null", fieldType: fieldTypeJSON},
+			},
+			data: []byte{
+				8, '{', '"', 'a', '"', ':', ' ', '1', '}',
+				2, '[', ']',
+			},
+		},
+		nullMask: []byte{0x10}, // column 2 (bit offset 2)
+	}
+
+	var raw, null json.RawMessage
+	var str string
+	if err := rows.convert([]interface{}{&raw, &str, &null}); err != nil {
+		t.Fatal(err)
+	}
+	if string(raw) != `{"a": 1}` {
+		t.Errorf("expected %q, got %q", `{"a": 1}`, raw)
+	}
+	if str != "[]" {
+		t.Errorf("expected %q, got %q", "[]", str)
+	}
+	if null != nil {
+		t.Errorf("expected nil, got %q", null)
+	}
+
+	// the value must be a copy
+	rows.data[1] = 'x'
+	if raw[0] != '{' {
+		t.Error("json.RawMessage references the row data")
+	}
+}
+
+func TestConvertBit(t *testing.T) {
+	columns := []Field{
+		{name: "flags", fieldType: fieldTypeBit, length: 8},
+		{name: "mask", fieldType: fieldTypeBit, length: 16},
+		{name: "raw", fieldType: fieldTypeBit, length: 16},
+	}
+	data := []byte{
+		1, 0x80, // b'10000000'
+		2, 0x01, 0x02,
+		2, 0x01, 0x02,
+	}
+
+	tr := &textRows{iRows{conn: &Conn{cfg: &Config{}}, columns: columns, data: data}}
+	br := &binaryRows{
+		iRows:    iRows{conn: &Conn{cfg: &Config{}}, columns: columns, data: data},
+		nullMask: []byte{0x00},
+	}
+
+	for _, rows := range []Rows{tr, br} {
+		var flags uint64
+		var mask int
+		var raw []byte
+		if err := rows.Scan(&flags, &mask, &raw); err != nil {
+			t.Fatalf("%T: %v", rows, err)
+		}
+		if flags != 128 {
+			t.Errorf("%T: expected 128, got %d", rows, flags)
+		}
+		if mask != 0x0102 {
+			t.Errorf("%T: expected %d, got %d", rows, 0x0102, mask)
+		}
+		if !bytes.Equal(raw, []byte{0x01, 0x02}) {
+			t.Errorf("%T: expected raw bytes, got %v", rows, raw)
+		}
+	}
+
+	// overflow
+	var small int8
+	if err := convertAssign(&small, convertBit([]byte{0x80}, &small)); err == nil {
+		t.Error("expected overflow error")
+	}
+}
+
+func TestConvertSet(t *testing.T) {
+	columns := []Field{
+		{name: "set", fieldType: fieldTypeString, flags: flagSet},
+		{name: "empty", fieldType: fieldTypeSet},
+		{name: "str", fieldType: fieldTypeString, flags: flagSet},
+		{name: "enum", fieldType: fieldTypeString, flags: flagEnum},
+	}
+	data := []byte{
+		3, 'a', ',', 'c',
+		0,
+		3, 'a', ',', 'c',
+		1, 'b',
+	}
+
+	tr := &textRows{iRows{conn: &Conn{cfg: &Config{}}, columns: columns, data: data}}
+	br := &binaryRows{
+		iRows:    iRows{conn: &Conn{cfg: &Config{}}, columns: columns, data: data},
+		nullMask: []byte{0x00},
+	}
+
+	for _, rows := range []Rows{tr, br} {
+		var set, empty []string
+		var str, enum string
+		if err := rows.Scan(&set, &empty, &str, &enum); err != nil {
+			t.Fatalf("%T: %v", rows, err)
+		}
+		if len(set) != 2 || set[0] != "a" || set[1] != "c" {
+			t.Errorf("%T: expected [a c], got %q", rows, set)
+		}
+		if empty == nil || len(empty) != 0 {
+			t.Errorf("%T: expected empty non-nil slice, got %#v", rows, empty)
+		}
+		if str != "a,c" {
+			t.Errorf("%T: expected %q, got %q", rows, "a,c", str)
+		}
+		if enum != "b" {
+			t.Errorf("%T: expected %q, got %q", rows, "b", enum)
+		}
+	}
+}
+
+func TestConvertDuration(t *testing.T) {
+	columns := []Field{
+		{name: "long", fieldType: fieldTypeTime},
+		{name: "negative", fieldType: fieldTypeTime, decimals: 3},
+		{name: "str", fieldType: fieldTypeTime},
+	}
+	tr := &textRows{iRows{
+		conn:    &Conn{cfg: &Config{}},
+		columns: columns,
+		data: []byte{
+			9, '1', '0', '0', ':', '0', '0', ':', '0', '0',
+			13, '-', '1', '2', ':', '3', '4', ':', '5', '6', '.', '5', '0', '0',
+			8, '0', '1', ':', '0', '2', ':', '0', '3',
+		},
+	}}
+	br := &binaryRows{
+		iRows: iRows{
+			conn:    &Conn{cfg: &Config{}},
+			columns: columns,
+			data: []byte{
+				8, 0, 4, 0, 0, 0, 4, 0, 0, // 4 days 4 hours
+				12, 1, 0, 0, 0, 0, 12, 34, 56, 0x20, 0xa1, 0x07, 0x00, // negative, 500000µs
+				8, 0, 0, 0, 0, 0, 1, 2, 3,
+			},
+		},
+		nullMask: []byte{0x00},
+	}
+
+	for _, rows := range []Rows{tr, br} {
+		var long, negative time.Duration
+		var str string
+		if err := rows.Scan(&long, &negative, &str); err != nil {
+			t.Fatalf("%T: %v", rows, err)
+		}
+		if long != 100*time.Hour {
+			t.Errorf("%T: expected 100h, got %v", rows, long)
+		}
+		if expected := -(12*time.Hour + 34*time.Minute + 56*time.Second + 500*time.Millisecond); negative != expected {
+			t.Errorf("%T: expected %v, got %v", rows, expected, negative)
+		}
+		if str != "01:02:03" {
+			t.Errorf("%T: expected 01:02:03, got %q", rows, str)
+		}
+	}
+}
+
+func TestNullTypes(t *testing.T) {
+	conn := &Conn{cfg: &Config{Loc: time.UTC}}
+	columns := []Field{
+		{name: "bool", fieldType: fieldTypeTiny},
+		{name: "int", fieldType: fieldTypeLongLong},
+		{name: "float", fieldType: fieldTypeDouble},
+		{name: "string", fieldType: fieldTypeVarString},
+	}
+
+	textNull := &textRows{iRows{conn: conn, columns: columns,
+		data: []byte{0xfb, 0xfb, 0xfb, 0xfb},
+	}}
+	textValid := &textRows{iRows{conn: conn, columns: columns,
+		data: []byte{1, '1', 2, '4', '2', 3, '1', '.', '5', 3, 'f', 'o', 'o'},
+	}}
+	binaryNull := &binaryRows{
+		iRows:    iRows{conn: conn, columns: columns, data: []byte{}},
+		nullMask: []byte{0x3c}, // columns 0-3 (bit offset 2)
+	}
+	binaryValid := &binaryRows{
+		iRows: iRows{conn: conn, columns: columns,
+			data: []byte{
+				1,                       // TINYINT
+				42, 0, 0, 0, 0, 0, 0, 0, // BIGINT
+				0, 0, 0, 0, 0, 0, 0xf8, 0x3f, // DOUBLE 1.5
+				3, 'f', 'o', 'o', // VARCHAR
+			},
+		},
+		nullMask: []byte{0x00},
+	}
+
+	var nullTests = []struct {
+		name  string
+		null  interface{ convert([]interface{}) error }
+		valid interface{ convert([]interface{}) error }
+	}{
+		{"text", textNull, textValid},
+		{"binary", binaryNull, binaryValid},
+	}
+
+	for _, tst := range nullTests {
+		var nb sql.NullBool
+		var ni sql.NullInt64
+		var nf sql.NullFloat64
+		var ns sql.NullString
+
+		// Invalid
+		nb.Valid, ni.Valid, nf.Valid, ns.Valid = true, true, true, true
+		if err := tst.null.convert([]interface{}{&nb, &ni, &nf, &ns}); err != nil {
+			t.Fatalf("%s: %s", tst.name, err.Error())
+		}
+		if nb.Valid || ni.Valid || nf.Valid || ns.Valid {
+			t.Errorf("%s: expected all values to be invalid, got %v %v %v %v", tst.name, nb, ni, nf, ns)
+		}
+
+		// Valid
+		if err := tst.valid.convert([]interface{}{&nb, &ni, &nf, &ns}); err != nil {
+			t.Fatalf("%s: %s", tst.name, err.Error())
+		}
+		if !nb.Valid || nb.Bool != true {
+			t.Errorf("%s: expected valid NullBool true, got %v", tst.name, nb)
+		}
+		if !ni.Valid || ni.Int64 != 42 {
+			t.Errorf("%s: expected valid NullInt64 42, got %v", tst.name, ni)
+		}
+		if !nf.Valid || nf.Float64 != 1.5 {
+			t.Errorf("%s: expected valid NullFloat64 1.5, got %v", tst.name, nf)
+		}
+		if !ns.Valid || ns.String != "foo" {
+			t.Errorf("%s: expected valid NullString \"foo\", got %v", tst.name, ns)
+		}
+	}
+}
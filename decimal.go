@@ -0,0 +1,98 @@
+// gmysql - A MySQL package for Go
+//
+// Copyright 2016 The gmysql Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package gmysql
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math/big"
+	"strconv"
+)
+
+// Decimal is an exact decimal number, like the values of DECIMAL columns.
+// Scanning DECIMAL values into a float64 may lose precision, scanning them into
+// a Decimal never does:
+//
+//  var price Decimal
+//  err := conn.QueryRow("SELECT price FROM foo WHERE id=?", id).Scan(&price)
+//
+// A Decimal can be passed as a query parameter as well. The zero value is 0.
+type Decimal struct {
+	str string // decimal representation, e.g. "-12.340"
+}
+
+// ParseDecimal parses a decimal number with an optional sign and an optional
+// fractional part, e.g. "-12.340".
+func ParseDecimal(s string) (Decimal, error) {
+	if !isDecimal(s) {
+		return Decimal{}, fmt.Errorf("invalid decimal number: %q", s)
+	}
+	return Decimal{str: s}, nil
+}
+
+// String returns the decimal representation of the number, including all
+// trailing zeros of the fractional part.
+func (d Decimal) String() string {
+	if d.str == "" {
+		return "0"
+	}
+	return d.str
+}
+
+// Rat returns the exact value of the number.
+func (d Decimal) Rat() *big.Rat {
+	r, _ := new(big.Rat).SetString(d.String())
+	return r
+}
+
+// Scan implements the Scanner interface.
+// The value type must be []byte / string (decimal number), int64 or float64,
+// otherwise Scan fails. NULL values can not be scanned.
+func (d *Decimal) Scan(value interface{}) (err error) {
+	switch v := value.(type) {
+	case []byte:
+		*d, err = ParseDecimal(string(v))
+		return
+	case string:
+		*d, err = ParseDecimal(v)
+		return
+	case int64:
+		d.str = strconv.FormatInt(v, 10)
+		return
+	case float64:
+		d.str = strconv.FormatFloat(v, 'f', -1, 64)
+		return
+	}
+	return fmt.Errorf("Can't convert %T to Decimal", value)
+}
+
+// Value implements the driver Valuer interface.
+func (d Decimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+// isDecimal reports whether s has the form [+-]digits[.digits]
+func isDecimal(s string) bool {
+	if len(s) > 0 && (s[0] == '-' || s[0] == '+') {
+		s = s[1:]
+	}
+
+	digits, dot := 0, false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c >= '0' && c <= '9':
+			digits++
+		case c == '.' && !dot && digits > 0 && i < len(s)-1:
+			dot = true
+		default:
+			return false
+		}
+	}
+	return digits > 0
+}
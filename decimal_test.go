@@ -0,0 +1,88 @@
+// gmysql - A MySQL package for Go
+//
+// Copyright 2016 The gmysql Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package gmysql
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestDecimalScan(t *testing.T) {
+	var scanTests = []struct {
+		value    interface{}
+		expected string
+		valid    bool
+	}{
+		{[]byte("12345678901234567890.1234567890"), "12345678901234567890.1234567890", true},
+		{"-0.001", "-0.001", true},
+		{"+7", "+7", true},
+		{int64(-42), "-42", true},
+		{float64(0.5), "0.5", true},
+		{[]byte("1.2.3"), "", false},
+		{"1e10", "", false},
+		{"1.", "", false},
+		{".5", "", false},
+		{"-", "", false},
+		{"", "", false},
+		{nil, "", false},
+		{true, "", false},
+	}
+
+	for i, tst := range scanTests {
+		var d Decimal
+		err := d.Scan(tst.value)
+		if (err == nil) != tst.valid {
+			t.Errorf("%d: expected valid %t, got error %v", i, tst.valid, err)
+			continue
+		}
+		if tst.valid && d.String() != tst.expected {
+			t.Errorf("%d: expected %s, got %s", i, tst.expected, d.String())
+		}
+	}
+}
+
+func TestDecimalValue(t *testing.T) {
+	var zero Decimal
+	if s := zero.String(); s != "0" {
+		t.Errorf("expected zero value 0, got %s", s)
+	}
+
+	d, err := ParseDecimal("12345678901234567890.1234567890")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := new(big.Rat).SetString("123456789012345678901234567890/10000000000")
+	if d.Rat().Cmp(expected) != 0 {
+		t.Errorf("expected %s, got %s", expected, d.Rat())
+	}
+
+	arg, err := convertArg(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if arg != "12345678901234567890.1234567890" {
+		t.Errorf("unexpected arg %#v", arg)
+	}
+}
+
+func TestConvertDecimal(t *testing.T) {
+	rows := &textRows{iRows{
+		conn:    &Conn{cfg: &Config{}},
+		columns: []Field{{fieldType: fieldTypeNewDecimal, length: 32, decimals: 10}},
+		data:    append([]byte{31}, "12345678901234567890.1234567890"...),
+	}}
+
+	var d Decimal
+	if err := rows.convert([]interface{}{&d}); err != nil {
+		t.Fatal(err)
+	}
+	if d.String() != "12345678901234567890.1234567890" {
+		t.Errorf("unexpected decimal %s", d)
+	}
+}
@@ -11,14 +11,18 @@ package gmysql
 import (
 	//"bytes"
 	//"crypto/tls"
+	"database/sql"
+	"encoding/json"
 	"fmt"
-	//"io"
+	"io"
 	//"io/ioutil"
 	//"log"
+	"math"
+	"math/big"
 	"net"
 	//"net/url"
 	"os"
-	//"strings"
+	"strings"
 	//"sync"
 	//"sync/atomic"
 	"testing"
@@ -125,149 +129,1466 @@ func TestEmptyQuery(t *testing.T) {
 		if rows.Next() {
 			ct.Errorf("Next on rows must be false")
 		}
+		if err := rows.Err(); err != nil {
+			ct.Errorf("expected no error, got %s", err.Error())
+		}
+	})
+}
+
+func TestCRUD(t *testing.T) {
+	runTests(t, dsn, func(ct *ConnTest) {
+		// Create Table
+		ct.mustExec("CREATE TABLE test (value BOOL)")
+
+		// Test for unexpected data
+		//var out bool
+		rows := ct.mustQuery("SELECT * FROM test")
+		if rows.Next() {
+			ct.Error("unexpected data in empty table")
+		}
+
+		// Create Data
+		res := ct.mustExec("INSERT INTO test VALUES (1)")
+		count, err := res.RowsAffected()
+		if err != nil {
+			ct.Fatalf("res.RowsAffected() returned error: %s", err.Error())
+		}
+		if count != 1 {
+			ct.Fatalf("Expected 1 affected row, got %d", count)
+		}
+
+		id, err := res.LastInsertID()
+		if err != nil {
+			ct.Fatalf("res.LastInsertId() returned error: %s", err.Error())
+		}
+		if id != 0 {
+			ct.Fatalf("Expected InsertID 0, got %d", id)
+		}
+
+		// Read
+		/*rows = ct.mustQuery("SELECT value FROM test")
+		err = rows.Next(&out) // TODO
+		if err != io.EOF {
+			if true != out {
+				ct.Fatalf("true != %t", out) // TODO Errorf
+			}
+
+			if rows.Next() != io.EOF {
+				ct.Error("unexpected data")
+			}
+		} else {
+			ct.Error("no data")
+		}*/
+
+		// Update
+		res = ct.mustExec("UPDATE test SET value = ? WHERE value = ?", false, true)
+		count, err = res.RowsAffected()
+		if err != nil {
+			ct.Fatalf("res.RowsAffected() returned error: %s", err.Error())
+		}
+		if count != 1 {
+			ct.Fatalf("Expected 1 affected row, got %d", count)
+		}
+
+		// Check Update
+		/*rows = ct.mustQuery("SELECT value FROM test")
+		err = rows.Next(&out) // TODO
+		if err != io.EOF {
+			if false != out {
+				ct.Errorf("false != %t", out)
+			}
+
+			if rows.Next() != io.EOF {
+				ct.Error("unexpected data")
+			}
+		} else {
+			ct.Error("no data")
+		}*/
+
+		// Delete
+		res = ct.mustExec("DELETE FROM test WHERE value = ?", false)
+		count, err = res.RowsAffected()
+		if err != nil {
+			ct.Fatalf("res.RowsAffected() returned error: %s", err.Error())
+		}
+		if count != 1 {
+			ct.Fatalf("Expected 1 affected row, got %d", count)
+		}
+
+		// Check for unexpected rows
+		res = ct.mustExec("DELETE FROM test")
+		count, err = res.RowsAffected()
+		if err != nil {
+			ct.Fatalf("res.RowsAffected() returned error: %s", err.Error())
+		}
+		if count != 0 {
+			ct.Fatalf("Expected 0 affected row, got %d", count)
+		}
+	})
+}
+
+func TestInt(t *testing.T) {
+	runTests(t, dsn, func(ct *ConnTest) {
+		types := [5]string{"TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT"}
+		in := int64(42)
+		var out int64
+		var rows Rows
+
+		// SIGNED
+		for _, v := range types {
+			ct.mustExec("CREATE TABLE test (value " + v + ")")
+
+			ct.mustExec("INSERT INTO test VALUES (?)", in)
+
+			rows = ct.mustQuery("SELECT value FROM test")
+			if rows.Next() {
+				rows.Scan(&out)
+				if in != out {
+					ct.Errorf("%s: %d != %d", v, in, out)
+				}
+			} else {
+				ct.Errorf("%s: no data", v)
+			}
+			rows.Close()
+
+			ct.mustExec("DROP TABLE IF EXISTS test")
+		}
+
+		// UNSIGNED ZEROFILL
+		for _, v := range types {
+			ct.mustExec("CREATE TABLE test (value " + v + " ZEROFILL)")
+
+			ct.mustExec("INSERT INTO test VALUES (?)", in)
+
+			rows = ct.mustQuery("SELECT value FROM test")
+			if rows.Next() {
+				rows.Scan(&out)
+				if in != out {
+					ct.Errorf("%s ZEROFILL: %d != %d", v, in, out)
+				}
+			} else {
+				ct.Errorf("%s ZEROFILL: no data", v)
+			}
+			rows.Close()
+
+			ct.mustExec("DROP TABLE IF EXISTS test")
+		}
+	})
+}
+
+func TestTransaction(t *testing.T) {
+	runTests(t, dsn, func(ct *ConnTest) {
+		ct.mustExec("CREATE TABLE test (value INT) ENGINE=InnoDB")
+
+		// Rollback
+		tx, err := ct.conn.Begin()
+		if err != nil {
+			ct.Fatalf("Begin failed: %s", err.Error())
+		}
+		if _, err = tx.Exec("INSERT INTO test VALUES (?)", int64(1)); err != nil {
+			ct.Fatalf("Exec in transaction failed: %s", err.Error())
+		}
+		if err = tx.Rollback(); err != nil {
+			ct.Fatalf("Rollback failed: %s", err.Error())
+		}
+		rows := ct.mustQuery("SELECT value FROM test")
+		if rows.Next() {
+			ct.Error("unexpected data after rollback")
+		}
+		rows.Close()
+
+		// Commit
+		tx, err = ct.conn.Begin()
+		if err != nil {
+			ct.Fatalf("Begin failed: %s", err.Error())
+		}
+		if _, err = tx.Exec("INSERT INTO test VALUES (?)", int64(2)); err != nil {
+			ct.Fatalf("Exec in transaction failed: %s", err.Error())
+		}
+		if err = tx.Commit(); err != nil {
+			ct.Fatalf("Commit failed: %s", err.Error())
+		}
+		rows = ct.mustQuery("SELECT value FROM test")
+		if !rows.Next() {
+			ct.Error("no data after commit")
+		}
+		rows.Close()
+
+		// Finished transactions must not be reused
+		if err = tx.Commit(); err != ErrTxDone {
+			ct.Errorf("expected ErrTxDone on double commit, got %v", err)
+		}
+		if err = tx.Rollback(); err != ErrTxDone {
+			ct.Errorf("expected ErrTxDone on rollback after commit, got %v", err)
+		}
+		if _, err = tx.Exec("DO 1"); err != ErrTxDone {
+			ct.Errorf("expected ErrTxDone on Exec after commit, got %v", err)
+		}
+	})
+}
+
+func TestPing(t *testing.T) {
+	// closed connections must fail
+	conn := &Conn{}
+	if err := conn.Ping(); err != ErrInvalidConn {
+		t.Errorf("expected ErrInvalidConn, got %v", err)
+	}
+
+	runTests(t, dsn, func(ct *ConnTest) {
+		if err := ct.conn.Ping(); err != nil {
+			ct.Fatalf("Ping failed: %s", err.Error())
+		}
+	})
+}
+
+func TestOpenConfig(t *testing.T) {
+	if !available {
+		t.Skipf("MySQL-Server not running on %s", netAddr)
+	}
+
+	cfg, err := ParseDSN(dsn)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	conn, err := OpenConfig(cfg)
+	if err != nil {
+		t.Fatalf("Error connecting: %s", err.Error())
+	}
+	defer conn.Close()
+
+	if err = conn.Ping(); err != nil {
+		t.Errorf("Ping failed: %s", err.Error())
+	}
+}
+
+func TestUnknownCollation(t *testing.T) {
+	if !available {
+		t.Skipf("MySQL-Server not running on %s", netAddr)
+	}
+
+	// the server validates the collation
+	conn, err := Open(dsn + "&allowUnknownCollation=true&collation=utf8mb4_nonexistent_ci")
+	if err == nil {
+		conn.Close()
+		t.Fatal("expected error for a collation the server does not support")
+	}
+	if mysqlErr, ok := err.(*Error); !ok || mysqlErr.Number != 1273 {
+		t.Errorf("expected error 1273 (ER_UNKNOWN_COLLATION), got %v", err)
+	}
+}
+
+func TestQuoteIdentifierColumn(t *testing.T) {
+	runTests(t, dsn, func(ct *ConnTest) {
+		column := QuoteIdentifier("weird`name")
+		ct.mustExec("CREATE TABLE test (" + column + " INT)")
+		ct.mustExec("INSERT INTO test (" + column + ") VALUES (42)")
+
+		var value int
+		if err := ct.conn.QueryRow("SELECT " + column + " FROM test").Scan(&value); err != nil {
+			ct.Fatalf("QueryRow failed: %s", err.Error())
+		}
+		if value != 42 {
+			ct.Errorf("expected 42, got %d", value)
+		}
+	})
+}
+
+func TestQueryRow(t *testing.T) {
+	runTests(t, dsn, func(ct *ConnTest) {
+		ct.mustExec("CREATE TABLE test (id INT, value VARCHAR(255))")
+		ct.mustExec("INSERT INTO test VALUES (1, 'foo'), (2, 'bar')")
+
+		var out string
+		if err := ct.conn.QueryRow("SELECT value FROM test WHERE id = ?", int64(2)).Scan(&out); err != nil {
+			ct.Fatalf("QueryRow failed: %s", err.Error())
+		}
+		if out != "bar" {
+			ct.Errorf("expected %q, got %q", "bar", out)
+		}
+
+		// multiple rows, the rest is discarded
+		if err := ct.conn.QueryRow("SELECT value FROM test ORDER BY id").Scan(&out); err != nil {
+			ct.Fatalf("QueryRow failed: %s", err.Error())
+		}
+		if out != "foo" {
+			ct.Errorf("expected %q, got %q", "foo", out)
+		}
+
+		// no rows
+		if err := ct.conn.QueryRow("SELECT value FROM test WHERE id = 3").Scan(&out); err != ErrNoRows {
+			ct.Errorf("expected ErrNoRows, got %v", err)
+		}
+
+		// deferred query error
+		if err := ct.conn.QueryRow("SELECT value FROM does_not_exist").Scan(&out); err == nil {
+			ct.Error("expected error, got nil")
+		}
+	})
+}
+
+func TestMultiStatements(t *testing.T) {
+	runTests(t, dsn+"&multiStatements=true", func(ct *ConnTest) {
+		ct.mustExec("CREATE TABLE test (value INT)")
+
+		res := ct.mustExec("INSERT INTO test VALUES (1); SELECT * FROM test; INSERT INTO test VALUES (2), (3)")
+		count, err := res.RowsAffected()
+		if err != nil {
+			ct.Fatalf("res.RowsAffected() returned error: %s", err.Error())
+		}
+		if count != 2 {
+			ct.Errorf("expected 2 affected rows of the last statement, got %d", count)
+		}
+
+		var n int
+		if err = ct.conn.QueryRow("SELECT COUNT(*) FROM test").Scan(&n); err != nil {
+			ct.Fatalf("QueryRow failed: %s", err.Error())
+		}
+		if n != 3 {
+			ct.Errorf("expected 3 rows, got %d", n)
+		}
+	})
+}
+
+func TestMultiResultSets(t *testing.T) {
+	runTests(t, dsn+"&multiStatements=true", func(ct *ConnTest) {
+		rows := ct.mustQuery("SELECT 1; SELECT 2, 3; SELECT 4")
+		defer rows.Close()
+
+		var sets [][]int
+		for {
+			var set []int
+			for rows.Next() {
+				values := make([]int, len(rows.Columns()))
+				dest := make([]interface{}, len(values))
+				for i := range values {
+					dest[i] = &values[i]
+				}
+				if err := rows.Scan(dest...); err != nil {
+					ct.Fatalf("Scan failed: %s", err.Error())
+				}
+				set = append(set, values...)
+			}
+			sets = append(sets, set)
+			if !rows.NextResultSet() {
+				break
+			}
+		}
+
+		if got := fmt.Sprint(sets); got != "[[1] [2 3] [4]]" {
+			ct.Errorf("expected result sets [[1] [2 3] [4]], got %s", got)
+		}
+
+		// the connection must be usable after discarding unread result sets
+		rows = ct.mustQuery("SELECT 1; SELECT 2")
+		rows.Close()
+		var n int
+		if err := ct.conn.QueryRow("SELECT 5").Scan(&n); err != nil {
+			ct.Fatalf("QueryRow failed: %s", err.Error())
+		}
+		if n != 5 {
+			ct.Errorf("expected 5, got %d", n)
+		}
+	})
+}
+
+func TestStmtCache(t *testing.T) {
+	runTests(t, dsn+"&stmtCacheSize=1", func(ct *ConnTest) {
+		stmt1, err := ct.conn.Prepare("SELECT ?")
+		if err != nil {
+			ct.Fatalf("Prepare failed: %s", err.Error())
+		}
+		if err = stmt1.Close(); err != nil {
+			ct.Fatalf("Close failed: %s", err.Error())
+		}
+
+		// the cached statement is returned and still usable after Close
+		stmt2, err := ct.conn.Prepare("SELECT ?")
+		if err != nil {
+			ct.Fatalf("Prepare failed: %s", err.Error())
+		}
+		if stmt1 != stmt2 || stmt1.id != stmt2.id {
+			ct.Error("expected the cached statement to be reused")
+		}
+		if _, err = stmt2.Exec(int64(1)); err != nil {
+			ct.Fatalf("Exec failed: %s", err.Error())
+		}
+
+		// evicts the first statement
+		stmt3, err := ct.conn.Prepare("SELECT ?, ?")
+		if err != nil {
+			ct.Fatalf("Prepare failed: %s", err.Error())
+		}
+		if stmt3 == stmt1 {
+			ct.Error("expected a new statement")
+		}
+		if _, err = stmt1.Exec(int64(1)); err != ErrInvalidConn {
+			ct.Errorf("expected ErrInvalidConn for evicted statement, got %v", err)
+		}
+	})
+}
+
+func TestResetSession(t *testing.T) {
+	runTests(t, dsn, func(ct *ConnTest) {
+		ct.mustExec("SET @foo = 1")
+
+		if err := ct.conn.ResetSession(); err != nil {
+			if mysqlErr, ok := err.(*Error); ok && mysqlErr.Number == 1047 {
+				ct.Skip("COM_RESET_CONNECTION is not supported by the server")
+			}
+			ct.Fatalf("ResetSession failed: %s", err.Error())
+		}
+
+		var foo interface{}
+		if err := ct.conn.QueryRow("SELECT @foo").Scan(&foo); err != nil {
+			ct.Fatalf("QueryRow failed: %s", err.Error())
+		}
+		if foo != nil {
+			ct.Errorf("expected @foo to be unset after ResetSession, got %v", foo)
+		}
+	})
+}
+
+func TestUtf8mb4(t *testing.T) {
+	runTests(t, dsn, func(ct *ConnTest) {
+		ct.mustExec("CREATE TABLE test (value VARCHAR(32)) CHARACTER SET utf8mb4")
+
+		in := "foo \U0001F600 'bar'"
+		ct.mustExec("INSERT INTO test VALUES (?)", in) // interpolated
+
+		var out string
+		if err := ct.conn.QueryRow("SELECT value FROM test").Scan(&out); err != nil {
+			ct.Fatalf("QueryRow failed: %s", err.Error())
+		}
+		if out != in {
+			ct.Errorf("expected %q, got %q", in, out)
+		}
+	})
+}
+
+func TestInteractive(t *testing.T) {
+	runTests(t, dsn+"&interactive=true", func(ct *ConnTest) {
+		// the server initializes wait_timeout with interactive_timeout for
+		// interactive clients
+		var waitTimeout, interactiveTimeout int
+		err := ct.conn.QueryRow("SELECT @@session.wait_timeout, @@global.interactive_timeout").Scan(&waitTimeout, &interactiveTimeout)
+		if err != nil {
+			ct.Fatalf("QueryRow failed: %s", err.Error())
+		}
+		if waitTimeout != interactiveTimeout {
+			ct.Errorf("expected wait_timeout %d, got %d", interactiveTimeout, waitTimeout)
+		}
+	})
+}
+
+func TestExecPreparedFallback(t *testing.T) {
+	runTests(t, dsn, func(ct *ConnTest) {
+		ct.mustExec("CREATE TABLE test (value LONGTEXT)")
+
+		// too large to be interpolated, must be sent as long data
+		ct.conn.maxPacketAllowed = 1024
+		in := strings.Repeat("a", 2048)
+		res := ct.mustExec("INSERT INTO test VALUES (?)", in)
+		if n, err := res.RowsAffected(); err != nil || n != 1 {
+			ct.Fatalf("expected 1 affected row, got %d (%v)", n, err)
+		}
+
+		var out string
+		if err := ct.conn.QueryRow("SELECT value FROM test").Scan(&out); err != nil {
+			ct.Fatalf("QueryRow failed: %s", err.Error())
+		}
+		if out != in {
+			ct.Errorf("expected %d bytes, got %d", len(in), len(out))
+		}
+	})
+}
+
+func TestStmtQueryRow(t *testing.T) {
+	runTests(t, dsn, func(ct *ConnTest) {
+		ct.mustExec("CREATE TABLE test (id INT, value VARCHAR(10))")
+		ct.mustExec("INSERT INTO test VALUES (1, 'one'), (2, 'two')")
+
+		stmt, err := ct.conn.Prepare("SELECT value FROM test WHERE id = ?")
+		if err != nil {
+			ct.Fatalf("Prepare failed: %s", err.Error())
+		}
+		defer stmt.Close()
+
+		for i := 0; i < 2; i++ {
+			var value string
+			if err := stmt.QueryRow(2).Scan(&value); err != nil {
+				ct.Fatalf("QueryRow failed: %s", err.Error())
+			}
+			if value != "two" {
+				ct.Errorf("expected 'two', got %q", value)
+			}
+		}
+
+		var value string
+		if err := stmt.QueryRow(3).Scan(&value); err != ErrNoRows {
+			ct.Errorf("expected ErrNoRows, got %v", err)
+		}
+	})
+}
+
+func TestDecimal(t *testing.T) {
+	runTests(t, dsn, func(ct *ConnTest) {
+		ct.mustExec("CREATE TABLE test (value DECIMAL(30,10))")
+
+		in, err := ParseDecimal("12345678901234567890.1234567890")
+		if err != nil {
+			ct.Fatal(err)
+		}
+		ct.mustExec("INSERT INTO test VALUES (?)", in)
+
+		stmt, err := ct.conn.Prepare("SELECT value FROM test")
+		if err != nil {
+			ct.Fatalf("Prepare failed: %s", err.Error())
+		}
+		defer stmt.Close()
+
+		var txt, bin Decimal
+		if err := ct.conn.QueryRow("SELECT value FROM test").Scan(&txt); err != nil {
+			ct.Fatalf("QueryRow failed: %s", err.Error())
+		}
+		if err := stmt.QueryRow().Scan(&bin); err != nil {
+			ct.Fatalf("Stmt.QueryRow failed: %s", err.Error())
+		}
+		if txt != in || bin != in {
+			ct.Errorf("expected %s, got %s (text) and %s (binary)", in, txt, bin)
+		}
+	})
+}
+
+func TestJSON(t *testing.T) {
+	runTests(t, dsn, func(ct *ConnTest) {
+		if _, err := ct.conn.Exec("CREATE TABLE test (value JSON)"); err != nil {
+			ct.Skipf("JSON columns are not supported by the server: %s", err.Error())
+		}
+		ct.mustExec("INSERT INTO test VALUES (?)", json.RawMessage(`{"a": 1}`))
+
+		stmt, err := ct.conn.Prepare("SELECT value FROM test")
+		if err != nil {
+			ct.Fatalf("Prepare failed: %s", err.Error())
+		}
+		defer stmt.Close()
+
+		var txt, bin json.RawMessage
+		if err := ct.conn.QueryRow("SELECT value FROM test").Scan(&txt); err != nil {
+			ct.Fatalf("QueryRow failed: %s", err.Error())
+		}
+		if err := stmt.QueryRow().Scan(&bin); err != nil {
+			ct.Fatalf("Stmt.QueryRow failed: %s", err.Error())
+		}
+		if string(txt) != `{"a": 1}` || string(bin) != `{"a": 1}` {
+			ct.Errorf("expected %s, got %s (text) and %s (binary)", `{"a": 1}`, txt, bin)
+		}
+	})
+}
+
+func TestInterpolateParamsIn(t *testing.T) {
+	runTests(t, dsn, func(ct *ConnTest) {
+		ct.mustExec("CREATE TABLE test (id INT)")
+		ct.mustExec("INSERT INTO test VALUES (1), (2), (3), (4)")
+
+		var count int
+		if err := ct.conn.QueryRow("SELECT COUNT(*) FROM test WHERE id IN (?)", []int{1, 2, 3}).Scan(&count); err != nil {
+			ct.Fatalf("QueryRow failed: %s", err.Error())
+		}
+		if count != 3 {
+			ct.Errorf("expected 3, got %d", count)
+		}
+
+		if err := ct.conn.QueryRow("SELECT COUNT(*) FROM test WHERE id IN (?)", []int{}).Scan(&count); err != nil {
+			ct.Fatalf("QueryRow failed: %s", err.Error())
+		}
+		if count != 0 {
+			ct.Errorf("expected 0, got %d", count)
+		}
+	})
+}
+
+func TestNullStringArgs(t *testing.T) {
+	for _, params := range []string{"", "&interpolateParams=false"} {
+		runTests(t, dsn+params, func(ct *ConnTest) {
+			ct.mustExec("CREATE TABLE test (id INT, value VARCHAR(32))")
+			ct.mustExec("INSERT INTO test VALUES (?, ?), (?, ?)",
+				1, sql.NullString{}, 2, sql.NullString{String: "foo", Valid: true})
+
+			var value sql.NullString
+			if err := ct.conn.QueryRow("SELECT value FROM test WHERE id = 1").Scan(&value); err != nil {
+				ct.Fatalf("QueryRow failed: %s", err.Error())
+			}
+			if value.Valid {
+				ct.Errorf("%q: expected NULL, got %q", params, value.String)
+			}
+			if err := ct.conn.QueryRow("SELECT value FROM test WHERE id = 2").Scan(&value); err != nil {
+				ct.Fatalf("QueryRow failed: %s", err.Error())
+			}
+			if !value.Valid || value.String != "foo" {
+				ct.Errorf("%q: expected foo, got %q (valid %t)", params, value.String, value.Valid)
+			}
+		})
+	}
+}
+
+func TestNoInterpolateParams(t *testing.T) {
+	runTests(t, dsn+"&interpolateParams=false", func(ct *ConnTest) {
+		prepared := func() (n int) {
+			var name string
+			if err := ct.conn.QueryRow("SHOW SESSION STATUS LIKE 'Com_stmt_prepare'").Scan(&name, &n); err != nil {
+				ct.Fatalf("QueryRow failed: %s", err.Error())
+			}
+			return
+		}
+
+		ct.mustExec("CREATE TABLE test (value INT)")
+
+		before := prepared()
+		ct.mustExec("INSERT INTO test VALUES (?)", 42)
+
+		var value int
+		if err := ct.conn.QueryRow("SELECT value FROM test WHERE value = ?", 42).Scan(&value); err != nil {
+			ct.Fatalf("QueryRow failed: %s", err.Error())
+		}
+		if value != 42 {
+			ct.Errorf("expected 42, got %d", value)
+		}
+		if n := prepared() - before; n != 2 {
+			ct.Errorf("expected 2 prepared statements, got %d", n)
+		}
+	})
+}
+
+func TestQueryPrepared(t *testing.T) {
+	runTests(t, dsn, func(ct *ConnTest) {
+		prepared := func() (n int) {
+			var name string
+			if err := ct.conn.QueryRow("SHOW SESSION STATUS LIKE 'Com_stmt_prepare'").Scan(&name, &n); err != nil {
+				ct.Fatalf("QueryRow failed: %s", err.Error())
+			}
+			return
+		}
+
+		before := prepared()
+		for _, args := range [][]interface{}{{}, {41}} {
+			query := "SELECT 42"
+			if len(args) > 0 {
+				query = "SELECT ? + 1"
+			}
+			rows, err := ct.conn.QueryPrepared(query, args...)
+			if err != nil {
+				ct.Fatal(err)
+			}
+			if _, ok := rows.(*binaryRows); !ok {
+				ct.Errorf("%s: expected binary rows, got %T", query, rows)
+			}
+			var value int
+			if !rows.Next() {
+				ct.Fatalf("%s: no row: %v", query, rows.Err())
+			}
+			if err = rows.Scan(&value); err != nil {
+				ct.Fatal(err)
+			}
+			if value != 42 {
+				ct.Errorf("%s: expected 42, got %d", query, value)
+			}
+			if err = rows.Close(); err != nil {
+				ct.Fatal(err)
+			}
+		}
+		if n := prepared() - before; n != 2 {
+			ct.Errorf("expected 2 prepared statements, got %d", n)
+		}
+	})
+}
+
+func TestServerVersion(t *testing.T) {
+	runTests(t, dsn, func(ct *ConnTest) {
+		var version string
+		if err := ct.conn.QueryRow("SELECT VERSION()").Scan(&version); err != nil {
+			ct.Fatalf("QueryRow failed: %s", err.Error())
+		}
+		// MariaDB prefixes the handshake version with "5.5.5-"
+		if v := ct.conn.ServerVersion(); !strings.HasSuffix(v, version) {
+			ct.Errorf("expected server version %q, got %q", version, v)
+		}
+	})
+}
+
+func TestThreadID(t *testing.T) {
+	runTests(t, dsn, func(ct *ConnTest) {
+		var id uint32
+		if err := ct.conn.QueryRow("SELECT CONNECTION_ID()").Scan(&id); err != nil {
+			ct.Fatalf("QueryRow failed: %s", err.Error())
+		}
+		if tid := ct.conn.ThreadID(); tid != id {
+			ct.Errorf("expected thread id %d, got %d", id, tid)
+		}
+	})
+}
+
+func TestUint64Params(t *testing.T) {
+	runTests(t, dsn, func(ct *ConnTest) {
+		ct.mustExec("CREATE TABLE test (id INT, value BIGINT UNSIGNED)")
+
+		ct.mustExec("INSERT INTO test VALUES (1, ?)", uint64(math.MaxUint64))
+		ct.mustExec("INSERT INTO test VALUES (2, ?)", new(big.Int).SetUint64(math.MaxUint64))
+		stmt, err := ct.conn.Prepare("INSERT INTO test VALUES (3, ?)")
+		if err != nil {
+			ct.Fatal(err)
+		}
+		if _, err = stmt.Exec(uint64(math.MaxUint64)); err != nil {
+			ct.Fatal(err)
+		}
+		stmt.Close()
+
+		rows := ct.mustQuery("SELECT id, value FROM test ORDER BY id")
+		defer rows.Close()
+		n := 0
+		for rows.Next() {
+			var id int
+			var out uint64
+			if err := rows.Scan(&id, &out); err != nil {
+				ct.Fatal(err)
+			}
+			if out != math.MaxUint64 {
+				ct.Errorf("%d: expected %d, got %d", id, uint64(math.MaxUint64), out)
+			}
+			n++
+		}
+		if n != 3 {
+			ct.Errorf("expected 3 rows, got %d", n)
+		}
+	})
+}
+
+func TestDateTimeMicroseconds(t *testing.T) {
+	runTests(t, dsn+"&parseTime=true", func(ct *ConnTest) {
+		ct.mustExec("CREATE TABLE test (id INT, value DATETIME(6))")
+
+		in := time.Date(2011, 11, 20, 21, 27, 37, 1000, time.UTC)
+		ct.mustExec("INSERT INTO test VALUES (1, ?)", in)
+		stmt, err := ct.conn.Prepare("INSERT INTO test VALUES (2, ?)")
+		if err != nil {
+			ct.Fatal(err)
+		}
+		if _, err = stmt.Exec(in); err != nil {
+			ct.Fatal(err)
+		}
+		stmt.Close()
+
+		rows := ct.mustQuery("SELECT id, value FROM test ORDER BY id")
+		defer rows.Close()
+		for rows.Next() {
+			var id int
+			var out time.Time
+			if err := rows.Scan(&id, &out); err != nil {
+				ct.Fatal(err)
+			}
+			if !out.Equal(in) {
+				ct.Errorf("%d: expected %v, got %v", id, in, out)
+			}
+		}
+	})
+}
+
+func TestLazyConn(t *testing.T) {
+	if !available {
+		t.Skipf("MySQL-Server not running on %s", netAddr)
+	}
+
+	cfg, err := ParseDSN(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := NewLazyConn(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if conn.ThreadID() != 0 {
+		t.Error("expected no connection before the first command")
+	}
+
+	var value int
+	if err = conn.QueryRow("SELECT 1").Scan(&value); err != nil || value != 1 {
+		t.Fatalf("expected 1, got %d (%v)", value, err)
+	}
+	if conn.ThreadID() == 0 {
+		t.Error("expected a connection after the first command")
+	}
+}
+
+func TestStmtColumns(t *testing.T) {
+	runTests(t, dsn, func(ct *ConnTest) {
+		ct.mustExec("CREATE TABLE test (id INT NOT NULL, name VARCHAR(32))")
+
+		stmt, err := ct.conn.Prepare("SELECT id, name AS alias FROM test WHERE id = ?")
+		if err != nil {
+			ct.Fatal(err)
+		}
+		defer stmt.Close()
+		if columns := stmt.Columns(); len(columns) != 2 || columns[0] != "id" || columns[1] != "alias" {
+			ct.Errorf("unexpected columns %q", columns)
+		}
+		if types := stmt.ColumnTypes(); len(types) != 2 || types[0].DatabaseTypeName() != "INT" || types[0].Nullable() {
+			ct.Errorf("unexpected column types %v", types)
+		}
+
+		insert, err := ct.conn.Prepare("INSERT INTO test VALUES (?, ?)")
+		if err != nil {
+			ct.Fatal(err)
+		}
+		defer insert.Close()
+		if columns := insert.Columns(); columns != nil {
+			ct.Errorf("expected no columns, got %q", columns)
+		}
+	})
+}
+
+func TestDescribeQuery(t *testing.T) {
+	runTests(t, dsn, func(ct *ConnTest) {
+		ct.mustExec("CREATE TABLE test (id INT NOT NULL, name VARCHAR(32))")
+
+		types, err := ct.conn.DescribeQuery("SELECT id, name FROM test WHERE id = ?")
+		if err != nil {
+			ct.Fatal(err)
+		}
+		if len(types) != 2 || types[0].DatabaseTypeName() != "INT" || types[1].DatabaseTypeName() != "VARCHAR" {
+			ct.Errorf("unexpected column types %v", types)
+		}
+
+		// the query is not executed
+		if types, err = ct.conn.DescribeQuery("INSERT INTO test VALUES (1, 'a')"); err != nil || types != nil {
+			ct.Errorf("expected no column types, got %v (%v)", types, err)
+		}
+		var count int
+		if err = ct.conn.QueryRow("SELECT COUNT(*) FROM test").Scan(&count); err != nil || count != 0 {
+			ct.Errorf("expected no rows, got %d (%v)", count, err)
+		}
+	})
+}
+
+func TestAutoReconnect(t *testing.T) {
+	runTests(t, dsn+"&autoReconnect=true&wait_timeout=1", func(ct *ConnTest) {
+		threadID := ct.conn.ThreadID()
+
+		// the server closes the idle connection
+		time.Sleep(2 * time.Second)
+
+		var value int
+		if err := ct.conn.QueryRow("SELECT 1").Scan(&value); err != nil || value != 1 {
+			ct.Fatalf("expected 1, got %d (%v)", value, err)
+		}
+		if ct.conn.ThreadID() == threadID {
+			ct.Error("expected a new connection")
+		}
+	})
+}
+
+func TestInTransaction(t *testing.T) {
+	runTests(t, dsn, func(ct *ConnTest) {
+		ct.mustExec("CREATE TABLE test (value INT) ENGINE=InnoDB")
+		if ct.conn.InTransaction() {
+			ct.Error("expected no transaction")
+		}
+
+		ct.mustExec("BEGIN")
+		if !ct.conn.InTransaction() {
+			ct.Error("expected a transaction after BEGIN")
+		}
+		ct.mustExec("COMMIT")
+		if ct.conn.InTransaction() {
+			ct.Error("expected no transaction after COMMIT")
+		}
+
+		// implicitly started transaction
+		ct.mustExec("SET autocommit=0")
+		ct.mustExec("INSERT INTO test VALUES (1)")
+		if !ct.conn.InTransaction() {
+			ct.Error("expected a transaction with autocommit=0")
+		}
+		ct.mustExec("ROLLBACK")
+		if ct.conn.InTransaction() {
+			ct.Error("expected no transaction after ROLLBACK")
+		}
+		ct.mustExec("SET autocommit=1")
+	})
+}
+
+func TestSessionVar(t *testing.T) {
+	runTests(t, dsn, func(ct *ConnTest) {
+		var setTests = []struct {
+			name, value string
+		}{
+			{"group_concat_max_len", "4096"},
+			{"sql_mode", "ANSI_QUOTES"},
+			{"time_zone", "+01:00"},
+		}
+		for _, tst := range setTests {
+			if err := ct.conn.SetSessionVar(tst.name, tst.value); err != nil {
+				ct.Fatalf("%s: %v", tst.name, err)
+			}
+			value, err := ct.conn.GetSessionVar(tst.name)
+			if err != nil {
+				ct.Fatalf("%s: %v", tst.name, err)
+			}
+			if value != tst.value {
+				ct.Errorf("%s: expected %q, got %q", tst.name, tst.value, value)
+			}
+		}
+
+		if err := ct.conn.SetSessionVar("sql_mode=''; DO 1; SET a", "1"); err != errInvalidVarName {
+			ct.Errorf("expected errInvalidVarName, got %v", err)
+		}
+	})
+}
+
+func TestQueryRowMap(t *testing.T) {
+	runTests(t, dsn, func(ct *ConnTest) {
+		ct.mustExec("CREATE TABLE test (id INT, name VARCHAR(32))")
+		ct.mustExec("INSERT INTO test VALUES (1, 'foo'), (2, 'bar')")
+
+		m, err := ct.conn.QueryRowMap("SELECT * FROM test WHERE id=?", 1)
+		if err != nil {
+			ct.Fatal(err)
+		}
+		if len(m) != 2 || m["id"] != "1" || m["name"] != "foo" {
+			ct.Errorf("unexpected row %#v", m)
+		}
+
+		if _, err := ct.conn.QueryRowMap("SELECT * FROM test WHERE id=?", 3); err != ErrNoRows {
+			ct.Errorf("expected ErrNoRows, got %v", err)
+		}
+
+		// the connection must be usable again
+		ct.mustExec("DO 1")
+	})
+}
+
+func TestTimeDuration(t *testing.T) {
+	runTests(t, dsn, func(ct *ConnTest) {
+		query := "SELECT CAST('100:00:00' AS TIME), CAST('-12:34:56' AS TIME)"
+		stmt, err := ct.conn.Prepare(query)
+		if err != nil {
+			ct.Fatal(err)
+		}
+		defer stmt.Close()
+
+		for _, row := range []*Row{ct.conn.QueryRow(query), stmt.QueryRow()} {
+			var long, negative time.Duration
+			if err := row.Scan(&long, &negative); err != nil {
+				ct.Fatal(err)
+			}
+			if long != 100*time.Hour {
+				ct.Errorf("expected 100h, got %v", long)
+			}
+			if expected := -(12*time.Hour + 34*time.Minute + 56*time.Second); negative != expected {
+				ct.Errorf("expected %v, got %v", expected, negative)
+			}
+		}
+	})
+}
+
+func TestAutoLoc(t *testing.T) {
+	runTests(t, dsn+"&loc=Auto&parseTime=true&time_zone=%27%2B05%3A30%27", func(ct *ConnTest) {
+		if _, offset := time.Now().In(ct.conn.cfg.Loc).Zone(); offset != 5*3600+30*60 {
+			ct.Fatalf("expected offset +05:30, got %d", offset)
+		}
+
+		var t1 time.Time
+		if err := ct.conn.QueryRow("SELECT NOW()").Scan(&t1); err != nil {
+			ct.Fatal(err)
+		}
+		if d := time.Since(t1); d < -time.Minute || d > time.Minute {
+			ct.Errorf("expected NOW() to match the local time, got %v", t1)
+		}
+	})
+}
+
+func TestMaxAllowedPacketParam(t *testing.T) {
+	runTests(t, dsn+"&maxAllowedPacket=1024", func(ct *ConnTest) {
+		if ct.conn.maxPacketAllowed != 1023 {
+			ct.Errorf("expected maxPacketAllowed 1023, got %d", ct.conn.maxPacketAllowed)
+		}
+
+		// without interpolation the query is sent as is
+		query := "SELECT '" + strings.Repeat("a", 1024) + "'"
+		if _, err := ct.conn.Query(query); err != ErrPktTooLarge {
+			ct.Errorf("expected ErrPktTooLarge, got %v", err)
+		}
+		ct.mustExec("DO 1")
+	})
+}
+
+func TestStmtExecBatch(t *testing.T) {
+	argsList := make([][]interface{}, 10000)
+	for i := range argsList {
+		argsList[i] = []interface{}{i, fmt.Sprintf("row %d", i)}
+	}
+
+	for _, params := range []string{"", "&interpolateParams=false"} {
+		runTests(t, dsn+params, func(ct *ConnTest) {
+			ct.mustExec("CREATE TABLE test (id INT NOT NULL PRIMARY KEY, value VARCHAR(32))")
+
+			stmt, err := ct.conn.Prepare("INSERT INTO test VALUES (?, ?)")
+			if err != nil {
+				ct.Fatal(err)
+			}
+			defer stmt.Close()
+
+			before := ct.conn.Stats()
+			res, err := stmt.ExecBatch(argsList)
+			if err != nil {
+				ct.Fatalf("ExecBatch failed: %s", err.Error())
+			}
+			if n, _ := res.RowsAffected(); n != int64(len(argsList)) {
+				ct.Errorf("expected %d affected rows, got %d", len(argsList), n)
+			}
+			packets := ct.conn.Stats().PacketsWritten - before.PacketsWritten
+			if params == "" && packets > 10 {
+				ct.Errorf("expected few packets, got %d", packets)
+			}
+
+			var count int
+			var value string
+			if err := ct.conn.QueryRow("SELECT COUNT(*), MAX(value) FROM test").Scan(&count, &value); err != nil {
+				ct.Fatal(err)
+			}
+			if count != len(argsList) || value != "row 9999" {
+				ct.Errorf("expected %d rows up to row 9999, got %d up to %s", len(argsList), count, value)
+			}
+		})
+	}
+}
+
+func TestStmtIntegerParams(t *testing.T) {
+	runTests(t, dsn, func(ct *ConnTest) {
+		stmt, err := ct.conn.Prepare("SELECT ?")
+		if err != nil {
+			ct.Fatal(err)
+		}
+		defer stmt.Close()
+
+		for _, in := range []int64{5, -128, 127, -32769, 65535, 1 << 31, -1 << 40} {
+			var out int64
+			if err := stmt.QueryRow(in).Scan(&out); err != nil {
+				ct.Fatalf("%d: %s", in, err.Error())
+			}
+			if out != in {
+				ct.Errorf("expected %d, got %d", in, out)
+			}
+		}
+		for _, in := range []uint64{255, 256, 1<<32 - 1, 1<<64 - 1} {
+			var out uint64
+			if err := stmt.QueryRow(in).Scan(&out); err != nil {
+				ct.Fatalf("%d: %s", in, err.Error())
+			}
+			if out != in {
+				ct.Errorf("expected %d, got %d", in, out)
+			}
+		}
+	})
+}
+
+func TestChangeUser(t *testing.T) {
+	runTests(t, dsn, func(ct *ConnTest) {
+		ct.mustExec("SET @foo = 1")
+
+		stmt, err := ct.conn.Prepare("SELECT 1")
+		if err != nil {
+			ct.Fatal(err)
+		}
+
+		if err := ct.conn.ChangeUser(user, pass, "information_schema"); err != nil {
+			ct.Fatalf("ChangeUser failed: %s", err.Error())
+		}
+
+		var currentUser string
+		if err := ct.conn.QueryRow("SELECT CURRENT_USER()").Scan(&currentUser); err != nil {
+			ct.Fatal(err)
+		}
+		if !strings.HasPrefix(currentUser, user+"@") {
+			ct.Errorf("expected current user %s, got %s", user, currentUser)
+		}
+		if db := ct.conn.CurrentDatabase(); db != "information_schema" {
+			ct.Errorf("expected current database information_schema, got %s", db)
+		}
+
+		// the session must have been reset
+		var foo interface{}
+		if err := ct.conn.QueryRow("SELECT @foo").Scan(&foo); err != nil {
+			ct.Fatal(err)
+		}
+		if foo != nil {
+			ct.Errorf("expected @foo to be NULL, got %v", foo)
+		}
+		if _, err := stmt.Exec(); err == nil {
+			ct.Error("expected prepared statement to be closed")
+		}
+
+		// restore the database for the cleanup
+		if err := ct.conn.ChangeUser(user, pass, dbname); err != nil {
+			ct.Fatalf("ChangeUser failed: %s", err.Error())
+		}
 	})
 }
 
-func TestCRUD(t *testing.T) {
+func TestCurrentDatabase(t *testing.T) {
 	runTests(t, dsn, func(ct *ConnTest) {
-		// Create Table
-		ct.mustExec("CREATE TABLE test (value BOOL)")
+		if db := ct.conn.CurrentDatabase(); db != dbname {
+			ct.Fatalf("expected current database %s, got %s", dbname, db)
+		}
+		if ct.conn.flags&clientSessionTrack == 0 {
+			ct.Skip("server does not support session state tracking")
+		}
 
-		// Test for unexpected data
-		//var out bool
-		rows := ct.mustQuery("SELECT * FROM test")
-		if rows.Next() {
-			ct.Error("unexpected data in empty table")
+		ct.mustExec("USE information_schema")
+		if db := ct.conn.CurrentDatabase(); db != "information_schema" {
+			ct.Errorf("expected current database information_schema, got %s", db)
 		}
+	})
+}
 
-		// Create Data
-		res := ct.mustExec("INSERT INTO test VALUES (1)")
-		count, err := res.RowsAffected()
-		if err != nil {
-			ct.Fatalf("res.RowsAffected() returned error: %s", err.Error())
+func TestUseDatabase(t *testing.T) {
+	runTests(t, dsn, func(ct *ConnTest) {
+		if err := ct.conn.UseDatabase("information_schema"); err != nil {
+			ct.Fatal(err)
 		}
-		if count != 1 {
-			ct.Fatalf("Expected 1 affected row, got %d", count)
+		if db := ct.conn.CurrentDatabase(); db != "information_schema" {
+			ct.Errorf("expected current database information_schema, got %s", db)
+		}
+		var db string
+		if err := ct.conn.QueryRow("SELECT DATABASE()").Scan(&db); err != nil {
+			ct.Fatal(err)
+		}
+		if db != "information_schema" {
+			ct.Errorf("expected DATABASE() information_schema, got %s", db)
 		}
 
-		id, err := res.LastInsertID()
-		if err != nil {
-			ct.Fatalf("res.LastInsertId() returned error: %s", err.Error())
+		err := ct.conn.UseDatabase("gmysql_doesnotexist")
+		if mysqlErr, ok := err.(*Error); !ok || mysqlErr.Number != 1049 {
+			ct.Errorf("expected error 1049, got %v", err)
 		}
-		if id != 0 {
-			ct.Fatalf("Expected InsertID 0, got %d", id)
+		if db := ct.conn.CurrentDatabase(); db != "information_schema" {
+			ct.Errorf("expected current database information_schema, got %s", db)
 		}
+	})
+}
 
-		// Read
-		/*rows = ct.mustQuery("SELECT value FROM test")
-		err = rows.Next(&out) // TODO
-		if err != io.EOF {
-			if true != out {
-				ct.Fatalf("true != %t", out) // TODO Errorf
-			}
+func TestQueryWithMaxExecTime(t *testing.T) {
+	runTests(t, dsn, func(ct *ConnTest) {
+		if _, err := ct.conn.QueryWithMaxExecTime(100, "DO 1"); err != errMaxExecTimeNoSelect {
+			ct.Errorf("expected errMaxExecTimeNoSelect, got %v", err)
+		}
 
-			if rows.Next() != io.EOF {
-				ct.Error("unexpected data")
+		rows, err := ct.conn.QueryWithMaxExecTime(100, "SELECT BENCHMARK(1000000000, MD5(?))", "foo")
+		if err == nil {
+			for rows.Next() {
 			}
-		} else {
-			ct.Error("no data")
-		}*/
+			err = rows.Err()
+			rows.Close()
+		}
+		if mysqlErr, ok := err.(*Error); !ok || mysqlErr.Number != 3024 {
+			ct.Skipf("server does not support MAX_EXECUTION_TIME: %v", err)
+		}
 
-		// Update
-		res = ct.mustExec("UPDATE test SET value = ? WHERE value = ?", false, true)
-		count, err = res.RowsAffected()
+		// the connection must still be usable
+		var v int
+		if err := ct.conn.QueryRow("SELECT 1").Scan(&v); err != nil || v != 1 {
+			ct.Errorf("expected 1, got %d (%v)", v, err)
+		}
+	})
+}
+
+func TestConnStats(t *testing.T) {
+	runTests(t, dsn, func(ct *ConnTest) {
+		before := ct.conn.Stats()
+		if before.BytesRead == 0 || before.BytesWritten == 0 {
+			ct.Fatalf("expected the handshake to be counted, got %+v", before)
+		}
+
+		query := "SELECT 'foo'"
+		var v string
+		if err := ct.conn.QueryRow(query).Scan(&v); err != nil {
+			ct.Fatal(err)
+		}
+
+		after := ct.conn.Stats()
+		if written := after.BytesWritten - before.BytesWritten; written != uint64(4+1+len(query)) {
+			ct.Errorf("expected %d bytes written, got %d", 4+1+len(query), written)
+		}
+		if packets := after.PacketsWritten - before.PacketsWritten; packets != 1 {
+			ct.Errorf("expected 1 packet written, got %d", packets)
+		}
+		// header, column, EOF, row, EOF
+		if packets := after.PacketsRead - before.PacketsRead; packets != 5 {
+			ct.Errorf("expected 5 packets read, got %d", packets)
+		}
+	})
+}
+
+func TestKillQuery(t *testing.T) {
+	runTests(t, dsn, func(ct *ConnTest) {
+		watcher, err := Open(dsn)
 		if err != nil {
-			ct.Fatalf("res.RowsAffected() returned error: %s", err.Error())
+			ct.Fatalf("Error connecting: %s", err.Error())
 		}
-		if count != 1 {
-			ct.Fatalf("Expected 1 affected row, got %d", count)
+		defer watcher.Close()
+
+		done := make(chan error, 1)
+		go func() {
+			var v int
+			done <- ct.conn.QueryRow("SELECT BENCHMARK(1000000000, MD5('foo'))").Scan(&v)
+		}()
+
+		time.Sleep(100 * time.Millisecond)
+		if err := watcher.KillQuery(ct.conn.ThreadID()); err != nil {
+			ct.Fatalf("KillQuery failed: %s", err.Error())
 		}
 
-		// Check Update
-		/*rows = ct.mustQuery("SELECT value FROM test")
-		err = rows.Next(&out) // TODO
-		if err != io.EOF {
-			if false != out {
-				ct.Errorf("false != %t", out)
+		select {
+		case err := <-done:
+			if mysqlErr, ok := err.(*Error); !ok || mysqlErr.Number != 1317 {
+				ct.Errorf("expected error 1317, got %v", err)
 			}
+		case <-time.After(10 * time.Second):
+			ct.Fatal("query was not interrupted")
+		}
 
-			if rows.Next() != io.EOF {
-				ct.Error("unexpected data")
-			}
-		} else {
-			ct.Error("no data")
-		}*/
+		// the connection must still be usable
+		ct.mustExec("DO 1")
 
-		// Delete
-		res = ct.mustExec("DELETE FROM test WHERE value = ?", false)
-		count, err = res.RowsAffected()
-		if err != nil {
-			ct.Fatalf("res.RowsAffected() returned error: %s", err.Error())
+		if err := watcher.KillConnection(ct.conn.ThreadID()); err != nil {
+			ct.Fatalf("KillConnection failed: %s", err.Error())
 		}
-		if count != 1 {
-			ct.Fatalf("Expected 1 affected row, got %d", count)
+		if err := ct.conn.Ping(); err == nil {
+			ct.Error("expected Ping to fail after KillConnection")
 		}
+	})
+}
 
-		// Check for unexpected rows
-		res = ct.mustExec("DELETE FROM test")
-		count, err = res.RowsAffected()
+func TestStatistics(t *testing.T) {
+	runTests(t, dsn, func(ct *ConnTest) {
+		stats, err := ct.conn.Statistics()
 		if err != nil {
-			ct.Fatalf("res.RowsAffected() returned error: %s", err.Error())
+			ct.Fatalf("Statistics failed: %s", err.Error())
 		}
-		if count != 0 {
-			ct.Fatalf("Expected 0 affected row, got %d", count)
+		if !strings.HasPrefix(stats, "Uptime: ") {
+			ct.Errorf("unexpected statistics: %q", stats)
 		}
+
+		// the connection must still be usable
+		ct.mustExec("DO 1")
 	})
 }
 
-/*
-func TestInt(t *testing.T) {
+func TestUnsignedParams(t *testing.T) {
 	runTests(t, dsn, func(ct *ConnTest) {
-		types := [5]string{"TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT"}
-		in := int64(42)
-		var out int64
-		var rows Rows
+		ct.mustExec("CREATE TABLE test (value BIGINT UNSIGNED)")
 
-		// SIGNED
-		for _, v := range types {
-			ct.mustExec("CREATE TABLE test (value " + v + ")")
+		// interpolated
+		ct.mustExec("INSERT INTO test VALUES (?)", uint64(math.MaxUint64))
 
-			ct.mustExec("INSERT INTO test VALUES (?)", in)
+		// prepared statement
+		stmt, err := ct.conn.Prepare("INSERT INTO test VALUES (?)")
+		if err != nil {
+			ct.Fatalf("Prepare failed: %s", err.Error())
+		}
+		if _, err = stmt.Exec(uint64(math.MaxUint64)); err != nil {
+			ct.Fatalf("Exec failed: %s", err.Error())
+		}
+		stmt.Close()
 
-			rows = ct.mustQuery("SELECT value FROM test")
-			if rows.Next() {
-				rows.Scan(&out)
-				if in != out {
-					ct.Errorf("%s: %d != %d", v, in, out)
-				}
-			} else {
-				ct.Errorf("%s: no data", v)
+		rows := ct.mustQuery("SELECT value FROM test")
+		defer rows.Close()
+		var n int
+		for rows.Next() {
+			var out uint64
+			if err = rows.Scan(&out); err != nil {
+				ct.Fatalf("Scan failed: %s", err.Error())
 			}
+			if out != math.MaxUint64 {
+				ct.Errorf("expected %d, got %d", uint64(math.MaxUint64), out)
+			}
+			n++
+		}
+		if n != 2 {
+			ct.Errorf("expected 2 rows, got %d", n)
+		}
+	})
+}
 
-			ct.mustExec("DROP TABLE IF EXISTS test")
+func TestExecInfile(t *testing.T) {
+	runTests(t, dsn, func(ct *ConnTest) {
+		ct.mustExec("CREATE TABLE test (id INT NOT NULL PRIMARY KEY, value TEXT NOT NULL) CHARACTER SET utf8")
+
+		// a reader of unknown length
+		r := io.MultiReader(
+			strings.NewReader("1\ta string\n"),
+			strings.NewReader("2\ta string containing a \\t\n"),
+		)
+		res, err := ct.conn.ExecInfile("LOAD DATA LOCAL INFILE 'data' INTO TABLE test", r)
+		if err != nil {
+			ct.Fatalf("ExecInfile failed: %s", err.Error())
+		}
+		if count, _ := res.RowsAffected(); count != 2 {
+			ct.Errorf("expected 2 affected rows, got %d", count)
 		}
 
-		// UNSIGNED ZEROFILL
-		for _, v := range types {
-			ct.mustExec("CREATE TABLE test (value " + v + " ZEROFILL)")
+		var value string
+		if err = ct.conn.QueryRow("SELECT value FROM test WHERE id = 2").Scan(&value); err != nil {
+			ct.Fatalf("QueryRow failed: %s", err.Error())
+		}
+		if value != "a string containing a \t" {
+			ct.Errorf("expected %q, got %q", "a string containing a \t", value)
+		}
 
-			ct.mustExec("INSERT INTO test VALUES (?)", in)
+		// the reader is only used for this one call
+		if _, err = ct.conn.Exec("LOAD DATA LOCAL INFILE 'data' INTO TABLE test"); err == nil {
+			ct.Error("expected error for unregistered file, got nil")
+		}
+	})
+}
 
-			rows = ct.mustQuery("SELECT value FROM test")
-			if rows.Next() {
-				rows.Scan(&out)
-				if in != out {
-					ct.Errorf("%s ZEROFILL: %d != %d", v, in, out)
-				}
-			} else {
-				ct.Errorf("%s ZEROFILL: no data", v)
-			}
+func TestResultWarnings(t *testing.T) {
+	runTests(t, dsn+"&strict=false&sql_mode=''", func(ct *ConnTest) {
+		ct.mustExec("CREATE TABLE test (value TINYINT)")
 
-			ct.mustExec("DROP TABLE IF EXISTS test")
+		res := ct.mustExec("INSERT INTO test VALUES (1), (1000), (-1000)")
+		if n := res.Warnings(); n != 2 {
+			ct.Errorf("expected 2 warnings, got %d", n)
+		}
+
+		res = ct.mustExec("INSERT INTO test VALUES (1)")
+		if n := res.Warnings(); n != 0 {
+			ct.Errorf("expected no warnings, got %d", n)
+		}
+	})
+}
+
+func TestExecStrict(t *testing.T) {
+	runTests(t, dsn+"&strict=false&sql_mode=''", func(ct *ConnTest) {
+		ct.mustExec("CREATE TABLE test (value TINYINT)")
+
+		_, err := ct.conn.ExecStrict("INSERT INTO test VALUES (1000)")
+		if _, ok := err.(Warnings); !ok {
+			ct.Errorf("expected Warnings, got %#v", err)
+		}
+
+		// the rest of the session is not strict
+		res := ct.mustExec("INSERT INTO test VALUES (1000)")
+		if n := res.Warnings(); n != 1 {
+			ct.Errorf("expected 1 warning, got %d", n)
+		}
+
+		if _, err = ct.conn.ExecStrict("INSERT INTO test VALUES (?)", 1); err != nil {
+			ct.Errorf("expected no error, got %v", err)
+		}
+	})
+}
+
+func TestStrictResult(t *testing.T) {
+	runTests(t, dsn+"&sql_mode=''", func(ct *ConnTest) {
+		ct.mustExec("CREATE TABLE test (id INT NOT NULL AUTO_INCREMENT PRIMARY KEY, value TINYINT)")
+
+		res, err := ct.conn.Exec("INSERT INTO test (value) VALUES (1), (1000)")
+		if warnings, ok := err.(Warnings); !ok || len(warnings) != 1 {
+			ct.Errorf("expected 1 warning, got %#v", err)
+		}
+		if n, _ := res.RowsAffected(); n != 2 {
+			ct.Errorf("expected 2 affected rows, got %d", n)
+		}
+		if id, _ := res.LastInsertID(); id != 1 {
+			ct.Errorf("expected insert id 1, got %d", id)
+		}
+
+		stmt, err := ct.conn.Prepare("INSERT INTO test (value) VALUES (?)")
+		if err != nil {
+			ct.Fatal(err)
+		}
+		defer stmt.Close()
+		sres, err := stmt.Exec(1000)
+		if _, ok := err.(Warnings); !ok {
+			ct.Errorf("expected Warnings, got %#v", err)
+		}
+		if sres == nil {
+			ct.Fatal("expected a Result")
+		}
+		if n, _ := sres.RowsAffected(); n != 1 {
+			ct.Errorf("expected 1 affected row, got %d", n)
+		}
+
+		// the batch is completed, the warnings are returned at the end
+		bres, err := stmt.ExecBatch([][]interface{}{{1000}, {1}, {1000}})
+		if warnings, ok := err.(Warnings); !ok || len(warnings) != 2 {
+			ct.Errorf("expected 2 warnings, got %#v", err)
+		}
+		if bres == nil {
+			ct.Fatal("expected a Result")
+		}
+		if n, _ := bres.RowsAffected(); n != 3 {
+			ct.Errorf("expected 3 affected rows, got %d", n)
+		}
+	})
+}
+
+func TestResultInfo(t *testing.T) {
+	runTests(t, dsn, func(ct *ConnTest) {
+		ct.mustExec("CREATE TABLE test (id INT NOT NULL PRIMARY KEY, value INT)")
+
+		res := ct.mustExec("INSERT INTO test VALUES (1, 1), (2, 2), (3, 3)")
+		if info := res.Info(); info != "Records: 3  Duplicates: 0  Warnings: 0" {
+			ct.Errorf("unexpected info %q", info)
+		}
+
+		res = ct.mustExec("UPDATE test SET value = 1 WHERE id <= 2")
+		if info := res.Info(); info != "Rows matched: 2  Changed: 1  Warnings: 0" {
+			ct.Errorf("unexpected info %q", info)
+		}
+
+		// single-row statements have no info
+		res = ct.mustExec("DELETE FROM test WHERE id = 3")
+		if info := res.Info(); info != "" {
+			ct.Errorf("expected no info, got %q", info)
 		}
 	})
 }
 
+func TestReuseClosedConnection(t *testing.T) {
+	if !available {
+		t.Skipf("MySQL-Server not running on %s", netAddr)
+	}
+
+	conn, err := Open(dsn)
+	if err != nil {
+		t.Fatalf("Error connecting: %s", err.Error())
+	}
+	stmt, err := conn.Prepare("DO 1")
+	if err != nil {
+		t.Fatalf("Error preparing statement: %s", err.Error())
+	}
+	if _, err = stmt.Exec(); err != nil {
+		t.Fatalf("Error executing statement: %s", err.Error())
+	}
+	if err = conn.Close(); err != nil {
+		t.Fatalf("Error closing connection: %s", err.Error())
+	}
+
+	defer func() {
+		if err := recover(); err != nil {
+			t.Errorf("Panic after reusing a closed connection: %v", err)
+		}
+	}()
+	if _, err = stmt.Exec(); err != ErrInvalidConn {
+		t.Errorf("Exec: expected ErrInvalidConn, got %v", err)
+	}
+	if _, err = stmt.Query(); err != ErrInvalidConn {
+		t.Errorf("Query: expected ErrInvalidConn, got %v", err)
+	}
+}
+
+/*
 func TestFloat(t *testing.T) {
 	runTests(t, dsn, func(ct *ConnTest) {
 		types := [2]string{"FLOAT", "DOUBLE"}
@@ -1011,7 +2332,7 @@ func TestStrict(t *testing.T) {
 	if conn != nil {
 		conn.Close()
 	}
-	if me, ok := err.(*MySQLError); ok && me.Number == 1231 {
+	if me, ok := err.(*Error); ok && me.Number == 1231 {
 		// Error 1231: Variable 'sql_mode' can't be set to the value of 'ALLOW_INVALID_DATES'
 		// => skip test, MySQL server version is too old
 		return
@@ -1033,7 +2354,7 @@ func TestStrict(t *testing.T) {
 				ct.Errorf("Expected STRICT error on query [%s] %s", mode, queries[idx].in)
 			}
 
-			if warnings, ok := err.(MySQLWarnings); ok {
+			if warnings, ok := err.(Warnings); ok {
 				var codes = make([]string, len(warnings))
 				for i := range warnings {
 					codes[i] = warnings[i].Code
@@ -1113,42 +2434,6 @@ func TestTLS(t *testing.T) {
 	runTests(t, dsn+"&tls=custom-skip-verify", tlsTest)
 }
 
-func TestReuseClosedConnection(t *testing.T) {
-	// this test does not use sql.database, it uses the driver directly
-	if !available {
-		t.Skipf("MySQL-Server not running on %s", netAddr)
-	}
-
-	md := &MySQLDriver{}
-	conn, err := md.Open(dsn)
-	if err != nil {
-		t.Fatalf("Error connecting: %s", err.Error())
-	}
-	stmt, err := conn.Prepare("DO 1")
-	if err != nil {
-		t.Fatalf("Error preparing statement: %s", err.Error())
-	}
-	_, err = stmt.Exec(nil)
-	if err != nil {
-		t.Fatalf("Error executing statement: %s", err.Error())
-	}
-	err = conn.Close()
-	if err != nil {
-		t.Fatalf("Error closing connection: %s", err.Error())
-	}
-
-	defer func() {
-		if err := recover(); err != nil {
-			t.Errorf("Panic after reusing a closed connection: %v", err)
-		}
-	}()
-	_, err = stmt.Exec(nil)
-	if err != nil && err != driver.ErrBadConn {
-		t.Errorf("Unexpected error '%s', expected '%s'",
-			err.Error(), driver.ErrBadConn.Error())
-	}
-}
-
 func TestCharset(t *testing.T) {
 	if !available {
 		t.Skipf("MySQL-Server not running on %s", netAddr)
@@ -1199,7 +2484,7 @@ func TestCollation(t *testing.T) {
 		t.Skipf("MySQL-Server not running on %s", netAddr)
 	}
 
-	defaultCollation := "utf8_general_ci"
+	defaultCollation := "utf8mb4_general_ci"
 	testCollations := []string{
 		"",               // do not set
 		defaultCollation, // driver default
@@ -9,11 +9,14 @@
 package gmysql
 
 import (
+	"bytes"
 	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
 	"net/url"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -23,31 +26,245 @@ var (
 	errInvalidDSNAddr            = errors.New("invalid DSN: Network Address not terminated (missing closing brace)")
 	errInvalidDSNNoSlash         = errors.New("invalid DSN: Missing the slash separating the database name")
 	errInvalidDSNUnsafeCollation = errors.New("invalid DSN: interpolateParams can be used with ascii, latin1, utf8 and utf8mb4 charset")
+	errInvalidDSNUnsafeCharset   = errors.New("invalid DSN: multiStatements can not be used with the big5, cp932, gb2312, gbk and sjis charsets")
 )
 
 // Config is a configuration parsed from a DSN string
 type Config struct {
-	User         string            // Username
-	Passwd       string            // Password
-	Net          string            // Network type
-	Addr         string            // Network address
-	DBName       string            // Database name
-	Params       map[string]string // Connection parameters
-	Loc          *time.Location    // Location for time.Time values
-	TLS          *tls.Config       // TLS configuration
-	Timeout      time.Duration     // Dial timeout
-	ReadTimeout  time.Duration     // I/O read timeout
-	WriteTimeout time.Duration     // I/O write timeout
-	Collation    uint8             // Connection collation
+	User                 string            // Username
+	Passwd               string            // Password
+	Net                  string            // Network type
+	Addr                 string            // Network address
+	DBName               string            // Database name
+	Params               map[string]string // Connection parameters
+	Loc                  *time.Location    // Location for time.Time values
+	TLS                  *tls.Config       // TLS configuration
+	TLSServerName        string            // Server name to verify the TLS certificate against
+	TLSPreferred         bool              // Fall back to an unencrypted connection if the server does not support TLS
+	Timeout              time.Duration     // Dial timeout
+	ReadTimeout          time.Duration     // I/O read timeout
+	WriteTimeout         time.Duration     // I/O write timeout
+	KeepAlive            time.Duration     // TCP keepalive period
+	SlowThreshold        time.Duration     // Log queries running longer than this
+	Collation            uint8             // Connection collation
+	UnknownCollation     string            // Collation not known to the driver, set after connecting
+	Hooks                Hooks             // Called around the execution of queries
+	MaxAllowedPacket     int               // Max packet size allowed by the server, 0 queries it
+	StmtCacheSize        int               // Number of cached prepared statements
+	ZeroDateTimeBehavior string            // Handling of zero time.Time args: "" (or "zero"), "null" or "error"
 
 	AllowAllFiles           bool // Allow all files to be used with LOAD DATA LOCAL INFILE
 	AllowCleartextPasswords bool // Allows the cleartext client side plugin
 	AllowOldPasswords       bool // Allows the old insecure password method
+	AllowUnknownCollation   bool // Let the server validate collations not known to the driver
+	AutoLoc                 bool // Set Loc to the time zone of the server when connecting
+	AutoReconnect           bool // Reconnect and retry Query once if the server closed the connection
+	AutoReconnectWrites     bool // Retry other queries than reads too with AutoReconnect
 	ClientFoundRows         bool // Return number of matching rows instead of rows changed
 	ColumnsWithAlias        bool // Prepend table alias to column names
+	Compress                bool // Compress packets
+	Interactive             bool // Use interactive_timeout instead of wait_timeout
+	MultiStatements         bool // Allow multiple statements in one query
+	NoInterpolateParams     bool // Use prepared statements for query args
+	ParseTime               bool // Parse time values to time.Time
+	RejectReadOnly          bool // Close the connection on read-only errors
 	Strict                  bool // Return warnings as errors
 }
 
+// FormatDSN formats the given Config into a DSN string which can be passed to
+// ParseDSN. Parameters with default values are omitted.
+func (cfg *Config) FormatDSN() string {
+	var buf bytes.Buffer
+
+	// [username[:password]@]
+	if len(cfg.User) > 0 || len(cfg.Passwd) > 0 {
+		buf.WriteString(cfg.User)
+		if len(cfg.Passwd) > 0 {
+			buf.WriteByte(':')
+			buf.WriteString(cfg.Passwd)
+		}
+		buf.WriteByte('@')
+	}
+
+	// [protocol[(address)]]
+	if len(cfg.Net) > 0 {
+		buf.WriteString(cfg.Net)
+		if len(cfg.Addr) > 0 {
+			buf.WriteByte('(')
+			buf.WriteString(cfg.Addr)
+			buf.WriteByte(')')
+		}
+	}
+
+	// /dbname
+	buf.WriteByte('/')
+	buf.WriteString(cfg.DBName)
+
+	// [?param1=value1&...&paramN=valueN]
+	hasParam := false
+	writeParam := func(key, value string) {
+		if hasParam {
+			buf.WriteByte('&')
+		} else {
+			hasParam = true
+			buf.WriteByte('?')
+		}
+		buf.WriteString(key)
+		buf.WriteByte('=')
+		buf.WriteString(value)
+	}
+
+	if cfg.AllowAllFiles {
+		writeParam("allowAllFiles", "true")
+	}
+
+	if cfg.AllowCleartextPasswords {
+		writeParam("allowCleartextPasswords", "true")
+	}
+
+	if cfg.AllowOldPasswords {
+		writeParam("allowOldPasswords", "true")
+	}
+
+	if cfg.AllowUnknownCollation {
+		writeParam("allowUnknownCollation", "true")
+	}
+
+	if cfg.AutoReconnect {
+		writeParam("autoReconnect", "true")
+	}
+
+	if cfg.AutoReconnectWrites {
+		writeParam("autoReconnectWrites", "true")
+	}
+
+	if cfg.ClientFoundRows {
+		writeParam("clientFoundRows", "true")
+	}
+
+	if cfg.UnknownCollation != "" {
+		writeParam("collation", cfg.UnknownCollation)
+	} else if cfg.Collation != defaultCollation {
+		for name, collation := range collations {
+			if collation == cfg.Collation {
+				writeParam("collation", name)
+				break
+			}
+		}
+	}
+
+	if cfg.ColumnsWithAlias {
+		writeParam("columnsWithAlias", "true")
+	}
+
+	if cfg.Compress {
+		writeParam("compress", "true")
+	}
+
+	if cfg.Interactive {
+		writeParam("interactive", "true")
+	}
+
+	if cfg.NoInterpolateParams {
+		writeParam("interpolateParams", "false")
+	}
+
+	if cfg.KeepAlive > 0 {
+		writeParam("keepalive", cfg.KeepAlive.String())
+	}
+
+	if cfg.AutoLoc {
+		writeParam("loc", "Auto")
+	} else if cfg.Loc != nil && cfg.Loc != time.UTC {
+		writeParam("loc", url.QueryEscape(cfg.Loc.String()))
+	}
+
+	if cfg.MaxAllowedPacket > 0 {
+		writeParam("maxAllowedPacket", strconv.Itoa(cfg.MaxAllowedPacket))
+	}
+
+	if cfg.MultiStatements {
+		writeParam("multiStatements", "true")
+	}
+
+	if cfg.ParseTime {
+		writeParam("parseTime", "true")
+	}
+
+	if cfg.ReadTimeout > 0 {
+		writeParam("readTimeout", cfg.ReadTimeout.String())
+	}
+
+	if cfg.RejectReadOnly {
+		writeParam("rejectReadOnly", "true")
+	}
+
+	if cfg.SlowThreshold > 0 {
+		writeParam("slowThreshold", cfg.SlowThreshold.String())
+	}
+
+	if cfg.StmtCacheSize > 0 {
+		writeParam("stmtCacheSize", strconv.Itoa(cfg.StmtCacheSize))
+	}
+
+	if cfg.Strict {
+		writeParam("strict", "true")
+	}
+
+	if cfg.Timeout > 0 {
+		writeParam("timeout", cfg.Timeout.String())
+	}
+
+	if cfg.TLS != nil {
+		writeParam("tls", url.QueryEscape(cfg.tlsConfigName()))
+	}
+
+	if cfg.TLSServerName != "" {
+		writeParam("tlsServerName", url.QueryEscape(cfg.TLSServerName))
+	}
+
+	if cfg.WriteTimeout > 0 {
+		writeParam("writeTimeout", cfg.WriteTimeout.String())
+	}
+
+	if cfg.ZeroDateTimeBehavior != "" && cfg.ZeroDateTimeBehavior != "zero" {
+		writeParam("zeroDateTimeBehavior", cfg.ZeroDateTimeBehavior)
+	}
+
+	// other params, sorted to get a deterministic output
+	if cfg.Params != nil {
+		keys := make([]string, 0, len(cfg.Params))
+		for k := range cfg.Params {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			writeParam(k, url.QueryEscape(cfg.Params[k]))
+		}
+	}
+
+	return buf.String()
+}
+
+// tlsConfigName returns the value of the tls param for the TLS config, which
+// is either the name under which it was registered, "preferred",
+// "skip-verify" or "true".
+func (cfg *Config) tlsConfigName() string {
+	if cfg.TLSPreferred {
+		return "preferred"
+	}
+	for name, tlsConfig := range tlsConfigRegister {
+		if tlsConfig == cfg.TLS {
+			return name
+		}
+	}
+	if cfg.TLS.InsecureSkipVerify {
+		return "skip-verify"
+	}
+	return "true"
+}
+
 // ParseDSN parses the DSN string to a Config
 func ParseDSN(dsn string) (cfg *Config, err error) {
 	// New config with some default values
@@ -122,8 +339,39 @@ func ParseDSN(dsn string) (cfg *Config, err error) {
 		return nil, errInvalidDSNNoSlash
 	}
 
-	if unsafeCollations[cfg.Collation] { // TODO
-		return nil, errInvalidDSNUnsafeCollation
+	if err = cfg.normalize(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// normalize validates the Config and sets default values for unset fields
+func (cfg *Config) normalize() error {
+	if cfg.Loc == nil {
+		cfg.Loc = time.UTC
+	}
+
+	if cfg.Collation == 0 {
+		cfg.Collation = defaultCollation
+	}
+
+	if cfg.UnknownCollation != "" && (!cfg.AllowUnknownCollation || !isVarName(cfg.UnknownCollation)) {
+		return errors.New("unknown collation")
+	}
+
+	if !cfg.NoInterpolateParams {
+		if unsafeCollations[cfg.Collation] || unsafeCharsets[collationCharset(cfg.UnknownCollation)] {
+			return errInvalidDSNUnsafeCollation
+		}
+
+		// Interpolated parameters must not be able to inject further statements
+		if cfg.MultiStatements {
+			for _, charset := range strings.Split(cfg.Params["charset"], ",") {
+				if unsafeCharsets[charset] {
+					return errInvalidDSNUnsafeCharset
+				}
+			}
+		}
 	}
 
 	// Set default network if empty
@@ -139,12 +387,12 @@ func ParseDSN(dsn string) (cfg *Config, err error) {
 		case "unix":
 			cfg.Addr = "/tmp/mysql.sock"
 		default:
-			return nil, errors.New("Default addr for network '" + cfg.Net + "' unknown")
+			return errors.New("Default addr for network '" + cfg.Net + "' unknown")
 		}
 
 	}
 
-	return
+	return nil
 }
 
 // parseDSNParams parses the DSN "query string"
@@ -183,6 +431,30 @@ func parseDSNParams(cfg *Config, params string) (err error) {
 				return fmt.Errorf("Invalid Bool value: %s", value)
 			}
 
+		// Let the server validate unknown collations
+		case "allowUnknownCollation":
+			var isBool bool
+			cfg.AllowUnknownCollation, isBool = readBool(value)
+			if !isBool {
+				return fmt.Errorf("Invalid Bool value: %s", value)
+			}
+
+		// Reconnect if the server closed the connection
+		case "autoReconnect":
+			var isBool bool
+			cfg.AutoReconnect, isBool = readBool(value)
+			if !isBool {
+				return fmt.Errorf("Invalid Bool value: %s", value)
+			}
+
+		// Retry writes too on a reconnect
+		case "autoReconnectWrites":
+			var isBool bool
+			cfg.AutoReconnectWrites, isBool = readBool(value)
+			if !isBool {
+				return fmt.Errorf("Invalid Bool value: %s", value)
+			}
+
 		// Switch "rowsAffected" mode
 		case "clientFoundRows":
 			var isBool bool
@@ -198,10 +470,13 @@ func parseDSNParams(cfg *Config, params string) (err error) {
 				// Note possibility for false negatives:
 				// could be triggered  although the collation is valid if the
 				// collations map does not contain entries the server supports.
-				err = errors.New("unknown collation")
-				return
+				// With allowUnknownCollation=true, which may follow in the DSN,
+				// the server validates it instead, see normalize.
+				cfg.UnknownCollation = value
+				break
 			}
 			cfg.Collation = collation
+			cfg.UnknownCollation = ""
 			break
 
 		case "columnsWithAlias":
@@ -213,18 +488,75 @@ func parseDSNParams(cfg *Config, params string) (err error) {
 
 		// Compression
 		case "compress":
-			return errors.New("Compression not implemented yet")
+			var isBool bool
+			cfg.Compress, isBool = readBool(value)
+			if !isBool {
+				return fmt.Errorf("Invalid Bool value: %s", value)
+			}
+
+		// Interactive client
+		case "interactive":
+			var isBool bool
+			cfg.Interactive, isBool = readBool(value)
+			if !isBool {
+				return fmt.Errorf("Invalid Bool value: %s", value)
+			}
+
+		// Client-side interpolation of query args
+		case "interpolateParams":
+			interpolate, isBool := readBool(value)
+			if !isBool {
+				return fmt.Errorf("Invalid Bool value: %s", value)
+			}
+			cfg.NoInterpolateParams = !interpolate
+
+		// TCP keepalive period
+		case "keepalive":
+			cfg.KeepAlive, err = time.ParseDuration(value)
+			if err != nil {
+				return
+			}
+
+		// Max packet size allowed by the server
+		case "maxAllowedPacket":
+			cfg.MaxAllowedPacket, err = strconv.Atoi(value)
+			if err != nil || cfg.MaxAllowedPacket < 0 {
+				return fmt.Errorf("Invalid value for maxAllowedPacket: %s", value)
+			}
+
+		// multiple statements in one query
+		case "multiStatements":
+			var isBool bool
+			cfg.MultiStatements, isBool = readBool(value)
+			if !isBool {
+				return fmt.Errorf("Invalid Bool value: %s", value)
+			}
 
 		// Time Location
 		case "loc":
 			if value, err = url.QueryUnescape(value); err != nil {
 				return
 			}
+			if value == "Auto" {
+				// detected from the server's time zone when connecting
+				cfg.AutoLoc = true
+				cfg.Loc = nil
+				break
+			}
+			cfg.AutoLoc = false
 			cfg.Loc, err = time.LoadLocation(value)
 			if err != nil {
 				return
 			}
 
+		// time.Time parsing
+		case "parseTime":
+			var isBool bool
+			cfg.ParseTime, isBool = readBool(value)
+			if !isBool {
+				return fmt.Errorf("Invalid Bool value: %s", value)
+			}
+
 		// I/O Read Timeout
 		case "readTimeout":
 			cfg.ReadTimeout, err = time.ParseDuration(value)
@@ -232,6 +564,28 @@ func parseDSNParams(cfg *Config, params string) (err error) {
 				return
 			}
 
+		// Close the connection on read-only errors
+		case "rejectReadOnly":
+			var isBool bool
+			cfg.RejectReadOnly, isBool = readBool(value)
+			if !isBool {
+				return fmt.Errorf("Invalid Bool value: %s", value)
+			}
+
+		// Slow query log
+		case "slowThreshold":
+			cfg.SlowThreshold, err = time.ParseDuration(value)
+			if err != nil {
+				return
+			}
+
+		// Prepared statement cache
+		case "stmtCacheSize":
+			cfg.StmtCacheSize, err = strconv.Atoi(value)
+			if err != nil || cfg.StmtCacheSize < 0 {
+				return fmt.Errorf("Invalid value for stmtCacheSize: %s", value)
+			}
+
 		// Strict mode
 		case "strict":
 			var isBool bool
@@ -249,6 +603,7 @@ func parseDSNParams(cfg *Config, params string) (err error) {
 
 		// TLS-Encryption
 		case "tls":
+			cfg.TLSPreferred = false
 			boolValue, isBool := readBool(value)
 			if isBool {
 				if boolValue {
@@ -259,6 +614,10 @@ func parseDSNParams(cfg *Config, params string) (err error) {
 			} else {
 				if strings.ToLower(value) == "skip-verify" {
 					cfg.TLS = &tls.Config{InsecureSkipVerify: true}
+				} else if strings.ToLower(value) == "preferred" {
+					// opportunistic encryption, the certificate is not verified
+					cfg.TLS = &tls.Config{InsecureSkipVerify: true}
+					cfg.TLSPreferred = true
 				} else if tlsConfig, ok := tlsConfigRegister[value]; ok {
 					if len(tlsConfig.ServerName) == 0 && !tlsConfig.InsecureSkipVerify {
 						host, _, err := net.SplitHostPort(cfg.Addr)
@@ -273,6 +632,12 @@ func parseDSNParams(cfg *Config, params string) (err error) {
 				}
 			}
 
+		// Server name for the verification of the TLS certificate
+		case "tlsServerName":
+			if cfg.TLSServerName, err = url.QueryUnescape(value); err != nil {
+				return
+			}
+
 		// I/O Write Timeout
 		case "writeTimeout":
 			cfg.WriteTimeout, err = time.ParseDuration(value)
@@ -280,6 +645,17 @@ func parseDSNParams(cfg *Config, params string) (err error) {
 				return
 			}
 
+		// Handling of zero time.Time args
+		case "zeroDateTimeBehavior":
+			switch value {
+			case "zero":
+				cfg.ZeroDateTimeBehavior = ""
+			case "null", "error":
+				cfg.ZeroDateTimeBehavior = value
+			default:
+				return fmt.Errorf("Invalid value for zeroDateTimeBehavior: %s", value)
+			}
+
 		default:
 			// lazy init
 			if cfg.Params == nil {
@@ -12,26 +12,28 @@ import (
 	"crypto/tls"
 	//"fmt"
 	"net/url"
+	"reflect"
 	"testing"
+	"time"
 )
 
 var testDSNs = []struct {
 	in  string
 	out string
 }{
-	{"username:password@protocol(address)/dbname?param=value", "&{User:username Passwd:password Net:protocol Addr:address DBName:dbname Params:map[param:value] Loc:UTC TLS:<nil> Timeout:0 Collation:33 AllowAllFiles:false AllowCleartextPasswords:false AllowOldPasswords:false ClientFoundRows:false ColumnsWithAlias:false InterpolateParams:false ParseTime:false Strict:false}"},
-	{"username:password@protocol(address)/dbname?param=value&columnsWithAlias=true", "&{User:username Passwd:password Net:protocol Addr:address DBName:dbname Params:map[param:value] Loc:UTC TLS:<nil> Timeout:0 Collation:33 AllowAllFiles:false AllowCleartextPasswords:false AllowOldPasswords:false ClientFoundRows:false ColumnsWithAlias:true InterpolateParams:false ParseTime:false Strict:false}"},
-	{"user@unix(/path/to/socket)/dbname?charset=utf8", "&{User:user Passwd: Net:unix Addr:/path/to/socket DBName:dbname Params:map[charset:utf8] Loc:UTC TLS:<nil> Timeout:0 Collation:33 AllowAllFiles:false AllowCleartextPasswords:false AllowOldPasswords:false ClientFoundRows:false ColumnsWithAlias:false InterpolateParams:false ParseTime:false Strict:false}"},
-	{"user:password@tcp(localhost:5555)/dbname?charset=utf8&tls=true", "&{User:user Passwd:password Net:tcp Addr:localhost:5555 DBName:dbname Params:map[charset:utf8] Loc:UTC TLS:<nil> Timeout:0 Collation:33 AllowAllFiles:false AllowCleartextPasswords:false AllowOldPasswords:false ClientFoundRows:false ColumnsWithAlias:false InterpolateParams:false ParseTime:false Strict:false}"},
-	{"user:password@tcp(localhost:5555)/dbname?charset=utf8mb4,utf8&tls=skip-verify", "&{User:user Passwd:password Net:tcp Addr:localhost:5555 DBName:dbname Params:map[charset:utf8mb4,utf8] Loc:UTC TLS:<nil> Timeout:0 Collation:33 AllowAllFiles:false AllowCleartextPasswords:false AllowOldPasswords:false ClientFoundRows:false ColumnsWithAlias:false InterpolateParams:false ParseTime:false Strict:false}"},
+	{"username:password@protocol(address)/dbname?param=value", "&{User:username Passwd:password Net:protocol Addr:address DBName:dbname Params:map[param:value] Loc:UTC TLS:<nil> Timeout:0 Collation:45 AllowAllFiles:false AllowCleartextPasswords:false AllowOldPasswords:false ClientFoundRows:false ColumnsWithAlias:false InterpolateParams:false ParseTime:false Strict:false}"},
+	{"username:password@protocol(address)/dbname?param=value&columnsWithAlias=true", "&{User:username Passwd:password Net:protocol Addr:address DBName:dbname Params:map[param:value] Loc:UTC TLS:<nil> Timeout:0 Collation:45 AllowAllFiles:false AllowCleartextPasswords:false AllowOldPasswords:false ClientFoundRows:false ColumnsWithAlias:true InterpolateParams:false ParseTime:false Strict:false}"},
+	{"user@unix(/path/to/socket)/dbname?charset=utf8", "&{User:user Passwd: Net:unix Addr:/path/to/socket DBName:dbname Params:map[charset:utf8] Loc:UTC TLS:<nil> Timeout:0 Collation:45 AllowAllFiles:false AllowCleartextPasswords:false AllowOldPasswords:false ClientFoundRows:false ColumnsWithAlias:false InterpolateParams:false ParseTime:false Strict:false}"},
+	{"user:password@tcp(localhost:5555)/dbname?charset=utf8&tls=true", "&{User:user Passwd:password Net:tcp Addr:localhost:5555 DBName:dbname Params:map[charset:utf8] Loc:UTC TLS:<nil> Timeout:0 Collation:45 AllowAllFiles:false AllowCleartextPasswords:false AllowOldPasswords:false ClientFoundRows:false ColumnsWithAlias:false InterpolateParams:false ParseTime:false Strict:false}"},
+	{"user:password@tcp(localhost:5555)/dbname?charset=utf8mb4,utf8&tls=skip-verify", "&{User:user Passwd:password Net:tcp Addr:localhost:5555 DBName:dbname Params:map[charset:utf8mb4,utf8] Loc:UTC TLS:<nil> Timeout:0 Collation:45 AllowAllFiles:false AllowCleartextPasswords:false AllowOldPasswords:false ClientFoundRows:false ColumnsWithAlias:false InterpolateParams:false ParseTime:false Strict:false}"},
 	{"user:password@/dbname?loc=UTC&timeout=30s&allowAllFiles=1&clientFoundRows=true&allowOldPasswords=TRUE&collation=utf8mb4_unicode_ci", "&{User:user Passwd:password Net:tcp Addr:127.0.0.1:3306 DBName:dbname Params:map[] Loc:UTC TLS:<nil> Timeout:30s Collation:224 AllowAllFiles:true AllowCleartextPasswords:false AllowOldPasswords:true ClientFoundRows:true ColumnsWithAlias:false InterpolateParams:false ParseTime:false Strict:false}"},
-	{"user:p@ss(word)@tcp([de:ad:be:ef::ca:fe]:80)/dbname?loc=Local", "&{User:user Passwd:p@ss(word) Net:tcp Addr:[de:ad:be:ef::ca:fe]:80 DBName:dbname Params:map[] Loc:Local TLS:<nil> Timeout:0 Collation:33 AllowAllFiles:false AllowCleartextPasswords:false AllowOldPasswords:false ClientFoundRows:false ColumnsWithAlias:false InterpolateParams:false ParseTime:false Strict:false}"},
-	{"/dbname", "&{User: Passwd: Net:tcp Addr:127.0.0.1:3306 DBName:dbname Params:map[] Loc:UTC TLS:<nil> Timeout:0 Collation:33 AllowAllFiles:false AllowCleartextPasswords:false AllowOldPasswords:false ClientFoundRows:false ColumnsWithAlias:false InterpolateParams:false ParseTime:false Strict:false}"},
-	{"@/", "&{User: Passwd: Net:tcp Addr:127.0.0.1:3306 DBName: Params:map[] Loc:UTC TLS:<nil> Timeout:0 Collation:33 AllowAllFiles:false AllowCleartextPasswords:false AllowOldPasswords:false ClientFoundRows:false ColumnsWithAlias:false InterpolateParams:false ParseTime:false Strict:false}"},
-	{"/", "&{User: Passwd: Net:tcp Addr:127.0.0.1:3306 DBName: Params:map[] Loc:UTC TLS:<nil> Timeout:0 Collation:33 AllowAllFiles:false AllowCleartextPasswords:false AllowOldPasswords:false ClientFoundRows:false ColumnsWithAlias:false InterpolateParams:false ParseTime:false Strict:false}"},
-	{"", "&{User: Passwd: Net:tcp Addr:127.0.0.1:3306 DBName: Params:map[] Loc:UTC TLS:<nil> Timeout:0 Collation:33 AllowAllFiles:false AllowCleartextPasswords:false AllowOldPasswords:false ClientFoundRows:false ColumnsWithAlias:false InterpolateParams:false ParseTime:false Strict:false}"},
-	{"user:p@/ssword@/", "&{User:user Passwd:p@/ssword Net:tcp Addr:127.0.0.1:3306 DBName: Params:map[] Loc:UTC TLS:<nil> Timeout:0 Collation:33 AllowAllFiles:false AllowCleartextPasswords:false AllowOldPasswords:false ClientFoundRows:false ColumnsWithAlias:false InterpolateParams:false ParseTime:false Strict:false}"},
-	{"unix/?arg=%2Fsome%2Fpath.ext", "&{User: Passwd: Net:unix Addr:/tmp/mysql.sock DBName: Params:map[arg:/some/path.ext] Loc:UTC TLS:<nil> Timeout:0 Collation:33 AllowAllFiles:false AllowCleartextPasswords:false AllowOldPasswords:false ClientFoundRows:false ColumnsWithAlias:false InterpolateParams:false ParseTime:false Strict:false}"},
+	{"user:p@ss(word)@tcp([de:ad:be:ef::ca:fe]:80)/dbname?loc=Local", "&{User:user Passwd:p@ss(word) Net:tcp Addr:[de:ad:be:ef::ca:fe]:80 DBName:dbname Params:map[] Loc:Local TLS:<nil> Timeout:0 Collation:45 AllowAllFiles:false AllowCleartextPasswords:false AllowOldPasswords:false ClientFoundRows:false ColumnsWithAlias:false InterpolateParams:false ParseTime:false Strict:false}"},
+	{"/dbname", "&{User: Passwd: Net:tcp Addr:127.0.0.1:3306 DBName:dbname Params:map[] Loc:UTC TLS:<nil> Timeout:0 Collation:45 AllowAllFiles:false AllowCleartextPasswords:false AllowOldPasswords:false ClientFoundRows:false ColumnsWithAlias:false InterpolateParams:false ParseTime:false Strict:false}"},
+	{"@/", "&{User: Passwd: Net:tcp Addr:127.0.0.1:3306 DBName: Params:map[] Loc:UTC TLS:<nil> Timeout:0 Collation:45 AllowAllFiles:false AllowCleartextPasswords:false AllowOldPasswords:false ClientFoundRows:false ColumnsWithAlias:false InterpolateParams:false ParseTime:false Strict:false}"},
+	{"/", "&{User: Passwd: Net:tcp Addr:127.0.0.1:3306 DBName: Params:map[] Loc:UTC TLS:<nil> Timeout:0 Collation:45 AllowAllFiles:false AllowCleartextPasswords:false AllowOldPasswords:false ClientFoundRows:false ColumnsWithAlias:false InterpolateParams:false ParseTime:false Strict:false}"},
+	{"", "&{User: Passwd: Net:tcp Addr:127.0.0.1:3306 DBName: Params:map[] Loc:UTC TLS:<nil> Timeout:0 Collation:45 AllowAllFiles:false AllowCleartextPasswords:false AllowOldPasswords:false ClientFoundRows:false ColumnsWithAlias:false InterpolateParams:false ParseTime:false Strict:false}"},
+	{"user:p@/ssword@/", "&{User:user Passwd:p@/ssword Net:tcp Addr:127.0.0.1:3306 DBName: Params:map[] Loc:UTC TLS:<nil> Timeout:0 Collation:45 AllowAllFiles:false AllowCleartextPasswords:false AllowOldPasswords:false ClientFoundRows:false ColumnsWithAlias:false InterpolateParams:false ParseTime:false Strict:false}"},
+	{"unix/?arg=%2Fsome%2Fpath.ext", "&{User: Passwd: Net:unix Addr:/tmp/mysql.sock DBName: Params:map[arg:/some/path.ext] Loc:UTC TLS:<nil> Timeout:0 Collation:45 AllowAllFiles:false AllowCleartextPasswords:false AllowOldPasswords:false ClientFoundRows:false ColumnsWithAlias:false InterpolateParams:false ParseTime:false Strict:false}"},
 }
 
 /*func TestDSNParser(t *testing.T) {
@@ -55,6 +57,217 @@ var testDSNs = []struct {
 	}
 }*/
 
+func TestDSNFormatRoundtrip(t *testing.T) {
+	for i, tst := range testDSNs {
+		cfg1, err := ParseDSN(tst.in)
+		if err != nil {
+			t.Errorf("%d. ParseDSN(%q) failed: %s", i, tst.in, err.Error())
+			continue
+		}
+
+		dsn := cfg1.FormatDSN()
+		cfg2, err := ParseDSN(dsn)
+		if err != nil {
+			t.Errorf("%d. ParseDSN(%q) of formatted DSN failed: %s", i, dsn, err.Error())
+			continue
+		}
+
+		if !reflect.DeepEqual(cfg1, cfg2) {
+			t.Errorf("%d. %q formatted as %q does not round-trip:\n%#v\n%#v", i, tst.in, dsn, cfg1, cfg2)
+		}
+	}
+}
+
+func TestDSNFormat(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone data not available: %s", err.Error())
+	}
+
+	cfg := &Config{
+		User:        "user",
+		Passwd:      "p@ss/word?",
+		Net:         "tcp",
+		Addr:        "localhost:3306",
+		DBName:      "dbname",
+		Params:      map[string]string{"charset": "utf8mb4,utf8", "time_zone": "'+00:00'"},
+		Loc:         loc,
+		TLS:         &tls.Config{InsecureSkipVerify: true},
+		Timeout:     30 * time.Second,
+		KeepAlive:   time.Minute,
+		Collation:   collations["utf8mb4_unicode_ci"],
+		Interactive: true,
+		Strict:      true,
+	}
+
+	expected := "user:p@ss/word?@tcp(localhost:3306)/dbname?collation=utf8mb4_unicode_ci&interactive=true&keepalive=1m0s&loc=Europe%2FBerlin&strict=true&timeout=30s&tls=skip-verify&charset=utf8mb4%2Cutf8&time_zone=%27%2B00%3A00%27"
+	if dsn := cfg.FormatDSN(); dsn != expected {
+		t.Fatalf("expected %q, got %q", expected, dsn)
+	}
+
+	parsed, err := ParseDSN(expected)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !reflect.DeepEqual(cfg, parsed) {
+		t.Errorf("expected %#v, got %#v", cfg, parsed)
+	}
+}
+
+func TestConfigNormalize(t *testing.T) {
+	cfg := &Config{User: "user", Passwd: "p@ss/word?", DBName: "dbname"}
+	if err := cfg.normalize(); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected, err := ParseDSN("user:p@ss/word?@/dbname")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Errorf("expected %#v, got %#v", expected, cfg)
+	}
+
+	cfg = &Config{MultiStatements: true, Params: map[string]string{"charset": "gbk"}}
+	if err := cfg.normalize(); err != errInvalidDSNUnsafeCharset {
+		t.Errorf("expected %v, got %v", errInvalidDSNUnsafeCharset, err)
+	}
+}
+
+func TestDSNStmtCacheSize(t *testing.T) {
+	cfg, err := ParseDSN("/dbname?stmtCacheSize=16")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if cfg.StmtCacheSize != 16 {
+		t.Errorf("expected StmtCacheSize 16, got %d", cfg.StmtCacheSize)
+	}
+	if dsn := cfg.FormatDSN(); dsn != "tcp(127.0.0.1:3306)/dbname?stmtCacheSize=16" {
+		t.Errorf("unexpected formatted DSN %q", dsn)
+	}
+
+	for _, v := range []string{"-1", "foo"} {
+		if _, err = ParseDSN("/dbname?stmtCacheSize=" + v); err == nil {
+			t.Errorf("expected error for stmtCacheSize=%s", v)
+		}
+	}
+}
+
+func TestDSNRejectReadOnly(t *testing.T) {
+	cfg, err := ParseDSN("/dbname?rejectReadOnly=true&readTimeout=1s")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !cfg.RejectReadOnly {
+		t.Error("expected RejectReadOnly to be set")
+	}
+	if dsn := cfg.FormatDSN(); dsn != "tcp(127.0.0.1:3306)/dbname?readTimeout=1s&rejectReadOnly=true" {
+		t.Errorf("unexpected formatted DSN %q", dsn)
+	}
+}
+
+func TestDSNAutoReconnect(t *testing.T) {
+	cfg, err := ParseDSN("/dbname?autoReconnectWrites=true&autoReconnect=true")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !cfg.AutoReconnect || !cfg.AutoReconnectWrites {
+		t.Error("expected AutoReconnect and AutoReconnectWrites to be set")
+	}
+	if dsn := cfg.FormatDSN(); dsn != "tcp(127.0.0.1:3306)/dbname?autoReconnect=true&autoReconnectWrites=true" {
+		t.Errorf("unexpected formatted DSN %q", dsn)
+	}
+	if _, err = ParseDSN("/dbname?autoReconnectWrites=maybe"); err == nil {
+		t.Error("expected error for autoReconnectWrites=maybe")
+	}
+}
+
+func TestDSNSlowThreshold(t *testing.T) {
+	cfg, err := ParseDSN("/dbname?slowThreshold=1.5s")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if cfg.SlowThreshold != 1500*time.Millisecond {
+		t.Errorf("expected SlowThreshold 1.5s, got %v", cfg.SlowThreshold)
+	}
+	if dsn := cfg.FormatDSN(); dsn != "tcp(127.0.0.1:3306)/dbname?slowThreshold=1.5s" {
+		t.Errorf("unexpected formatted DSN %q", dsn)
+	}
+
+	if _, err = ParseDSN("/dbname?slowThreshold=foo"); err == nil {
+		t.Error("expected error for slowThreshold=foo")
+	}
+}
+
+func TestDSNZeroDateTimeBehavior(t *testing.T) {
+	cfg, err := ParseDSN("/dbname?zeroDateTimeBehavior=null")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if cfg.ZeroDateTimeBehavior != "null" {
+		t.Errorf("expected ZeroDateTimeBehavior null, got %q", cfg.ZeroDateTimeBehavior)
+	}
+	if dsn := cfg.FormatDSN(); dsn != "tcp(127.0.0.1:3306)/dbname?zeroDateTimeBehavior=null" {
+		t.Errorf("unexpected formatted DSN %q", dsn)
+	}
+
+	// the default is omitted
+	if cfg, err = ParseDSN("/dbname?zeroDateTimeBehavior=zero"); err != nil {
+		t.Fatal(err.Error())
+	}
+	if dsn := cfg.FormatDSN(); dsn != "tcp(127.0.0.1:3306)/dbname" {
+		t.Errorf("unexpected formatted DSN %q", dsn)
+	}
+
+	if _, err = ParseDSN("/dbname?zeroDateTimeBehavior=foo"); err == nil {
+		t.Error("expected error for zeroDateTimeBehavior=foo")
+	}
+}
+
+func TestDSNAutoLoc(t *testing.T) {
+	cfg, err := ParseDSN("/dbname?loc=Auto")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !cfg.AutoLoc {
+		t.Error("expected AutoLoc to be set")
+	}
+	if cfg.Loc != time.UTC {
+		t.Errorf("expected UTC until connected, got %v", cfg.Loc)
+	}
+	if dsn := cfg.FormatDSN(); dsn != "tcp(127.0.0.1:3306)/dbname?loc=Auto" {
+		t.Errorf("unexpected formatted DSN %q", dsn)
+	}
+
+	// the last value wins
+	cfg, err = ParseDSN("/dbname?loc=Auto&loc=Local")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if cfg.AutoLoc || cfg.Loc != time.Local {
+		t.Errorf("expected Local, got %v (AutoLoc %t)", cfg.Loc, cfg.AutoLoc)
+	}
+}
+
+func TestDSNMaxAllowedPacket(t *testing.T) {
+	cfg, err := ParseDSN("/dbname?maxAllowedPacket=4194304")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if cfg.MaxAllowedPacket != 4194304 {
+		t.Errorf("expected MaxAllowedPacket 4194304, got %d", cfg.MaxAllowedPacket)
+	}
+	if dsn := cfg.FormatDSN(); dsn != "tcp(127.0.0.1:3306)/dbname?maxAllowedPacket=4194304" {
+		t.Errorf("unexpected formatted DSN %q", dsn)
+	}
+
+	for _, v := range []string{"-1", "foo"} {
+		if _, err = ParseDSN("/dbname?maxAllowedPacket=" + v); err == nil {
+			t.Errorf("expected error for maxAllowedPacket=%s", v)
+		}
+	}
+}
+
 func TestDSNParserInvalid(t *testing.T) {
 	var invalidDSNs = []string{
 		"@net(addr/",                  // no closing brace
@@ -130,6 +343,108 @@ func TestDSNWithCustomTLS_queryEscape(t *testing.T) {
 	}
 }
 
+func TestDSNTLSServerName(t *testing.T) {
+	dsn := "User:password@tcp(10.0.0.5:3306)/dbname?tls=true&tlsServerName=db.internal"
+	cfg, err := ParseDSN(dsn)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if cfg.TLSServerName != "db.internal" {
+		t.Errorf("expected TLSServerName %q, got %q", "db.internal", cfg.TLSServerName)
+	}
+	if cfg.TLS.ServerName != "" {
+		t.Errorf("expected the TLS config to be left alone, got ServerName %q", cfg.TLS.ServerName)
+	}
+
+	expected := "User:password@tcp(10.0.0.5:3306)/dbname?tls=true&tlsServerName=db.internal"
+	if formatted := cfg.FormatDSN(); formatted != expected {
+		t.Errorf("expected %q, got %q", expected, formatted)
+	}
+}
+
+func TestDSNTLSPreferred(t *testing.T) {
+	cfg, err := ParseDSN("/dbname?tls=preferred")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !cfg.TLSPreferred || cfg.TLS == nil || !cfg.TLS.InsecureSkipVerify {
+		t.Errorf("unexpected TLS settings: preferred %v, config %+v", cfg.TLSPreferred, cfg.TLS)
+	}
+
+	expected := "tcp(127.0.0.1:3306)/dbname?tls=preferred"
+	if dsn := cfg.FormatDSN(); dsn != expected {
+		t.Errorf("expected %q, got %q", expected, dsn)
+	}
+
+	if err = RegisterTLSConfig("preferred", &tls.Config{}); err == nil {
+		t.Error("expected error for reserved key")
+	}
+}
+
+func TestDSNAllowUnknownCollation(t *testing.T) {
+	if _, err := ParseDSN("/dbname?collation=utf8mb4_0900_ai_ci"); err == nil {
+		t.Error("expected error for unknown collation")
+	}
+
+	// the order of the params does not matter
+	cfg, err := ParseDSN("/dbname?collation=utf8mb4_0900_ai_ci&allowUnknownCollation=true")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if cfg.UnknownCollation != "utf8mb4_0900_ai_ci" || cfg.Collation != defaultCollation {
+		t.Errorf("unexpected collation %q (%d)", cfg.UnknownCollation, cfg.Collation)
+	}
+
+	expected := "tcp(127.0.0.1:3306)/dbname?allowUnknownCollation=true&collation=utf8mb4_0900_ai_ci"
+	if dsn := cfg.FormatDSN(); dsn != expected {
+		t.Errorf("expected %q, got %q", expected, dsn)
+	}
+
+	// known collations are not affected
+	cfg, err = ParseDSN("/dbname?allowUnknownCollation=true&collation=utf8mb4_unicode_ci")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if cfg.UnknownCollation != "" || cfg.Collation != collations["utf8mb4_unicode_ci"] {
+		t.Errorf("unexpected collation %q (%d)", cfg.UnknownCollation, cfg.Collation)
+	}
+
+	if _, err = ParseDSN("/dbname?allowUnknownCollation=true&collation=gbk_new_ci"); err != errInvalidDSNUnsafeCollation {
+		t.Errorf("expected %v, got %v", errInvalidDSNUnsafeCollation, err)
+	}
+	if _, err = ParseDSN("/dbname?allowUnknownCollation=true&collation=utf8mb4_bin%3BDO%201"); err == nil {
+		t.Error("expected error for invalid collation name")
+	}
+}
+
+func TestDSNInterpolateParams(t *testing.T) {
+	cfg, err := ParseDSN("/dbname")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if cfg.NoInterpolateParams {
+		t.Error("expected interpolation to be enabled by default")
+	}
+
+	// unsafe collations are allowed without interpolation
+	cfg, err = ParseDSN("/dbname?interpolateParams=false&collation=gbk_chinese_ci")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !cfg.NoInterpolateParams {
+		t.Error("expected interpolation to be disabled")
+	}
+
+	expected := "tcp(127.0.0.1:3306)/dbname?collation=gbk_chinese_ci&interpolateParams=false"
+	if dsn := cfg.FormatDSN(); dsn != expected {
+		t.Errorf("expected %q, got %q", expected, dsn)
+	}
+
+	if _, err = ParseDSN("/dbname?interpolateParams=maybe"); err == nil {
+		t.Error("expected error for invalid bool value")
+	}
+}
+
 func TestDSNUnsafeCollation(t *testing.T) {
 	_, err := ParseDSN("/dbname?collation=gbk_chinese_ci")
 	if err != errInvalidDSNUnsafeCollation {
@@ -157,6 +472,25 @@ func TestDSNUnsafeCollation(t *testing.T) {
 	}
 }
 
+func TestDSNUnsafeMultiStatements(t *testing.T) {
+	_, err := ParseDSN("/dbname?multiStatements=true&charset=utf8,gbk")
+	if err != errInvalidDSNUnsafeCharset {
+		t.Errorf("expected %v, got %v", errInvalidDSNUnsafeCharset, err)
+	}
+
+	cfg, err := ParseDSN("/dbname?multiStatements=true&charset=utf8mb4,utf8")
+	if err != nil {
+		t.Errorf("expected %v, got %v", nil, err)
+	} else if !cfg.MultiStatements {
+		t.Error("expected MultiStatements to be set")
+	}
+
+	_, err = ParseDSN("/dbname?charset=gbk")
+	if err != nil {
+		t.Errorf("expected %v, got %v", nil, err)
+	}
+}
+
 func BenchmarkParseDSN(b *testing.B) {
 	b.ReportAllocs()
 
@@ -16,8 +16,18 @@ import (
 )
 
 // Various errors the driver might return. Can change between driver versions.
+//
+// ErrBadConn is returned if the connection broke during a command, e.g. because
+// of a network error or because the packet sequence got out of sync. The
+// connection is closed then and the command may be retried on a new one.
+// If the packet sequence got out of sync, an error naming the last command is
+// returned instead, for which errors.Is(err, ErrBadConn) reports true.
+// ErrIncompleteResult is returned by Rows.Close if the connection broke before
+// the end of the result was received, i.e. rows may be missing.
+// Errors sent by the server are always returned as *Error.
 var (
 	ErrInvalidConn       = errors.New("invalid Connection")
+	ErrBadConn           = errors.New("bad connection")
 	ErrMalformPkt        = errors.New("malformed Packet")
 	ErrNoTLS             = errors.New("TLS encryption requested but server does not support TLS")
 	ErrOldPassword       = errors.New("this user requires old password authentication. If you still want to use it, please add 'allowOldPasswords=1' to your DSN. See also https://github.com/go-sql-driver/mysql/wiki/old_passwords")
@@ -31,6 +41,9 @@ var (
 	ErrUnsafeInterpolate = errors.New("this type can not safely be interpolated. Use prepared statements instead or build the query manually")
 	ErrInterpolateFailed = errors.New("interpolating query failed")
 	ErrNoRows            = errors.New("no row available")
+	ErrTxDone            = errors.New("transaction has already been committed or rolled back")
+	ErrPoolClosed        = errors.New("pool is closed")
+	ErrIncompleteResult  = errors.New("incomplete result: the connection broke before the end of the result was received")
 )
 
 var errLog = Logger(log.New(os.Stderr, "[MySQL] ", log.Ldate|log.Ltime|log.Lshortfile))
@@ -50,16 +63,63 @@ func SetLogger(logger Logger) error {
 	return nil
 }
 
-// Error is an error type which represents a single MySQL error
+// Error is an error type which represents a single MySQL error.
+// SQLState is only set if the server sent it, which all servers supporting
+// the protocol 4.1 do.
 type Error struct {
-	Number  uint16
-	Message string
+	Number   uint16
+	SQLState [5]byte
+	Message  string
 }
 
 func (e *Error) Error() string {
 	return fmt.Sprintf("Error %d: %s", e.Number, e.Message)
 }
 
+// IsRetryable reports whether the failed statement or transaction may succeed
+// if it is retried. This is the case for the following errors:
+//
+//     1040 Too many connections
+//     1053 Server shutdown in progress
+//     1158 Got an error reading communication packets
+//     1159 Got timeout reading communication packets
+//     1160 Got an error writing communication packets
+//     1161 Got timeout writing communication packets
+//     1205 Lock wait timeout exceeded
+//     1213 Deadlock found when trying to get lock
+//
+// Only idempotent statements and whole transactions should be retried.
+// Broken connections are reported with ErrBadConn instead of an *Error.
+func (e *Error) IsRetryable() bool {
+	switch e.Number {
+	case 1040, 1053, 1158, 1159, 1160, 1161, 1205, 1213:
+		return true
+	}
+	return false
+}
+
+// badConnError is ErrBadConn with details on the cause
+type badConnError struct {
+	cause error
+}
+
+func (e *badConnError) Error() string {
+	return ErrBadConn.Error() + ": " + e.cause.Error()
+}
+
+// Is makes errors.Is(err, ErrBadConn) report true.
+func (e *badConnError) Is(target error) bool {
+	return target == ErrBadConn
+}
+
+// isBadConn reports whether err is ErrBadConn, with or without details.
+func isBadConn(err error) bool {
+	if _, ok := err.(*badConnError); ok {
+		return true
+	}
+	return err == ErrBadConn
+}
+
 // Warnings is an error type which represents a group of one or more MySQL
 // warnings
 type Warnings []Warning
@@ -81,7 +141,7 @@ func (ws Warnings) Error() string {
 }
 
 // Warning is an error type which represents a single MySQL warning.
-// Warnings are returned in groups only. See MySQLWarnings
+// Warnings are returned in groups only. See Warnings
 type Warning struct {
 	Level   string
 	Code    string
@@ -89,39 +149,27 @@ type Warning struct {
 }
 
 func (conn *Conn) getWarnings() (err error) {
-	rows, err := conn.Query("SHOW WARNINGS", nil)
+	rows, err := conn.Query("SHOW WARNINGS")
 	if err != nil {
 		return
 	}
 
 	var warnings = Warnings{}
-	var values = make([]interface{}, 3)
 
 	for rows.Next() {
-		if err = rows.Scan(values); err != nil {
+		warning := Warning{}
+		if err = rows.Scan(&warning.Level, &warning.Code, &warning.Message); err != nil {
 			rows.Close()
 			return
 		}
-
-		warning := Warning{}
-
-		if raw, ok := values[0].([]byte); ok {
-			warning.Level = string(raw)
-		} else {
-			warning.Level = fmt.Sprintf("%s", values[0])
-		}
-		if raw, ok := values[1].([]byte); ok {
-			warning.Code = string(raw)
-		} else {
-			warning.Code = fmt.Sprintf("%s", values[1])
-		}
-		if raw, ok := values[2].([]byte); ok {
-			warning.Message = string(raw)
-		} else {
-			warning.Message = fmt.Sprintf("%s", values[0])
-		}
-
 		warnings = append(warnings, warning)
 	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+	if len(warnings) == 0 {
+		// e.g. cleared by a later statement of a multi-statement query
+		return nil
+	}
 	return warnings
 }
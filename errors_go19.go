@@ -0,0 +1,19 @@
+// gmysql - A MySQL package for Go
+//
+// Copyright 2016 The gmysql Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// +build go1.9
+
+package gmysql
+
+// MySQLError is an alias of Error for code written against the name used by
+// the database/sql driver. It is only available with Go 1.9 or newer, use
+// Error to support older versions.
+type MySQLError = Error
+
+// MySQLWarnings is an alias of Warnings, see MySQLError.
+type MySQLWarnings = Warnings
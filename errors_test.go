@@ -12,6 +12,7 @@ import (
 	"bytes"
 	"log"
 	"testing"
+	"time"
 )
 
 func TestErrorsSetLogger(t *testing.T) {
@@ -40,3 +41,89 @@ func TestErrorsStrictIgnoreNotes(t *testing.T) {
 		ct.mustExec("DROP TABLE IF EXISTS does_not_exist")
 	})
 }
+
+func TestErrorIsRetryable(t *testing.T) {
+	var retryableTests = []struct {
+		number    uint16
+		retryable bool
+	}{
+		{1205, true},  // lock wait timeout
+		{1213, true},  // deadlock
+		{1040, true},  // too many connections
+		{1062, false}, // duplicate entry
+		{1146, false}, // table doesn't exist
+	}
+
+	for _, tst := range retryableTests {
+		err := &Error{Number: tst.number}
+		if err.IsRetryable() != tst.retryable {
+			t.Errorf("%d: expected IsRetryable to be %t", tst.number, tst.retryable)
+		}
+	}
+}
+
+// testWarningsResponse returns the response to SHOW WARNINGS with a single
+// warning "Out of range 1"
+func testWarningsResponse() []byte {
+	response := []byte{0x01, 0x00, 0x00, 0x01, 0x03}
+	response = appendColumnPacket(response, 2, "Level", fieldTypeVarString, 0)
+	response = appendColumnPacket(response, 3, "Code", fieldTypeVarString, 0)
+	response = appendColumnPacket(response, 4, "Message", fieldTypeVarString, 0)
+	response = append(response, 0x05, 0x00, 0x00, 0x05, iEOF, 0x00, 0x00, 0x02, 0x00)
+	row := []byte{0x07}
+	row = append(row, "Warning"...)
+	row = append(row, 0x04)
+	row = append(row, "1264"...)
+	row = append(row, 0x0e)
+	row = append(row, "Out of range 1"...)
+	response = append(response, byte(len(row)), 0x00, 0x00, 0x06)
+	response = append(response, row...)
+	return append(response, 0x05, 0x00, 0x00, 0x07, iEOF, 0x00, 0x00, 0x02, 0x00)
+}
+
+func TestGetWarnings(t *testing.T) {
+	conn, server, received := newResponderConn(nil, testWarningsResponse())
+	defer server.Close()
+
+	err := conn.getWarnings()
+	if q := string((<-received)[1:]); q != "SHOW WARNINGS" {
+		t.Errorf("unexpected query %q", q)
+	}
+	warnings, ok := err.(Warnings)
+	if !ok {
+		t.Fatalf("expected Warnings, got %v", err)
+	}
+	expected := Warning{Level: "Warning", Code: "1264", Message: "Out of range 1"}
+	if len(warnings) != 1 || warnings[0] != expected {
+		t.Errorf("unexpected warnings %#v", warnings)
+	}
+}
+
+func TestStrictMultiStatementWarnings(t *testing.T) {
+	// the first statement has a warning and further results follow
+	response := []byte{0x07, 0x00, 0x00, 0x01, iOK, 0x01, 0x00, 0x0a, 0x00, 0x01, 0x00}
+	response = append(response, 0x07, 0x00, 0x00, 0x02, iOK, 0x02, 0x00, 0x02, 0x00, 0x00, 0x00)
+
+	conn, server, received := newResponderConn(nil, response, testWarningsResponse())
+	defer server.Close()
+	conn.strict = true
+	conn.buf.timeout = time.Second // fail instead of hanging if out of sync
+
+	res, err := conn.Exec("INSERT INTO test VALUES (1000); UPDATE test SET value = 1")
+	if q := string((<-received)[1:]); q != "INSERT INTO test VALUES (1000); UPDATE test SET value = 1" {
+		t.Errorf("unexpected query %q", q)
+	}
+	// SHOW WARNINGS is sent after the last result only
+	if q := string((<-received)[1:]); q != "SHOW WARNINGS" {
+		t.Errorf("unexpected query %q", q)
+	}
+	if warnings, ok := err.(Warnings); !ok || len(warnings) != 1 {
+		t.Errorf("expected 1 warning, got %#v", err)
+	}
+	if n, _ := res.RowsAffected(); n != 2 {
+		t.Errorf("expected 2 affected rows of the last statement, got %d", n)
+	}
+	if conn.warningsPending {
+		t.Error("expected no pending warnings")
+	}
+}
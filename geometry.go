@@ -0,0 +1,60 @@
+// gmysql - A MySQL package for Go
+//
+// Copyright 2016 The gmysql Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package gmysql
+
+import (
+	"database/sql/driver"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var errGeometryTooShort = errors.New("geometry value is too short")
+
+// Geometry is the value of a GEOMETRY column. MySQL stores geometries in an
+// internal format, which is the standard WKB (Well-Known Binary) representation
+// prefixed with the 4 byte SRID (spatial reference system identifier).
+// Geometry splits the value into both parts:
+//
+//  var g Geometry
+//  err := conn.QueryRow("SELECT location FROM foo WHERE id=?", id).Scan(&g)
+//  ...
+//  // g.WKB can be passed to any WKB parser
+//
+// A Geometry can be passed as a query parameter as well.
+type Geometry struct {
+	SRID uint32
+	WKB  []byte
+}
+
+// Scan implements the Scanner interface.
+// The value type must be []byte in the internal MySQL format, otherwise Scan
+// fails. NULL values can not be scanned.
+func (g *Geometry) Scan(value interface{}) error {
+	v, ok := value.([]byte)
+	if !ok {
+		return fmt.Errorf("Can't convert %T to Geometry", value)
+	}
+	if len(v) < 4 {
+		return errGeometryTooShort
+	}
+
+	g.SRID = binary.LittleEndian.Uint32(v[:4])
+	g.WKB = append(g.WKB[:0], v[4:]...)
+	return nil
+}
+
+// Value implements the driver Valuer interface.
+// It returns the geometry in the internal MySQL format.
+func (g Geometry) Value() (driver.Value, error) {
+	v := make([]byte, 4+len(g.WKB))
+	binary.LittleEndian.PutUint32(v[:4], g.SRID)
+	copy(v[4:], g.WKB)
+	return v, nil
+}
@@ -0,0 +1,64 @@
+// gmysql - A MySQL package for Go
+//
+// Copyright 2016 The gmysql Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package gmysql
+
+import (
+	"bytes"
+	"testing"
+)
+
+// POINT(1 2) with SRID 4326 in the internal MySQL format
+var testGeometry = []byte{
+	0xe6, 0x10, 0x00, 0x00, // SRID
+	0x01,                   // little endian
+	0x01, 0x00, 0x00, 0x00, // point
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xf0, 0x3f, // x = 1
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x40, // y = 2
+}
+
+func TestGeometryScan(t *testing.T) {
+	data := append([]byte{byte(len(testGeometry))}, testGeometry...)
+	rows := &textRows{iRows{
+		conn:    &Conn{cfg: &Config{}},
+		columns: []Field{{name: "location", fieldType: fieldTypeGeometry}},
+		data:    data,
+	}}
+
+	var g Geometry
+	if err := rows.Scan(&g); err != nil {
+		t.Fatal(err)
+	}
+	if g.SRID != 4326 {
+		t.Errorf("expected SRID 4326, got %d", g.SRID)
+	}
+	if !bytes.Equal(g.WKB, testGeometry[4:]) {
+		t.Errorf("expected WKB %v, got %v", testGeometry[4:], g.WKB)
+	}
+
+	// the WKB must be a copy
+	data[5] = 0xff
+	if g.WKB[0] != 0x01 {
+		t.Error("WKB references the row data")
+	}
+
+	v, err := g.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(v.([]byte), testGeometry) {
+		t.Errorf("expected %v, got %v", testGeometry, v)
+	}
+
+	if err := g.Scan([]byte{0x00, 0x00}); err != errGeometryTooShort {
+		t.Errorf("expected errGeometryTooShort, got %v", err)
+	}
+	if err := g.Scan(nil); err == nil {
+		t.Error("expected error for NULL value")
+	}
+}
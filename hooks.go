@@ -0,0 +1,55 @@
+// gmysql - A MySQL package for Go
+//
+// Copyright 2016 The gmysql Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package gmysql
+
+import (
+	"time"
+)
+
+// Hooks are called around the execution of queries and prepared statements,
+// e.g. to collect metrics. They can be set in the Config of a connection.
+//
+// The hooks are called by Exec and Query of Conn and Stmt and by all methods
+// using them. The query is passed after the args were interpolated. For
+// prepared statements, it is the query the statement was prepared with.
+type Hooks interface {
+	// BeforeQuery is called before the query is sent to the server.
+	BeforeQuery(query string)
+
+	// AfterQuery is called once the result of the query was received, with
+	// the elapsed time and the error, if any. For queries returning rows, the
+	// time until the columns were received is measured, reading the rows is
+	// not included.
+	AfterQuery(query string, d time.Duration, err error)
+}
+
+// runHooks calls the BeforeQuery hook of the connection, if set, and returns a
+// function calling the AfterQuery hook. Queries running longer than the
+// slowThreshold are logged.
+func (conn *Conn) runHooks(query string) func(err error) {
+	hooks := conn.cfg.Hooks
+	threshold := conn.cfg.SlowThreshold
+	if hooks == nil && threshold <= 0 {
+		return func(error) {}
+	}
+
+	if hooks != nil {
+		hooks.BeforeQuery(query)
+	}
+	start := time.Now()
+	return func(err error) {
+		d := time.Since(start)
+		if threshold > 0 && d > threshold {
+			errLog.Print("slow query (", d, "): ", query)
+		}
+		if hooks != nil {
+			hooks.AfterQuery(query, d, err)
+		}
+	}
+}
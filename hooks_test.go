@@ -0,0 +1,105 @@
+// gmysql - A MySQL package for Go
+//
+// Copyright 2016 The gmysql Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package gmysql
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testHooks struct {
+	before []string
+	after  []string
+	errs   []error
+}
+
+func (h *testHooks) BeforeQuery(query string) {
+	h.before = append(h.before, query)
+}
+
+func (h *testHooks) AfterQuery(query string, d time.Duration, err error) {
+	h.after = append(h.after, query)
+	h.errs = append(h.errs, err)
+}
+
+func TestHooks(t *testing.T) {
+	conn, server, _ := newResponderConn(nil,
+		[]byte{0x07, 0x00, 0x00, 0x01, iOK, 0x01, 0x00, 0x02, 0x00, 0x00, 0x00},
+		append([]byte{0x16, 0x00, 0x00, 0x01, iERR, 0x7a, 0x04, '#', '4', '2', 'S', '0', '2'}, "Unknown table"...),
+		testOkPacket,
+	)
+	defer server.Close()
+	hooks := new(testHooks)
+	conn.cfg.Hooks = hooks
+
+	if _, err := conn.Exec("UPDATE test SET value = ?", 42); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec("DROP TABLE test"); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	stmt := &Stmt{conn: conn, id: 1, paramCount: 1, query: "DO ?"}
+	if _, err := stmt.Exec(1); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"UPDATE test SET value = 42", "DROP TABLE test", "DO ?"}
+	for i, query := range expected {
+		if len(hooks.before) <= i || hooks.before[i] != query {
+			t.Fatalf("expected BeforeQuery calls %q, got %q", expected, hooks.before)
+		}
+		if len(hooks.after) <= i || hooks.after[i] != query {
+			t.Fatalf("expected AfterQuery calls %q, got %q", expected, hooks.after)
+		}
+	}
+	if hooks.errs[0] != nil || hooks.errs[2] != nil {
+		t.Errorf("expected no errors, got %v", hooks.errs)
+	}
+	if me, ok := hooks.errs[1].(*Error); !ok || me.Number != 1146 {
+		t.Errorf("expected error 1146, got %v", hooks.errs[1])
+	}
+}
+
+type testLogger struct {
+	lines []string
+}
+
+func (l *testLogger) Print(v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprint(v...))
+}
+
+func TestSlowQueryLog(t *testing.T) {
+	previous := errLog
+	defer func() {
+		errLog = previous
+	}()
+	logger := new(testLogger)
+	SetLogger(logger)
+
+	conn, server, _ := newResponderConn(nil, testOkPacket, testOkPacket)
+	defer server.Close()
+
+	conn.cfg.SlowThreshold = time.Hour
+	if _, err := conn.Exec("DO 1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(logger.lines) != 0 {
+		t.Fatalf("expected no log, got %q", logger.lines)
+	}
+
+	conn.cfg.SlowThreshold = time.Nanosecond
+	if _, err := conn.Exec("DO 2"); err != nil {
+		t.Fatal(err)
+	}
+	if len(logger.lines) != 1 || !strings.HasPrefix(logger.lines[0], "slow query (") || !strings.HasSuffix(logger.lines[0], "): DO 2") {
+		t.Errorf("unexpected log %q", logger.lines)
+	}
+}
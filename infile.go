@@ -9,15 +9,19 @@
 package gmysql
 
 import (
+	"compress/gzip"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 )
 
 var (
 	fileRegister       map[string]bool
+	dirRegister        map[string]bool
 	fileRegisterLock   sync.RWMutex
 	readerRegister     map[string]func() io.Reader
 	readerRegisterLock sync.RWMutex
@@ -27,6 +31,7 @@ var (
 // so that it can be used by "LOAD DATA LOCAL INFILE <filepath>".
 // Alternatively you can allow the use of all local files with
 // the DSN parameter 'allowAllFiles=true'
+// Files with a ".gz" extension are decompressed on the fly.
 //
 //  filePath := "/home/gopher/data.csv"
 //  mysql.RegisterLocalFile(filePath)
@@ -52,6 +57,69 @@ func DeregisterLocalFile(filePath string) {
 	fileRegisterLock.Unlock()
 }
 
+// RegisterLocalFileDir adds the given directory to the file whitelist,
+// so that all files in it and its subdirectories can be used by
+// "LOAD DATA LOCAL INFILE <filepath>". Paths escaping the directory, like
+// "<dir>/../file", are rejected. Symbolic links are not resolved.
+//
+//  mysql.RegisterLocalFileDir("/home/gopher/uploads")
+//  err := db.Exec("LOAD DATA LOCAL INFILE '/home/gopher/uploads/data.csv' INTO TABLE foo")
+//  if err != nil {
+//  ...
+//
+func RegisterLocalFileDir(dir string) error {
+	dir, err := filepath.Abs(strings.Trim(dir, `"`))
+	if err != nil {
+		return err
+	}
+
+	fileRegisterLock.Lock()
+	// lazy map init
+	if dirRegister == nil {
+		dirRegister = make(map[string]bool)
+	}
+
+	dirRegister[dir] = true
+	fileRegisterLock.Unlock()
+	return nil
+}
+
+// DeregisterLocalFileDir removes the given directory from the whitelist.
+func DeregisterLocalFileDir(dir string) {
+	dir, err := filepath.Abs(strings.Trim(dir, `"`))
+	if err != nil {
+		return
+	}
+
+	fileRegisterLock.Lock()
+	delete(dirRegister, dir)
+	fileRegisterLock.Unlock()
+}
+
+// inLocalFileDir reports whether the file is in one of the registered
+// directories. The caller must hold fileRegisterLock.
+func inLocalFileDir(name string) bool {
+	if len(dirRegister) == 0 {
+		return false
+	}
+
+	// Abs cleans the path, which removes any ".." elements
+	path, err := filepath.Abs(name)
+	if err != nil {
+		return false
+	}
+	for dir := range dirRegister {
+		prefix := dir
+		if !strings.HasSuffix(prefix, string(filepath.Separator)) {
+			prefix += string(filepath.Separator)
+		}
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 // RegisterReaderHandler registers a handler function which is used
 // to receive a io.Reader.
 // The Reader can be used by "LOAD DATA LOCAL INFILE Reader::<name>".
@@ -86,6 +154,25 @@ func DeregisterReaderHandler(name string) {
 	readerRegisterLock.Unlock()
 }
 
+// ExecInfile executes a "LOAD DATA LOCAL INFILE" query and sends the content of
+// r as the requested file, regardless of the file name in the query. Neither
+// the file whitelist nor the reader registry are used. r is read until io.EOF
+// and is not closed.
+//
+//  err := conn.ExecInfile("LOAD DATA LOCAL INFILE 'data' INTO TABLE foo", csvReader)
+//  if err != nil {
+//  ...
+//
+func (conn *Conn) ExecInfile(query string, r io.Reader) (Result, error) {
+	if r == nil {
+		return Result{}, errors.New("Reader is <nil>")
+	}
+	conn.infileReader = r
+	defer func() { conn.infileReader = nil }()
+
+	return conn.Exec(query)
+}
+
 func deferredClose(err *error, closer io.Closer) {
 	closeErr := closer.Close()
 	if *err == nil {
@@ -97,7 +184,10 @@ func (conn *Conn) handleInFileRequest(name string) (err error) {
 	var rdr io.Reader
 	var data []byte
 
-	if idx := strings.Index(name, "Reader::"); idx == 0 || (idx > 0 && name[idx-1] == '/') { // io.Reader
+	if conn.infileReader != nil { // io.Reader passed to ExecInfile
+		rdr = conn.infileReader
+		data = make([]byte, 4+conn.maxWriteSize)
+	} else if idx := strings.Index(name, "Reader::"); idx == 0 || (idx > 0 && name[idx-1] == '/') { // io.Reader
 		// The server might return an an absolute path. See issue #355.
 		name = name[idx+8:]
 
@@ -122,7 +212,8 @@ func (conn *Conn) handleInFileRequest(name string) (err error) {
 	} else { // File
 		name = strings.Trim(name, `"`)
 		fileRegisterLock.RLock()
-		fr := fileRegister[name]
+		fr := fileRegister[name] || inLocalFileDir(name)
+		hasDirs := len(dirRegister) > 0
 		fileRegisterLock.RUnlock()
 		if conn.cfg.AllowAllFiles || fr {
 			var file *os.File
@@ -131,8 +222,15 @@ func (conn *Conn) handleInFileRequest(name string) (err error) {
 			if file, err = os.Open(name); err == nil {
 				defer deferredClose(&err, file)
 
-				// get file size
-				if fi, err = file.Stat(); err == nil {
+				if strings.HasSuffix(strings.ToLower(name), ".gz") {
+					// the decompressed size is unknown, send it in chunks
+					var gz *gzip.Reader
+					if gz, err = gzip.NewReader(file); err == nil {
+						defer deferredClose(&err, gz)
+						rdr = gz
+						data = make([]byte, 4+conn.maxWriteSize)
+					}
+				} else if fi, err = file.Stat(); err == nil { // get file size
 					rdr = file
 					if fileSize := int(fi.Size()); fileSize <= conn.maxWriteSize {
 						data = make([]byte, 4+fileSize)
@@ -143,6 +241,8 @@ func (conn *Conn) handleInFileRequest(name string) (err error) {
 					}
 				}
 			}
+		} else if hasDirs {
+			err = fmt.Errorf("Local File '%s' is neither registered nor in a registered directory", name)
 		} else {
 			err = fmt.Errorf("Local File '%s' is not registered. Use the DSN parameter 'allowAllFiles=true' to allow all files", name)
 		}
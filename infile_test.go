@@ -0,0 +1,104 @@
+// gmysql - A MySQL package for Go
+//
+// Copyright 2016 The gmysql Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package gmysql
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalFileDir(t *testing.T) {
+	dir := filepath.Join(string(filepath.Separator), "tmp", "gmysql", "uploads")
+	if err := RegisterLocalFileDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer DeregisterLocalFileDir(dir)
+
+	var dirTests = []struct {
+		name    string
+		allowed bool
+	}{
+		{filepath.Join(dir, "data.csv"), true},
+		{filepath.Join(dir, "sub", "data.csv"), true},
+		{dir + "/sub/../data.csv", true},
+		{dir + "/../secret.csv", false},
+		{dir + "/sub/../../secret.csv", false},
+		{dir + "2/data.csv", false},
+		{dir, false},
+		{"/etc/passwd", false},
+	}
+
+	fileRegisterLock.RLock()
+	defer fileRegisterLock.RUnlock()
+	for _, tst := range dirTests {
+		if allowed := inLocalFileDir(tst.name); allowed != tst.allowed {
+			t.Errorf("%s: expected allowed=%t, got %t", tst.name, tst.allowed, allowed)
+		}
+	}
+}
+
+func TestLocalFileGzip(t *testing.T) {
+	file, err := ioutil.TempFile("", "gmysql-infile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := file.Name() + ".csv.gz"
+	file.Close()
+	os.Remove(file.Name())
+	defer os.Remove(name)
+
+	const content = "1,a string\n2,a string containing a \\t\n3,a string containing a \\n\n"
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(content))
+	gz.Close()
+	if err = ioutil.WriteFile(name, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	RegisterLocalFile(name)
+	defer DeregisterLocalFile(name)
+
+	nc, server := net.Pipe()
+	defer server.Close()
+	received := make(chan string, 1)
+	go func() {
+		var data []byte
+		header := make([]byte, 4)
+		for {
+			if _, err := io.ReadFull(server, header); err != nil {
+				return
+			}
+			pkt := make([]byte, int(header[0])|int(header[1])<<8|int(header[2])<<16)
+			if _, err := io.ReadFull(server, pkt); err != nil {
+				return
+			}
+			if len(pkt) == 0 {
+				received <- string(data)
+				server.Write([]byte{0x07, 0x00, 0x00, header[3] + 1, iOK, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00})
+				return
+			}
+			data = append(data, pkt...)
+		}
+	}()
+
+	conn := newTestConn(nc, nil)
+	if err = conn.handleInFileRequest(name); err != nil {
+		t.Fatal(err)
+	}
+	if data := <-received; data != content {
+		t.Errorf("expected %q, got %q", content, data)
+	}
+}
@@ -12,66 +12,202 @@ import (
 	"bytes"
 	"crypto/tls"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"math"
+	"reflect"
 	"time"
 )
 
 // Packets documentation:
 // http://dev.mysql.com/doc/internals/en/client-server-protocol.html
 
+// returned by readResultOK if the server requested to authenticate again with
+// another plugin and a new cipher, which are stored in conn.authPlugin and
+// conn.cipher
+var errAuthSwitch = errors.New("authentication switch request")
+
+// returns next N bytes from the stream, decompressing it if necessary.
+// The returned slice is only guaranteed to be valid until the next read
+func (conn *Conn) readNext(need int) ([]byte, error) {
+	if conn.compIO != nil {
+		return conn.compIO.readNext(need)
+	}
+	return conn.buf.readNext(need)
+}
+
 // Read packet to buffer 'data'
 func (conn *Conn) readPacket() ([]byte, error) {
-	var payload []byte
+	data, err := conn.readPacketPart(false)
+	if err != nil || len(data) < maxPacketSize {
+		// Zero allocations for non-splitting packets
+		return data, err
+	}
+	return conn.readSplitPacket(data)
+}
+
+// readSplitPacket reads the remaining parts of a packet larger than
+// maxPacketSize, whose first part was already read.
+// Split packets are assembled in a buffer which is reused by the following
+// reads until the result is read completely. Like data, the payload is
+// therefore only valid until the next read.
+func (conn *Conn) readSplitPacket(first []byte) ([]byte, error) {
+	payload := append(conn.splitBuf[:0], first...)
 	for {
-		// Read packet header
-		data, err := conn.buf.readNext(4)
+		data, err := conn.readPacketPart(true)
 		if err != nil {
-			conn.Close()
 			return nil, err
 		}
+		payload = append(payload, data...)
 
-		// Packet Length [24 bit]
-		pktLen := int(uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16)
-
-		if pktLen < 1 {
-			conn.Close()
-			return nil, ErrMalformPkt
+		if len(data) < maxPacketSize {
+			conn.splitBuf = payload
+			return payload, nil
 		}
+	}
+}
 
-		// Check Packet Sync [8 bit]
-		if data[3] != conn.sequence {
-			if data[3] > conn.sequence {
-				return nil, ErrPktSyncMul
-			}
-			return nil, ErrPktSync
-		}
-		conn.sequence++
+// readPacketPart reads a single network packet, which is a part of a split
+// packet if it has the size maxPacketSize. The last part of a split packet
+// may be empty.
+func (conn *Conn) readPacketPart(continued bool) ([]byte, error) {
+	// Read packet header
+	data, err := conn.readNext(4)
+	if err != nil {
+		errLog.Print(err)
+		// The server closes idle connections, e.g. after the wait_timeout,
+		// before it reads the next command
+		conn.idleBroken = conn.sequence == 1 && !isTimeout(err)
+		conn.Close()
+		return nil, ErrBadConn
+	}
 
-		// Read packet body [pktLen bytes]
-		data, err = conn.buf.readNext(pktLen)
-		if err != nil {
-			conn.Close()
-			return nil, err
-		}
+	// Packet Length [24 bit]
+	pktLen := int(uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16)
 
-		isLastPacket := (pktLen < maxPacketSize)
+	if pktLen < 1 && !continued {
+		conn.Close()
+		return nil, ErrMalformPkt
+	}
 
-		// Zero allocations for non-splitting packets
-		if isLastPacket && payload == nil {
-			return data, nil
+	// Check Packet Sync [8 bit]
+	// The connection can not be used anymore if it got out of sync
+	if data[3] != conn.sequence {
+		var err error
+		if data[3] > conn.sequence {
+			err = conn.syncError(ErrPktSyncMul)
+		} else {
+			err = conn.syncError(ErrPktSync)
 		}
+		errLog.Print(err)
+		conn.Close()
+		return nil, &badConnError{err}
+	}
+	conn.sequence++
 
-		payload = append(payload, data...)
+	// Read packet body [pktLen bytes]
+	data, err = conn.readNext(pktLen)
+	if err != nil {
+		errLog.Print(err)
+		conn.Close()
+		return nil, ErrBadConn
+	}
+	conn.stats.PacketsRead++
+	conn.stats.BytesRead += uint64(4 + pktLen)
+	return data, nil
+}
 
-		if isLastPacket {
-			return payload, nil
+// syncError adds the last command sent and its query, if any, to the packet
+// sync error err
+func (conn *Conn) syncError(err error) error {
+	if conn.lastCommand == 0 {
+		// no command was sent yet, e.g. during the handshake
+		return err
+	}
+
+	msg := err.Error() + " (last command " + commandName(conn.lastCommand)
+	if conn.lastQuery != "" {
+		msg += ": " + conn.lastQuery
+	}
+	return errors.New(msg + ")")
+}
+
+// setLastCommand records the command sent for syncError. Of the query, only
+// a short prefix without any literals is kept, since the values might be
+// sensitive.
+func (conn *Conn) setLastCommand(command byte, query string) {
+	conn.warningsPending = false
+	conn.lastCommand = command
+	conn.lastQuery = queryPrefix(query)
+}
+
+// queryPrefix returns the start of query up to the first string or number
+// literal, but at most 100 bytes. "..." is appended if query was truncated.
+func queryPrefix(query string) string {
+	const maxLen = 100
+	end := len(query)
+	if end > maxLen {
+		end = maxLen
+	}
+	for i := 0; i < end; i++ {
+		c := query[i]
+		if c == '\'' || c == '"' {
+			end = i
+			break
+		}
+		if c >= '0' && c <= '9' && (i == 0 || !isIdentChar(query[i-1])) {
+			end = i
+			break
 		}
 	}
+	if end < len(query) {
+		return query[:end] + "..."
+	}
+	return query
+}
+
+// isIdentChar reports whether c can be part of an unquoted identifier
+func isIdentChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ||
+		c >= '0' && c <= '9' || c == '_' || c == '$' || c >= 0x80
+}
+
+// commandName returns the name of the command for error messages
+func commandName(command byte) string {
+	switch command {
+	case comQuit:
+		return "COM_QUIT"
+	case comInitDB:
+		return "COM_INIT_DB"
+	case comQuery:
+		return "COM_QUERY"
+	case comStatistics:
+		return "COM_STATISTICS"
+	case comPing:
+		return "COM_PING"
+	case comChangeUser:
+		return "COM_CHANGE_USER"
+	case comStmtPrepare:
+		return "COM_STMT_PREPARE"
+	case comStmtExecute:
+		return "COM_STMT_EXECUTE"
+	case comStmtClose:
+		return "COM_STMT_CLOSE"
+	case comStmtReset:
+		return "COM_STMT_RESET"
+	case comSetOption:
+		return "COM_SET_OPTION"
+	case comResetConnection:
+		return "COM_RESET_CONNECTION"
+	}
+	return fmt.Sprintf("command 0x%02x", command)
 }
 
 // Write packet buffer 'data'
+// Each packet is sent with a single Write, including the header. The headers
+// of split packets are written into the data in place, so large payloads are
+// neither copied nor sent in small chunks.
 func (conn *Conn) writePacket(data []byte) error {
 	pktLen := len(data) - 4
 
@@ -79,6 +215,11 @@ func (conn *Conn) writePacket(data []byte) error {
 		return ErrPktTooLarge
 	}
 
+	// A new command resets the sequence of the compressed packets as well
+	if conn.compIO != nil && conn.sequence == 0 {
+		conn.compIO.sequence = 0
+	}
+
 	for {
 		var size int
 		if pktLen >= maxPacketSize {
@@ -97,13 +238,23 @@ func (conn *Conn) writePacket(data []byte) error {
 		// Write packet
 		if conn.writeTimeout > 0 {
 			if err := conn.netConn.SetWriteDeadline(time.Now().Add(conn.writeTimeout)); err != nil {
-				return err
+				errLog.Print(err)
+				conn.cleanup()
+				return ErrBadConn
 			}
 		}
 
-		n, err := conn.netConn.Write(data[:4+size])
+		var n int
+		var err error
+		if conn.compIO != nil {
+			n, err = conn.compIO.writePackets(data[:4+size])
+		} else {
+			n, err = conn.netConn.Write(data[:4+size])
+		}
 		if err == nil && n == 4+size {
 			conn.sequence++
+			conn.stats.PacketsWritten++
+			conn.stats.BytesWritten += uint64(n)
 			if size != maxPacketSize {
 				return nil
 			}
@@ -113,10 +264,15 @@ func (conn *Conn) writePacket(data []byte) error {
 		}
 
 		// Handle error
+		// The state of the connection is unknown after a failed or partial
+		// write, e.g. when the write deadline was exceeded. Mark it as bad.
 		if err != nil {
-			return err
+			errLog.Print(err)
+		} else {
+			errLog.Print(ErrMalformPkt)
 		}
-		return ErrMalformPkt
+		conn.cleanup()
+		return ErrBadConn
 	}
 }
 
@@ -147,7 +303,15 @@ func (conn *Conn) readInitPacket() ([]byte, error) {
 
 	// server version [null terminated string]
 	// connection id [4 bytes]
-	pos := 1 + bytes.IndexByte(data[1:], 0x00) + 1 + 4
+	versionEnd := 1 + bytes.IndexByte(data[1:], 0x00)
+	if versionEnd < 1 || len(data) < versionEnd+1+4+8+1+2 {
+		return nil, ErrMalformPkt
+	}
+	conn.serverVersion = string(data[1:versionEnd])
+	conn.noUtf8mb4 = !supportsUtf8mb4(conn.serverVersion)
+	pos := versionEnd + 1
+	conn.threadID = binary.LittleEndian.Uint32(data[pos : pos+4])
+	pos += 4
 
 	// first part of the password cipher [8 bytes]
 	cipher := data[pos : pos+8]
@@ -161,17 +325,29 @@ func (conn *Conn) readInitPacket() ([]byte, error) {
 		return nil, ErrOldProtocol
 	}
 	if conn.flags&clientSSL == 0 && conn.cfg.TLS != nil {
-		return nil, ErrNoTLS
+		if !conn.cfg.TLSPreferred {
+			return nil, ErrNoTLS
+		}
+		errLog.Print("server does not support TLS, falling back to an unencrypted connection")
+		conn.noTLS = true
 	}
 	pos += 2
 
 	if len(data) > pos {
+		if len(data) < pos+1+2+2+1+10+12 {
+			return nil, ErrMalformPkt
+		}
+
 		// character set [1 byte]
 		// status flags [2 bytes]
+		pos += 1 + 2
+
 		// capability flags (upper 2 bytes) [2 bytes]
+		conn.flags |= clientFlag(binary.LittleEndian.Uint16(data[pos:pos+2])) << 16
+
 		// length of auth-plugin-data [1 byte]
 		// reserved (all [00]) [10 bytes]
-		pos += 1 + 2 + 2 + 1 + 10
+		pos += 2 + 1 + 10
 
 		// second part of the password cipher [mininum 13 bytes],
 		// where len=MAX(13, length of auth-plugin-data - 8)
@@ -218,14 +394,31 @@ func (conn *Conn) writeAuthPacket(cipher []byte) error {
 		clientTransactions |
 		clientLocalFiles |
 		clientPluginAuth |
-		conn.flags&clientLongFlag
+		clientMultiResults |
+		conn.flags&clientLongFlag |
+		conn.flags&clientSessionTrack
 
 	if conn.cfg.ClientFoundRows {
 		clientFlags |= clientFoundRows
 	}
 
+	// To enable multiple statements per query
+	if conn.cfg.MultiStatements {
+		clientFlags |= clientMultiStatements
+	}
+
+	// To use interactive_timeout instead of wait_timeout
+	if conn.cfg.Interactive {
+		clientFlags |= clientInteractive
+	}
+
+	// To enable compression, if supported by the server
+	if conn.cfg.Compress && conn.flags&clientCompress != 0 {
+		clientFlags |= clientCompress
+	}
+
 	// To enable TLS / SSL
-	if conn.cfg.TLS != nil {
+	if conn.cfg.TLS != nil && !conn.noTLS {
 		clientFlags |= clientSSL
 	}
 
@@ -259,18 +452,24 @@ func (conn *Conn) writeAuthPacket(cipher []byte) error {
 	data[11] = 0x00
 
 	// Charset [1 byte]
-	data[12] = conn.cfg.Collation
+	data[12] = conn.collation()
 
 	// SSL Connection Request Packet
 	// http://dev.mysql.com/doc/internals/en/connection-phase-packets.html#packet-Protocol::SSLRequest
-	if conn.cfg.TLS != nil {
+	if conn.cfg.TLS != nil && !conn.noTLS {
 		// Send TLS / SSL request packet
 		if err := conn.writePacket(data[:(4+4+1+23)+4]); err != nil {
 			return err
 		}
 
 		// Switch to TLS
-		tlsConn := tls.Client(conn.netConn, conn.cfg.TLS)
+		tlsConfig := conn.cfg.TLS
+		if name := conn.cfg.TLSServerName; name != "" && name != tlsConfig.ServerName {
+			// don't modify the shared config
+			tlsConfig = cloneTLSConfig(tlsConfig)
+			tlsConfig.ServerName = name
+		}
+		tlsConn := tls.Client(conn.netConn, tlsConfig)
 		if err := tlsConn.Handshake(); err != nil {
 			return err
 		}
@@ -349,10 +548,120 @@ func (conn *Conn) writeClearAuthPacket() error {
 	return conn.writePacket(data)
 }
 
+//  Client native authentication packet
+// http://dev.mysql.com/doc/internals/en/connection-phase-packets.html#packet-Protocol::AuthSwitchResponse
+func (conn *Conn) writeNativeAuthPacket(cipher []byte) error {
+	// User password
+	scrambleBuff := scramblePassword(cipher, []byte(conn.cfg.Passwd))
+
+	data := conn.buf.takeSmallBuffer(4 + len(scrambleBuff))
+	if data == nil {
+		// can not take the buffer. Something must be wrong with the connection
+		return ErrBusyBuffer
+	}
+
+	// Add the scrambled password [string]
+	copy(data[4:], scrambleBuff)
+
+	return conn.writePacket(data)
+}
+
+//  Client auth switch response packet with the given auth data
+// http://dev.mysql.com/doc/internals/en/connection-phase-packets.html#packet-Protocol::AuthSwitchResponse
+func (conn *Conn) writeAuthSwitchPacket(authData []byte) error {
+	data := conn.buf.takeSmallBuffer(4 + len(authData))
+	if data == nil {
+		// can not take the buffer. Something must be wrong with the connection
+		return ErrBusyBuffer
+	}
+
+	copy(data[4:], authData)
+
+	return conn.writePacket(data)
+}
+
+// Reads the auth more data packet sent by the sha256_password and
+// caching_sha2_password plugins. OK and ERR packets are handled like in
+// readResultOK, returning nil data.
+func (conn *Conn) readAuthMoreData() ([]byte, error) {
+	data, err := conn.readPacket()
+	if err != nil {
+		return nil, err
+	}
+
+	switch data[0] {
+	case iAuthMoreData:
+		return data[1:], nil
+	case iOK:
+		return nil, conn.handleOkPacket(data)
+	case iERR:
+		return nil, conn.handleErrorPacket(data)
+	}
+	return nil, ErrMalformPkt
+}
+
+// returns the collation to use for the connection
+func (conn *Conn) collation() byte {
+	if conn.cfg.Collation == defaultCollation && conn.noUtf8mb4 {
+		// fall back to utf8 if the server does not know utf8mb4
+		return utf8Collation
+	}
+	return conn.cfg.Collation
+}
+
 /******************************************************************************
 *                             Command Packets                                 *
 ******************************************************************************/
 
+// Change User Packet
+// http://dev.mysql.com/doc/internals/en/com-change-user.html
+func (conn *Conn) writeChangeUserPacket(cipher []byte) error {
+	// Reset Packet Sequence
+	conn.sequence = 0
+
+	// User Password
+	scrambleBuff := scramblePassword(cipher, []byte(conn.cfg.Passwd))
+
+	pktLen := 1 + len(conn.cfg.User) + 1 + 1 + len(scrambleBuff) +
+		len(conn.cfg.DBName) + 1 + 2 + 21 + 1
+	data := conn.buf.takeSmallBuffer(pktLen + 4)
+	if data == nil {
+		// can not take the buffer. Something must be wrong with the connection
+		return ErrBusyBuffer
+	}
+
+	// Add command byte
+	data[4] = comChangeUser
+	conn.setLastCommand(comChangeUser, "")
+	pos := 5
+
+	// User [null terminated string]
+	pos += copy(data[pos:], conn.cfg.User)
+	data[pos] = 0x00
+	pos++
+
+	// ScrambleBuffer [length encoded integer]
+	data[pos] = byte(len(scrambleBuff))
+	pos += 1 + copy(data[pos+1:], scrambleBuff)
+
+	// Databasename [null terminated string]
+	pos += copy(data[pos:], conn.cfg.DBName)
+	data[pos] = 0x00
+	pos++
+
+	// Charset [2 bytes]
+	data[pos] = conn.collation()
+	data[pos+1] = 0x00
+	pos += 2
+
+	// Assume native client during response
+	pos += copy(data[pos:], "mysql_native_password")
+	data[pos] = 0x00
+
+	// Send CMD packet
+	return conn.writePacket(data)
+}
+
 func (conn *Conn) writeCommandPacket(command byte) error {
 	// Reset Packet Sequence
 	conn.sequence = 0
@@ -365,6 +674,7 @@ func (conn *Conn) writeCommandPacket(command byte) error {
 
 	// Add command byte
 	data[4] = command
+	conn.setLastCommand(command, "")
 
 	// Send CMD packet
 	return conn.writePacket(data)
@@ -383,6 +693,7 @@ func (conn *Conn) writeCommandPacketStr(command byte, arg string) error {
 
 	// Add command byte
 	data[4] = command
+	conn.setLastCommand(command, arg)
 
 	// Add arg
 	copy(data[5:], arg)
@@ -403,6 +714,7 @@ func (conn *Conn) writeCommandPacketUint32(command byte, arg uint32) error {
 
 	// Add command byte
 	data[4] = command
+	conn.setLastCommand(command, "")
 
 	// Add arg [32 bit]
 	data[5] = byte(arg)
@@ -430,13 +742,28 @@ func (conn *Conn) readResultOK() error {
 
 		case iEOF:
 			if len(data) > 1 {
-				plugin := string(data[1:bytes.IndexByte(data, 0x00)])
+				pluginEnd := bytes.IndexByte(data, 0x00)
+				if pluginEnd < 0 {
+					return ErrMalformPkt
+				}
+				plugin := string(data[1:pluginEnd])
 				if plugin == "mysql_old_password" {
 					// using old_passwords
 					return ErrOldPassword
 				} else if plugin == "mysql_clear_password" {
 					// using clear text password
 					return ErrCleartextPassword
+				} else if plugin == "mysql_native_password" ||
+					plugin == "caching_sha2_password" ||
+					plugin == "sha256_password" {
+					// auth switch with a new cipher [NUL terminated]
+					cipher := data[len(plugin)+2:]
+					if n := len(cipher); n > 0 && cipher[n-1] == 0x00 {
+						cipher = cipher[:n-1]
+					}
+					conn.authPlugin = plugin
+					conn.cipher = append([]byte(nil), cipher...)
+					return errAuthSwitch
 				} else {
 					return ErrUnknownPlugin
 				}
@@ -482,7 +809,7 @@ func (conn *Conn) readResultSetHeaderPacket() (int, error) {
 // Error Packet
 // http://dev.mysql.com/doc/internals/en/generic-response-packets.html#packet-ERR_Packet
 func (conn *Conn) handleErrorPacket(data []byte) error {
-	if data[0] != iERR {
+	if data[0] != iERR || len(data) < 3 {
 		return ErrMalformPkt
 	}
 
@@ -491,19 +818,24 @@ func (conn *Conn) handleErrorPacket(data []byte) error {
 	// Error Number [16 bit uint]
 	errno := binary.LittleEndian.Uint16(data[1:3])
 
+	// 1290: ER_OPTION_PREVENTS_STATEMENT, e.g. of a read-only replica
+	if errno == 1290 && conn.cfg != nil && conn.cfg.RejectReadOnly {
+		conn.Close()
+		return ErrInvalidConn
+	}
+
 	pos := 3
+	me := &Error{Number: errno}
 
 	// SQL State [optional: # + 5bytes string]
-	if data[3] == 0x23 {
-		//sqlstate := string(data[4 : 4+5])
+	if len(data) >= 9 && data[3] == 0x23 {
+		copy(me.SQLState[:], data[4:4+5])
 		pos = 9
 	}
 
 	// Error Message [string]
-	return &Error{
-		Number:  errno,
-		Message: string(data[pos:]),
-	}
+	me.Message = string(data[pos:])
+	return me
 }
 
 // Ok Packet
@@ -515,20 +847,89 @@ func (conn *Conn) handleOkPacket(data []byte) error {
 
 	// Affected rows [Length Coded Binary]
 	conn.affectedRows, _, n = readLengthEncodedInteger(data[1:])
+	if len(data) < 1+n {
+		return ErrMalformPkt
+	}
 
 	// Insert ID [Length Coded Binary]
 	conn.insertID, _, m = readLengthEncodedInteger(data[1+n:])
+	if len(data) < 1+n+m+2+2 {
+		return ErrMalformPkt
+	}
 
 	// server_status [2 bytes]
-	conn.status = statusFlag(data[1+n+m]) | statusFlag(data[1+n+m+1])<<8
+	conn.status = readStatus(data[1+n+m : 1+n+m+2])
 
 	// warning count [2 bytes]
-	if !conn.strict {
+	pos := 1 + n + m + 2
+	conn.warnings = binary.LittleEndian.Uint16(data[pos : pos+2])
+	pos += 2
+
+	conn.info = ""
+	if conn.flags&clientSessionTrack != 0 {
+		if len(data) > pos {
+			// info [Length Coded String]
+			info, _, n, err := readLengthEncodedString(data[pos:])
+			if err != nil {
+				return ErrMalformPkt
+			}
+			conn.info = string(info)
+
+			// session state changes [Length Coded String]
+			if conn.status&statusSessionStateChanged != 0 {
+				state, _, _, err := readLengthEncodedString(data[pos+n:])
+				if err != nil {
+					return ErrMalformPkt
+				}
+				if err = conn.handleSessionState(state); err != nil {
+					return err
+				}
+			}
+		}
+	} else {
+		// info [string<EOF>]
+		conn.info = string(data[pos:])
+	}
+
+	if conn.strict && conn.warnings > 0 {
+		conn.warningsPending = true
+	}
+	return conn.readPendingWarnings()
+}
+
+// readPendingWarnings reads the warnings of the strict mode once the last
+// result of the command was received. SHOW WARNINGS can not be sent while
+// further results of a multi-statement query are pending.
+func (conn *Conn) readPendingWarnings() error {
+	if !conn.warningsPending || conn.status&statusMoreResultsExists != 0 {
 		return nil
 	}
-	pos := 1 + n + m + 2
-	if binary.LittleEndian.Uint16(data[pos:pos+2]) > 0 {
-		return conn.getWarnings()
+	conn.warningsPending = false
+	return conn.getWarnings()
+}
+
+// Session State Information
+// http://dev.mysql.com/doc/internals/en/packet-OK_Packet.html#cs-sect-packet-ok-sessioninfo
+func (conn *Conn) handleSessionState(data []byte) error {
+	for len(data) > 0 {
+		// type [1 byte]
+		// data [Length Coded String]
+		typ := data[0]
+		info, _, n, err := readLengthEncodedString(data[1:])
+		if err != nil {
+			return ErrMalformPkt
+		}
+		data = data[1+n:]
+
+		switch typ {
+		case sessionTrackSchema:
+			// schema name [Length Coded String]
+			schema, _, _, err := readLengthEncodedString(info)
+			if err != nil {
+				return ErrMalformPkt
+			}
+			conn.currentDB = string(schema)
+		}
 	}
 	return nil
 }
@@ -604,8 +1005,14 @@ func (conn *Conn) readColumns(count int) ([]Field, error) {
 
 		// Filler [uint8]
 		// Charset [charset, collation uint8]
+		pos += n + 1 + 2
+		if len(data) < pos+4+1+2+1 {
+			return nil, ErrMalformPkt
+		}
+
 		// Length [uint32]
-		pos += n + 1 + 2 + 4
+		columns[i].length = binary.LittleEndian.Uint32(data[pos : pos+4])
+		pos += 4
 
 		// Field type [uint8]
 		columns[i].fieldType = data[pos]
@@ -631,15 +1038,14 @@ func (conn *Conn) readColumns(count int) ([]Field, error) {
 func (rows *textRows) readRow() error {
 	conn := rows.conn
 
-	data, err := conn.readPacket()
+	data, err := rows.readRowPacket()
 	if err != nil {
 		return err
 	}
 
 	// EOF Packet
 	if data[0] == iEOF && len(data) == 5 {
-		rows.conn = nil
-		return io.EOF
+		return rows.handleEOF(data)
 	}
 	if data[0] == iERR {
 		rows.conn = nil
@@ -650,17 +1056,110 @@ func (rows *textRows) readRow() error {
 	return nil
 }
 
+// readRowPacket reads the packet of the next row. Of rows larger than
+// maxPacketSize only the first part is read. The rest is read by readRowRest
+// or by a ColumnReader.
+func (rows *iRows) readRowPacket() ([]byte, error) {
+	if err := rows.discardStream(); err != nil {
+		return nil, err
+	}
+
+	data, err := rows.conn.readPacketPart(false)
+	if err == nil && len(data) == maxPacketSize {
+		rows.stream = &splitPacketReader{conn: rows.conn, more: true}
+	}
+	return data, err
+}
+
+// readRowRest reads the remaining parts of a row larger than maxPacketSize.
+func (rows *iRows) readRowRest() (err error) {
+	if rows.streamed {
+		return errRowStreamed
+	}
+	rows.data, err = rows.conn.readSplitPacket(rows.data)
+	rows.stream = nil
+	return
+}
+
+// discardStream discards the unread parts of a row larger than maxPacketSize.
+func (rows *iRows) discardStream() error {
+	stream := rows.stream
+	if stream == nil {
+		return nil
+	}
+	rows.stream = nil
+	rows.streamed = false
+	for stream.more {
+		data, err := stream.conn.readPacketPart(true)
+		if err != nil {
+			return err
+		}
+		stream.more = len(data) == maxPacketSize
+	}
+	return nil
+}
+
+// handleEOF handles the EOF packet terminating the rows of a result set.
+// The rows keep the connection if further result sets follow.
+func (rows *iRows) handleEOF(data []byte) error {
+	conn := rows.conn
+
+	// warning count [2 bytes]
+	// server_status [2 bytes]
+	conn.status = readStatus(data[3:5])
+
+	rows.done = true
+	if conn.status&statusMoreResultsExists == 0 {
+		rows.conn = nil
+		// the command is complete, do not keep a large buffer around
+		conn.splitBuf = nil
+		if err := conn.readPendingWarnings(); err != nil {
+			return err
+		}
+	}
+	return io.EOF
+}
+
 // Reads Packets until EOF-Packet or an Error appears. Returns count of Packets read
 func (conn *Conn) readUntilEOF() error {
 	for {
 		data, err := conn.readPacket()
+		if err != nil {
+			return err
+		}
 
-		// No Err and no EOF Packet
-		if err == nil && data[0] != iEOF {
-			continue
+		switch data[0] {
+		case iERR:
+			return conn.handleErrorPacket(data)
+		case iEOF:
+			if len(data) == 5 {
+				conn.status = readStatus(data[3:])
+			}
+			return nil
+		}
+	}
+}
+
+// discardResults reads and discards all remaining result sets of a
+// multi-statement query or stored procedure call.
+func (conn *Conn) discardResults() error {
+	for conn.status&statusMoreResultsExists != 0 {
+		resLen, err := conn.readResultSetHeaderPacket()
+		if err != nil {
+			return err
+		}
+		if resLen > 0 {
+			// columns
+			if err := conn.readUntilEOF(); err != nil {
+				return err
+			}
+			// rows
+			if err := conn.readUntilEOF(); err != nil {
+				return err
+			}
 		}
-		return err // Err or EOF
 	}
+	return conn.readPendingWarnings()
 }
 
 /******************************************************************************
@@ -784,6 +1283,7 @@ func (stmt *Stmt) writeExecutePacket(args []interface{}) error {
 
 	// command [1 byte]
 	data[4] = comStmtExecute
+	conn.setLastCommand(comStmtExecute, stmt.query)
 
 	// statement_id [4 bytes]
 	data[5] = byte(stmt.id)
@@ -835,6 +1335,11 @@ func (stmt *Stmt) writeExecutePacket(args []interface{}) error {
 		valuesCap := cap(paramValues)
 
 		for i, arg := range args {
+			arg, err := conn.convertArg(arg)
+			if err != nil {
+				return err
+			}
+
 			// build NULL-bitmap
 			if arg == nil {
 				nullMask[i/8] |= 1 << (uint(i) & 7)
@@ -846,8 +1351,23 @@ func (stmt *Stmt) writeExecutePacket(args []interface{}) error {
 			// cache types and values
 			switch v := arg.(type) {
 			case int64:
-				paramTypes[i+i] = fieldTypeLongLong
+				// use the smallest integer type the value fits in
 				paramTypes[i+i+1] = 0x00
+				switch {
+				case v >= math.MinInt8 && v <= math.MaxInt8:
+					paramTypes[i+i] = fieldTypeTiny
+					paramValues = append(paramValues, byte(v))
+					continue
+				case v >= math.MinInt16 && v <= math.MaxInt16:
+					paramTypes[i+i] = fieldTypeShort
+					paramValues = append(paramValues, byte(v), byte(v>>8))
+					continue
+				case v >= math.MinInt32 && v <= math.MaxInt32:
+					paramTypes[i+i] = fieldTypeLong
+					paramValues = append(paramValues, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+					continue
+				}
+				paramTypes[i+i] = fieldTypeLongLong
 
 				if cap(paramValues)-len(paramValues)-8 >= 0 {
 					paramValues = paramValues[:len(paramValues)+8]
@@ -861,6 +1381,37 @@ func (stmt *Stmt) writeExecutePacket(args []interface{}) error {
 					)
 				}
 
+			case uint64:
+				// use the smallest integer type the value fits in
+				paramTypes[i+i+1] = 0x80 // type is unsigned
+				switch {
+				case v <= math.MaxUint8:
+					paramTypes[i+i] = fieldTypeTiny
+					paramValues = append(paramValues, byte(v))
+					continue
+				case v <= math.MaxUint16:
+					paramTypes[i+i] = fieldTypeShort
+					paramValues = append(paramValues, byte(v), byte(v>>8))
+					continue
+				case v <= math.MaxUint32:
+					paramTypes[i+i] = fieldTypeLong
+					paramValues = append(paramValues, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+					continue
+				}
+				paramTypes[i+i] = fieldTypeLongLong
+
+				if cap(paramValues)-len(paramValues)-8 >= 0 {
+					paramValues = paramValues[:len(paramValues)+8]
+					binary.LittleEndian.PutUint64(
+						paramValues[len(paramValues)-8:],
+						v,
+					)
+				} else {
+					paramValues = append(paramValues,
+						uint64ToBytes(v)...,
+					)
+				}
+
 			case float64:
 				paramTypes[i+i] = fieldTypeDouble
 				paramTypes[i+i+1] = 0x00
@@ -934,7 +1485,7 @@ func (stmt *Stmt) writeExecutePacket(args []interface{}) error {
 				if v.IsZero() {
 					val = []byte("0000-00-00")
 				} else {
-					val = []byte(v.In(conn.cfg.Loc).Format(timeFormat))
+					val = appendDateTime(make([]byte, 0, 26), v.In(conn.cfg.Loc))
 				}
 
 				paramValues = appendLengthEncodedInteger(paramValues,
@@ -943,6 +1494,9 @@ func (stmt *Stmt) writeExecutePacket(args []interface{}) error {
 				paramValues = append(paramValues, val...)
 
 			default:
+				if reflect.ValueOf(arg).Kind() == reflect.Slice {
+					return errSliceArg
+				}
 				return fmt.Errorf("Can't convert type: %T", arg)
 			}
 		}
@@ -963,27 +1517,36 @@ func (stmt *Stmt) writeExecutePacket(args []interface{}) error {
 
 // http://dev.mysql.com/doc/internals/en/binary-protocol-resultset-row.html
 func (rows *binaryRows) readRow() error {
-	data, err := rows.conn.readPacket()
+	data, err := rows.readRowPacket()
 	if err != nil {
 		return err
 	}
 
 	// packet indicator [1 byte]
 	if data[0] != iOK {
-		rows.conn = nil
 		// EOF Packet
 		if data[0] == iEOF && len(data) == 5 {
-			return io.EOF
+			return rows.handleEOF(data)
 		}
 
 		// Error otherwise
-		return rows.conn.handleErrorPacket(data)
+		conn := rows.conn
+		rows.conn = nil
+		return conn.handleErrorPacket(data)
 	}
 
 	// NULL-bitmap,  [(column-count + 7 + 2) / 8 bytes]
 	pos := 1 + (len(rows.columns)+7+2)>>3
+	if len(data) < pos {
+		rows.conn = nil
+		return ErrMalformPkt
+	}
 	rows.nullMask = data[1:pos]
+	if rows.stream != nil {
+		// the first part of the row is overwritten by reading the rest
+		rows.nullMask = append([]byte(nil), rows.nullMask...)
+	}
 
-	rows.data = data
+	rows.data = data[pos:]
 	return nil
 }
@@ -0,0 +1,1010 @@
+// gmysql - A MySQL package for Go
+//
+// Copyright 2016 The gmysql Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package gmysql
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"encoding/pem"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// deadlineConn is a net.Conn whose reads and writes always exceed the deadline.
+type deadlineConn struct {
+	net.Conn
+	closed bool
+}
+
+func (dc *deadlineConn) Read(b []byte) (int, error)       { return 0, timeoutError{} }
+func (dc *deadlineConn) Write(b []byte) (int, error)      { return 0, timeoutError{} }
+func (dc *deadlineConn) SetReadDeadline(time.Time) error  { return nil }
+func (dc *deadlineConn) SetWriteDeadline(time.Time) error { return nil }
+func (dc *deadlineConn) Close() error {
+	dc.closed = true
+	return nil
+}
+
+func TestTimeoutMarksConnBad(t *testing.T) {
+	nc := new(deadlineConn)
+	conn := newTestConn(nc, nil)
+	conn.writeTimeout = time.Second
+	conn.buf.timeout = time.Second
+
+	if err := conn.writeCommandPacket(comPing); err != ErrBadConn {
+		t.Fatalf("expected ErrBadConn, got %v", err)
+	}
+	if !nc.closed || conn.netConn != nil {
+		t.Error("expected connection to be closed after write timeout")
+	}
+	if err := conn.Ping(); err != ErrInvalidConn {
+		t.Errorf("expected ErrInvalidConn, got %v", err)
+	}
+
+	// reads
+	nc = new(deadlineConn)
+	conn.netConn = nc
+	conn.buf = newBuffer(nc)
+	if _, err := conn.readPacket(); err != ErrBadConn {
+		t.Fatalf("expected ErrBadConn, got %v", err)
+	}
+	if !nc.closed || conn.netConn != nil {
+		t.Error("expected connection to be closed after read timeout")
+	}
+	if _, err := conn.Exec("DO 1"); err != ErrInvalidConn {
+		t.Errorf("expected ErrInvalidConn, got %v", err)
+	}
+}
+
+func TestPktSyncMarksConnBad(t *testing.T) {
+	nc := new(loopbackConn)
+	conn := newTestConn(nc, nil)
+
+	// packet with sequence 1, but 0 is expected
+	nc.data.Write([]byte{0x01, 0x00, 0x00, 0x01, iOK})
+	if _, err := conn.readPacket(); !isBadConn(err) {
+		t.Fatalf("expected ErrBadConn, got %v", err)
+	}
+	if conn.netConn != nil {
+		t.Error("expected connection to be closed after packet sync error")
+	}
+}
+
+func TestRowsErrorPacket(t *testing.T) {
+	nc := new(loopbackConn)
+	conn := newTestConn(nc, nil)
+
+	// one row, then the query is interrupted
+	nc.data.Write([]byte{0x04, 0x00, 0x00, 0x00, 0x03, 'f', 'o', 'o'})
+	payload := append([]byte{iERR, 0x25, 0x05, '#', '7', '0', '1', '0', '0'}, "Query execution was interrupted"...)
+	nc.data.Write([]byte{byte(len(payload)), 0x00, 0x00, 0x01})
+	nc.data.Write(payload)
+
+	rows := &textRows{iRows{
+		conn:    conn,
+		columns: []Field{{name: "value", fieldType: fieldTypeVarString}},
+	}}
+
+	if !rows.Next() {
+		t.Fatalf("expected a row, got error %v", rows.Err())
+	}
+	if rows.Next() {
+		t.Fatal("expected Next to return false after the error packet")
+	}
+	me, ok := rows.Err().(*Error)
+	if !ok || me.Number != 1317 {
+		t.Fatalf("expected error 1317, got %v", rows.Err())
+	}
+	if err := rows.Scan(new(string)); err != me {
+		t.Errorf("expected Scan to return the error, got %v", err)
+	}
+	if rows.Next() {
+		t.Error("expected Next to keep returning false")
+	}
+	if err := rows.Close(); err != nil {
+		t.Errorf("unexpected error on Close: %v", err)
+	}
+}
+
+func TestMalformedPackets(t *testing.T) {
+	conn := &Conn{cfg: &Config{}}
+
+	okPackets := [][]byte{
+		{iOK},
+		{iOK, 0xfc},
+		{iOK, 0x00, 0xfe, 0x01},
+		{iOK, 0x00, 0x00, 0x02, 0x00, 0x00},
+	}
+	for i, data := range okPackets {
+		if err := conn.handleOkPacket(data); err != ErrMalformPkt {
+			t.Errorf("OK packet %d: expected ErrMalformPkt, got %v", i, err)
+		}
+	}
+
+	// the session state changes exceed the packet
+	conn.flags = clientSessionTrack
+	data := []byte{iOK, 0x00, 0x00, 0x00, 0x40, 0x00, 0x00, 0x00, 0x05, 0x01}
+	if err := conn.handleOkPacket(data); err != ErrMalformPkt {
+		t.Errorf("expected ErrMalformPkt for the session state, got %v", err)
+	}
+
+	errPackets := [][]byte{
+		{iERR},
+		{iERR, 0x26},
+	}
+	for i, data := range errPackets {
+		if err := conn.handleErrorPacket(data); err != ErrMalformPkt {
+			t.Errorf("ERR packet %d: expected ErrMalformPkt, got %v", i, err)
+		}
+	}
+}
+
+func TestReadColumnsMalformed(t *testing.T) {
+	nc := new(loopbackConn)
+	conn := newTestConn(nc, nil)
+
+	// catalog, schema, table, org_table, name and org_name, then nothing
+	payload := []byte{0x03, 'd', 'e', 'f', 0x00, 0x00, 0x00, 0x01, 'a', 0x01, 'a'}
+	nc.data.Write([]byte{byte(len(payload)), 0x00, 0x00, 0x00})
+	nc.data.Write(payload)
+
+	if _, err := conn.readColumns(1); err != ErrMalformPkt {
+		t.Errorf("expected ErrMalformPkt, got %v", err)
+	}
+}
+
+func TestHandleErrorPacket(t *testing.T) {
+	conn := new(Conn)
+
+	// with SQL State
+	data := append([]byte{iERR, 0x26, 0x04, '#', '2', '3', '0', '0', '0'}, "Duplicate entry"...)
+	err := conn.handleErrorPacket(data)
+	me, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("expected *Error, got %T", err)
+	}
+	if me.Number != 1062 || string(me.SQLState[:]) != "23000" || me.Message != "Duplicate entry" {
+		t.Errorf("unexpected error %+v", me)
+	}
+
+	// without SQL State
+	data = append([]byte{iERR, 0x26, 0x04}, "Duplicate entry"...)
+	me = conn.handleErrorPacket(data).(*Error)
+	if me.Number != 1062 || me.SQLState != [5]byte{} || me.Message != "Duplicate entry" {
+		t.Errorf("unexpected error %+v", me)
+	}
+}
+
+func TestHandleErrorPacketRejectReadOnly(t *testing.T) {
+	data := append([]byte{iERR, 0x0a, 0x05, '#', 'H', 'Y', '0', '0', '0'}, "The MySQL server is running with the --read-only option"...)
+
+	conn := &Conn{cfg: &Config{}}
+	err := conn.handleErrorPacket(data)
+	if me, ok := err.(*Error); !ok || me.Number != 1290 {
+		t.Errorf("expected error 1290, got %v", err)
+	}
+
+	nc := new(loopbackConn)
+	conn = newTestConn(nc, &Config{RejectReadOnly: true})
+	if err := conn.handleErrorPacket(data); err != ErrInvalidConn {
+		t.Errorf("expected ErrInvalidConn, got %v", err)
+	}
+	if conn.netConn != nil {
+		t.Error("expected connection to be closed")
+	}
+}
+
+func TestHandleOkPacketWarnings(t *testing.T) {
+	conn := new(Conn)
+
+	// 3 affected rows, insert id 1, status autocommit, 2 warnings
+	data := []byte{iOK, 0x03, 0x01, 0x02, 0x00, 0x02, 0x00}
+	if err := conn.handleOkPacket(data); err != nil {
+		t.Fatal(err)
+	}
+	if conn.affectedRows != 3 || conn.insertID != 1 || conn.warnings != 2 {
+		t.Errorf("unexpected result: affected rows %d, insert id %d, warnings %d",
+			conn.affectedRows, conn.insertID, conn.warnings)
+	}
+}
+
+func TestHandleOkPacketInTransaction(t *testing.T) {
+	conn := new(Conn)
+
+	// status in transaction, autocommit
+	if err := conn.handleOkPacket([]byte{iOK, 0x00, 0x00, 0x03, 0x00, 0x00, 0x00}); err != nil {
+		t.Fatal(err)
+	}
+	if !conn.InTransaction() {
+		t.Error("expected InTransaction to be true")
+	}
+
+	// status autocommit
+	if err := conn.handleOkPacket([]byte{iOK, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00}); err != nil {
+		t.Fatal(err)
+	}
+	if conn.InTransaction() {
+		t.Error("expected InTransaction to be false")
+	}
+}
+
+func TestReadSplitPacketReusesBuffer(t *testing.T) {
+	nc := new(loopbackConn)
+	conn := newTestConn(nc, nil)
+	conn.maxPacketAllowed = 2 * maxPacketSize
+
+	body := make([]byte, maxPacketSize+3)
+	for i := range body {
+		body[i] = byte(i)
+	}
+	writeSplit := func(seq byte) {
+		nc.data.Write([]byte{0xff, 0xff, 0xff, seq})
+		nc.data.Write(body[:maxPacketSize])
+		nc.data.Write([]byte{0x03, 0x00, 0x00, seq + 1})
+		nc.data.Write(body[maxPacketSize:])
+	}
+
+	writeSplit(0)
+	payload, err := conn.readPacket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(payload, body) {
+		t.Fatal("payload of the first split packet does not match")
+	}
+	first := &payload[0]
+
+	writeSplit(2)
+	payload, err = conn.readPacket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(payload, body) {
+		t.Fatal("payload of the second split packet does not match")
+	}
+	if &payload[0] != first {
+		t.Error("expected the buffer of the first split packet to be reused")
+	}
+
+	// dropped once the result is read completely
+	rows := &iRows{conn: conn}
+	if err := rows.handleEOF([]byte{iEOF, 0x00, 0x00, 0x02, 0x00}); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+	if conn.splitBuf != nil {
+		t.Error("expected the split packet buffer to be dropped after the last result")
+	}
+}
+
+func TestPacketStats(t *testing.T) {
+	nc := new(loopbackConn)
+	conn := newTestConn(nc, nil)
+	conn.maxPacketAllowed = 2 * maxPacketSize
+
+	// a small and a split packet
+	if err := conn.writeCommandPacketStr(comQuery, "SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+	conn.sequence = 0
+	if _, err := conn.readPacket(); err != nil {
+		t.Fatal(err)
+	}
+	big := make([]byte, 4+maxPacketSize+3)
+	conn.sequence = 0
+	if err := conn.writePacket(big); err != nil {
+		t.Fatal(err)
+	}
+	conn.sequence = 0
+	if _, err := conn.readPacket(); err != nil {
+		t.Fatal(err)
+	}
+
+	n := uint64(4+9) + uint64(4+maxPacketSize) + uint64(4+3)
+	expected := ConnStats{
+		BytesRead:      n,
+		BytesWritten:   n,
+		PacketsRead:    3,
+		PacketsWritten: 3,
+	}
+	if stats := conn.Stats(); stats != expected {
+		t.Errorf("expected %+v, got %+v", expected, stats)
+	}
+}
+
+func TestWriteExecutePacketIntegerTypes(t *testing.T) {
+	args := []interface{}{
+		int64(5),
+		int64(-300),
+		int64(1 << 20),
+		int64(1 << 40),
+		uint64(200),
+		uint64(1 << 32),
+	}
+	expectedTypes := []byte{
+		fieldTypeTiny, 0x00,
+		fieldTypeShort, 0x00,
+		fieldTypeLong, 0x00,
+		fieldTypeLongLong, 0x00,
+		fieldTypeTiny, 0x80,
+		fieldTypeLongLong, 0x80,
+	}
+	expectedValues := []byte{
+		0x05,
+		0xd4, 0xfe,
+		0x00, 0x00, 0x10, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00,
+		0xc8,
+		0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00,
+	}
+
+	nc := new(loopbackConn)
+	conn := newTestConn(nc, nil)
+	stmt := &Stmt{conn: conn, id: 1, paramCount: len(args)}
+	if err := stmt.writeExecutePacket(args); err != nil {
+		t.Fatal(err)
+	}
+
+	// header, command, statement id, flags, iteration count, NULL-bitmap,
+	// new params bound flag
+	pkt := nc.data.Bytes()
+	pos := 4 + 1 + 4 + 1 + 4 + 1 + 1
+	if types := pkt[pos : pos+len(expectedTypes)]; !bytes.Equal(types, expectedTypes) {
+		t.Errorf("expected types %x, got %x", expectedTypes, types)
+	}
+	pos += len(expectedTypes)
+	if values := pkt[pos:]; !bytes.Equal(values, expectedValues) {
+		t.Errorf("expected values %x, got %x", expectedValues, values)
+	}
+}
+
+func TestWriteExecutePacketNullTypes(t *testing.T) {
+	args := []interface{}{
+		sql.NullString{},
+		sql.NullString{String: "a", Valid: true},
+		sql.NullInt64{Int64: 5, Valid: true},
+		sql.NullBool{},
+		sql.NullFloat64{},
+	}
+	expectedTypes := []byte{
+		fieldTypeNULL, 0x00,
+		fieldTypeString, 0x00,
+		fieldTypeTiny, 0x00,
+		fieldTypeNULL, 0x00,
+		fieldTypeNULL, 0x00,
+	}
+	expectedValues := []byte{0x01, 'a', 0x05}
+
+	nc := new(loopbackConn)
+	conn := newTestConn(nc, nil)
+	stmt := &Stmt{conn: conn, id: 1, paramCount: len(args)}
+	if err := stmt.writeExecutePacket(args); err != nil {
+		t.Fatal(err)
+	}
+
+	// header, command, statement id, flags, iteration count
+	pkt := nc.data.Bytes()
+	pos := 4 + 1 + 4 + 1 + 4
+	if nullMask := pkt[pos]; nullMask != 0x19 {
+		t.Errorf("expected NULL-bitmap 19, got %02x", nullMask)
+	}
+	// NULL-bitmap, new params bound flag
+	pos += 1 + 1
+	if types := pkt[pos : pos+len(expectedTypes)]; !bytes.Equal(types, expectedTypes) {
+		t.Errorf("expected types %x, got %x", expectedTypes, types)
+	}
+	pos += len(expectedTypes)
+	if values := pkt[pos:]; !bytes.Equal(values, expectedValues) {
+		t.Errorf("expected values %x, got %x", expectedValues, values)
+	}
+}
+
+func TestWriteExecutePacketZeroTimeNull(t *testing.T) {
+	nc := new(loopbackConn)
+	conn := newTestConn(nc, &Config{ZeroDateTimeBehavior: "null"})
+	stmt := &Stmt{conn: conn, id: 1, paramCount: 1}
+	if err := stmt.writeExecutePacket([]interface{}{time.Time{}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// header, command, statement id, flags, iteration count
+	pkt := nc.data.Bytes()
+	pos := 4 + 1 + 4 + 1 + 4
+	if nullMask := pkt[pos]; nullMask != 0x01 {
+		t.Errorf("expected NULL-bitmap 01, got %02x", nullMask)
+	}
+	if paramType := pkt[pos+2]; paramType != fieldTypeNULL {
+		t.Errorf("expected type NULL, got %x", paramType)
+	}
+}
+
+// appends a column definition packet with the given sequence id
+func appendColumnPacket(pkt []byte, seq byte, name string, fieldType byte, flags fieldFlag) []byte {
+	col := []byte{0x03, 'd', 'e', 'f', 0x00, 0x00, 0x00, byte(len(name))}
+	col = append(col, name...)
+	col = append(col, 0x00, 0x0c, 0x21, 0x00, 0x0b, 0x00, 0x00, 0x00, fieldType, byte(flags), byte(flags>>8), 0x00, 0x00, 0x00)
+	pkt = append(pkt, byte(len(col)), 0x00, 0x00, seq)
+	return append(pkt, col...)
+}
+
+// returns the prepare response of a statement with 1 param and the 2 columns
+// id and name
+func testPrepareResponse() []byte {
+	// statement id 1, 2 columns, 1 param
+	response := []byte{0x0c, 0x00, 0x00, 0x01, iOK, 0x01, 0x00, 0x00, 0x00, 0x02, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00}
+	response = appendColumnPacket(response, 2, "?", fieldTypeLongLong, 0)
+	response = append(response, 0x05, 0x00, 0x00, 0x03, iEOF, 0x00, 0x00, 0x02, 0x00)
+	response = appendColumnPacket(response, 4, "id", fieldTypeLong, flagNotNULL)
+	response = appendColumnPacket(response, 5, "name", fieldTypeVarString, 0)
+	return append(response, 0x05, 0x00, 0x00, 0x06, iEOF, 0x00, 0x00, 0x02, 0x00)
+}
+
+func TestPrepareColumns(t *testing.T) {
+	conn, server, _ := newResponderConn(nil, testPrepareResponse())
+	defer server.Close()
+
+	stmt, err := conn.Prepare("SELECT id, name FROM test WHERE id = ?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stmt.NumInput() != 1 {
+		t.Errorf("expected 1 param, got %d", stmt.NumInput())
+	}
+	if columns := stmt.Columns(); len(columns) != 2 || columns[0] != "id" || columns[1] != "name" {
+		t.Errorf("unexpected columns %q", columns)
+	}
+	types := stmt.ColumnTypes()
+	if len(types) != 2 {
+		t.Fatalf("expected 2 column types, got %d", len(types))
+	}
+	if types[0].DatabaseTypeName() != "INT" || types[0].Nullable() {
+		t.Errorf("unexpected type %s (nullable %t)", types[0].DatabaseTypeName(), types[0].Nullable())
+	}
+	if types[1].DatabaseTypeName() != "VARCHAR" || !types[1].Nullable() {
+		t.Errorf("unexpected type %s (nullable %t)", types[1].DatabaseTypeName(), types[1].Nullable())
+	}
+
+	// no rows
+	stmt = &Stmt{conn: conn}
+	if stmt.Columns() != nil || stmt.ColumnTypes() != nil {
+		t.Error("expected no columns")
+	}
+}
+
+func TestDescribeQueryColumns(t *testing.T) {
+	conn, server, _ := newResponderConn(nil, testPrepareResponse())
+	defer server.Close()
+
+	types, err := conn.DescribeQuery("SELECT id, name FROM test WHERE id = ?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(types) != 2 {
+		t.Fatalf("expected 2 column types, got %d", len(types))
+	}
+	if types[0].Name() != "id" || types[0].DatabaseTypeName() != "INT" {
+		t.Errorf("unexpected column %s %s", types[0].Name(), types[0].DatabaseTypeName())
+	}
+	if types[1].Name() != "name" || types[1].DatabaseTypeName() != "VARCHAR" {
+		t.Errorf("unexpected column %s %s", types[1].Name(), types[1].DatabaseTypeName())
+	}
+}
+
+// returns the response to the execution of the statement of
+// testPrepareResponse without rows, with the given type of the id column
+func testExecuteResponse(idType byte) []byte {
+	response := []byte{0x01, 0x00, 0x00, 0x01, 0x02}
+	response = appendColumnPacket(response, 2, "id", idType, flagNotNULL)
+	response = appendColumnPacket(response, 3, "name", fieldTypeVarString, 0)
+	response = append(response, 0x05, 0x00, 0x00, 0x04, iEOF, 0x00, 0x00, 0x02, 0x00)
+	return append(response, 0x05, 0x00, 0x00, 0x05, iEOF, 0x00, 0x00, 0x02, 0x00)
+}
+
+func TestStmtQueryReusesPrepareColumns(t *testing.T) {
+	conn, server, _ := newResponderConn(nil, testPrepareResponse(),
+		testExecuteResponse(fieldTypeLong),
+		// e.g. after an ALTER TABLE
+		testExecuteResponse(fieldTypeLongLong),
+	)
+	defer server.Close()
+
+	stmt, err := conn.Prepare("SELECT id, name FROM test WHERE id = ?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns := stmt.columns
+
+	query := func() {
+		rows, err := stmt.Query(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if names := rows.Columns(); len(names) != 2 || names[0] != "id" || names[1] != "name" {
+			t.Errorf("unexpected columns %q", names)
+		}
+		if rows.Next() {
+			t.Error("expected no rows")
+		}
+		if err = rows.Err(); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// unchanged columns
+	query()
+	if &stmt.columns[0] != &columns[0] {
+		t.Error("expected the columns of the prepare response to be reused")
+	}
+
+	// the changed column definitions replace the cached ones
+	query()
+	if stmt.columns[0].fieldType != fieldTypeLongLong {
+		t.Errorf("expected the changed column type, got %d", stmt.columns[0].fieldType)
+	}
+}
+
+func TestQueryPreparedNoRows(t *testing.T) {
+	// the statement is closed right away, the third packet
+	conn, server, received := newResponderConn(nil, testPrepareResponse(), testOkPacket, nil)
+	defer server.Close()
+
+	rows, err := conn.QueryPrepared("DO ?", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows.Next() {
+		t.Error("expected no rows")
+	}
+	if err = rows.Close(); err != nil {
+		t.Error(err)
+	}
+	<-received // prepare
+	<-received // execute
+	if pkt := <-received; pkt[0] != comStmtClose {
+		t.Errorf("expected COM_STMT_CLOSE, got command %d", pkt[0])
+	}
+}
+
+func TestQueryPreparedClosesStmtAfterLastRow(t *testing.T) {
+	response := []byte{0x01, 0x00, 0x00, 0x01, 0x02}
+	response = appendColumnPacket(response, 2, "id", fieldTypeLong, flagNotNULL)
+	response = appendColumnPacket(response, 3, "name", fieldTypeVarString, 0)
+	response = append(response, 0x05, 0x00, 0x00, 0x04, iEOF, 0x00, 0x00, 0x02, 0x00)
+	response = append(response, 0x08, 0x00, 0x00, 0x05, iOK, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01, 'a')
+	response = append(response, 0x05, 0x00, 0x00, 0x06, iEOF, 0x00, 0x00, 0x02, 0x00)
+
+	conn, server, received := newResponderConn(nil, testPrepareResponse(), response, nil)
+	defer server.Close()
+
+	rows, err := conn.QueryPrepared("SELECT id, name FROM test WHERE id = ?", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+	}
+	if err = rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	<-received // prepare
+	<-received // execute
+
+	// the rows are not closed explicitly
+	select {
+	case pkt := <-received:
+		if pkt[0] != comStmtClose {
+			t.Errorf("expected COM_STMT_CLOSE, got command %d", pkt[0])
+		}
+	case <-time.After(time.Second):
+		t.Error("expected the statement to be closed after the last row")
+	}
+}
+
+func TestStmtExecTimeout(t *testing.T) {
+	// consume the commands, but never answer
+	conn, server, _ := newResponderConn(nil)
+	defer server.Close()
+	stmt := &Stmt{conn: conn, id: 1, paramCount: 1}
+
+	start := time.Now()
+	if _, err := stmt.ExecTimeout(50*time.Millisecond, 1); err != ErrBadConn {
+		t.Fatalf("expected ErrBadConn, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("ExecTimeout returned after %v", elapsed)
+	}
+	if conn.netConn != nil {
+		t.Error("expected connection to be closed after timeout")
+	}
+	if _, err := stmt.Exec(1); err != ErrInvalidConn {
+		t.Errorf("expected ErrInvalidConn, got %v", err)
+	}
+}
+
+func TestRowsReadTimeout(t *testing.T) {
+	nc, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		// send one row, then stall, but consume the commands
+		server.Write([]byte{0x04, 0x00, 0x00, 0x00, 0x03, 'f', 'o', 'o'})
+		buf := make([]byte, 1024)
+		for {
+			if _, err := server.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	conn := newTestConn(nc, nil)
+	conn.buf.timeout = 50 * time.Millisecond
+	rows := &textRows{iRows{
+		conn:    conn,
+		columns: []Field{{name: "value", fieldType: fieldTypeVarString}},
+	}}
+
+	var value string
+	if !rows.Next() {
+		t.Fatalf("expected a row, got error %v", rows.err)
+	}
+	if err := rows.Scan(&value); err != nil || value != "foo" {
+		t.Fatalf("expected foo, got %q (%v)", value, err)
+	}
+
+	start := time.Now()
+	if rows.Next() {
+		t.Fatal("expected Next to return false after the timeout")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Next returned after %v", elapsed)
+	}
+	if rows.err != ErrBadConn {
+		t.Errorf("expected ErrBadConn, got %v", rows.err)
+	}
+	if conn.netConn != nil {
+		t.Error("expected connection to be closed after timeout")
+	}
+	if err := rows.Close(); err != ErrIncompleteResult {
+		t.Errorf("expected ErrIncompleteResult, got %v", err)
+	}
+}
+
+func TestRowsCloseIncompleteResult(t *testing.T) {
+	nc, server := net.Pipe()
+	go func() {
+		// send one row, then drop the connection
+		server.Write([]byte{0x04, 0x00, 0x00, 0x00, 0x03, 'f', 'o', 'o'})
+		server.Close()
+	}()
+
+	conn := newTestConn(nc, nil)
+	rows := &textRows{iRows{
+		conn:    conn,
+		columns: []Field{{name: "value", fieldType: fieldTypeVarString}},
+	}}
+
+	if !rows.Next() {
+		t.Fatalf("expected a row, got error %v", rows.err)
+	}
+	if err := rows.Close(); err != ErrIncompleteResult {
+		t.Errorf("expected ErrIncompleteResult, got %v", err)
+	}
+	if conn.netConn != nil {
+		t.Error("expected connection to be closed")
+	}
+}
+
+// countingConn is a net.Conn which discards and counts the writes
+type countingConn struct {
+	net.Conn
+	writes int
+	bytes  int
+}
+
+func (cc *countingConn) Write(b []byte) (int, error) {
+	cc.writes++
+	cc.bytes += len(b)
+	return len(b), nil
+}
+
+func TestWritePacketSyscalls(t *testing.T) {
+	nc := new(countingConn)
+	conn := newTestConn(nc, nil)
+	conn.maxPacketAllowed = 64<<20 + 1024
+	stmt := &Stmt{conn: conn, id: 1}
+
+	// a 64MB parameter value is sent as a single COM_STMT_SEND_LONG_DATA
+	// command, split into packets of maxPacketSize, with one write per packet
+	const size = 64 << 20
+	if err := stmt.writeCommandLongData(0, make([]byte, size)); err != nil {
+		t.Fatal(err)
+	}
+	packets := (size+7)/maxPacketSize + 1
+	if nc.writes != packets || conn.stats.PacketsWritten != uint64(packets) {
+		t.Errorf("expected %d writes, got %d for %d packets", packets, nc.writes, conn.stats.PacketsWritten)
+	}
+	if expected := 4*packets + 7 + size; nc.bytes != expected {
+		t.Errorf("expected %d bytes, got %d", expected, nc.bytes)
+	}
+}
+
+func TestPacketSyncError(t *testing.T) {
+	previous := errLog
+	defer func() {
+		errLog = previous
+	}()
+	logger := new(testLogger)
+	SetLogger(logger)
+
+	nc := new(loopbackConn)
+	conn := newTestConn(nc, nil)
+
+	// the command itself is read back as the response, with the sequence id 0
+	if err := conn.writeCommandPacketStr(comQuery, "SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+	expected := ErrPktSync.Error() + " (last command COM_QUERY: SELECT ...)"
+	_, err := conn.readPacket()
+	if bce, ok := err.(*badConnError); !ok || !bce.Is(ErrBadConn) {
+		t.Errorf("expected ErrBadConn, got %v", err)
+	}
+	if err == nil || err.Error() != ErrBadConn.Error()+": "+expected {
+		t.Errorf("expected the details in the error, got %v", err)
+	}
+	if len(logger.lines) != 1 || logger.lines[0] != expected {
+		t.Errorf("expected log %q, got %q", expected, logger.lines)
+	}
+
+	conn.setLastCommand(comQuery, strings.Repeat("x", 200))
+	expected = ErrPktSyncMul.Error() + " (last command COM_QUERY: " + strings.Repeat("x", 100) + "...)"
+	if err := conn.syncError(ErrPktSyncMul); err.Error() != expected {
+		t.Errorf("expected %q, got %q", expected, err)
+	}
+}
+
+func TestQueryPrefix(t *testing.T) {
+	tests := []struct {
+		query, prefix string
+	}{
+		{"SELECT 1", "SELECT ..."},
+		{"SELECT * FROM t1", "SELECT * FROM t1"},
+		{"SELECT * FROM users WHERE name = 'secret'", "SELECT * FROM users WHERE name = ..."},
+		{`UPDATE t2 SET a="secret"`, "UPDATE t2 SET a=..."},
+		{"DELETE FROM t WHERE id IN (?, 42)", "DELETE FROM t WHERE id IN (?, ..."},
+		{strings.Repeat("x", 101), strings.Repeat("x", 100) + "..."},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if prefix := queryPrefix(test.query); prefix != test.prefix {
+			t.Errorf("%q: expected %q, got %q", test.query, test.prefix, prefix)
+		}
+	}
+}
+
+func TestReadInitPacket(t *testing.T) {
+	nc := new(loopbackConn)
+	conn := newTestConn(nc, nil)
+
+	payload := []byte{minProtocolVersion}
+	payload = append(payload, "5.1.73-log"...)
+	payload = append(payload, 0x00)
+	payload = append(payload, 0x01, 0x00, 0x00, 0x00) // connection id
+	payload = append(payload, "12345678"...)          // cipher
+	payload = append(payload, 0x00)                   // filler
+	payload = append(payload, 0x00, 0x02)             // clientProtocol41
+	nc.data.Write([]byte{byte(len(payload)), 0x00, 0x00, 0x00})
+	nc.data.Write(payload)
+
+	if _, err := conn.readInitPacket(); err != nil {
+		t.Fatal(err)
+	}
+	if v := conn.ServerVersion(); v != "5.1.73-log" {
+		t.Errorf("expected server version 5.1.73-log, got %q", v)
+	}
+	if !conn.noUtf8mb4 {
+		t.Error("expected no utf8mb4 support for MySQL 5.1")
+	}
+	if id := conn.ThreadID(); id != 1 {
+		t.Errorf("expected thread id 1, got %d", id)
+	}
+}
+
+func TestReadInitPacketTLSPreferred(t *testing.T) {
+	previous := errLog
+	defer func() {
+		errLog = previous
+	}()
+	logger := new(testLogger)
+	SetLogger(logger)
+
+	payload := []byte{minProtocolVersion}
+	payload = append(payload, "5.7.20"...)
+	payload = append(payload, 0x00)
+	payload = append(payload, 0x01, 0x00, 0x00, 0x00) // connection id
+	payload = append(payload, "12345678"...)          // cipher
+	payload = append(payload, 0x00)                   // filler
+	payload = append(payload, 0x00, 0x02)             // clientProtocol41, no clientSSL
+
+	for _, preferred := range []bool{false, true} {
+		nc := new(loopbackConn)
+		conn := newTestConn(nc, &Config{TLS: &tls.Config{}, TLSPreferred: preferred})
+		nc.data.Write([]byte{byte(len(payload)), 0x00, 0x00, 0x00})
+		nc.data.Write(payload)
+
+		_, err := conn.readInitPacket()
+		if !preferred {
+			if err != ErrNoTLS {
+				t.Errorf("expected ErrNoTLS, got %v", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !conn.noTLS {
+			t.Error("expected fallback to an unencrypted connection")
+		}
+		if len(logger.lines) != 1 {
+			t.Errorf("expected the downgrade to be logged, got %q", logger.lines)
+		}
+	}
+}
+
+func TestAuthSwitchCachingSHA2(t *testing.T) {
+	cipher := []byte("abcdefghijklmnopqrst")
+	okPacket := func(seq byte) []byte {
+		return []byte{0x07, 0x00, 0x00, seq, iOK, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00}
+	}
+
+	// fast auth with the password hash cached by the server
+	conn, server, received := newResponderConn(&Config{Passwd: "secret"},
+		append([]byte{0x02, 0x00, 0x00, 0x04, iAuthMoreData, 3}, okPacket(5)...),
+	)
+	conn.sequence = 3 // after the auth switch request
+	if err := conn.authSwitch("caching_sha2_password", cipher); err != nil {
+		t.Fatal(err)
+	}
+	if pkt := <-received; !bytes.Equal(pkt, scrambleSHA256Password(cipher, []byte("secret"))) {
+		t.Errorf("unexpected scramble %x", pkt)
+	}
+	server.Close()
+
+	// full auth with the RSA public key of the server
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	keyPacket := []byte{byte(len(pemKey) + 1), byte((len(pemKey) + 1) >> 8), 0x00, 0x06, iAuthMoreData}
+
+	conn, server, received = newResponderConn(&Config{Passwd: "secret"},
+		[]byte{0x02, 0x00, 0x00, 0x04, iAuthMoreData, 4},
+		append(keyPacket, pemKey...),
+		okPacket(8),
+	)
+	conn.sequence = 3
+	defer server.Close()
+	if err := conn.authSwitch("caching_sha2_password", cipher); err != nil {
+		t.Fatal(err)
+	}
+	<-received // scramble
+	if pkt := <-received; !bytes.Equal(pkt, []byte{2}) {
+		t.Errorf("expected public key request, got %x", pkt)
+	}
+	plain, err := rsa.DecryptOAEP(sha1.New(), nil, priv, <-received, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range plain {
+		plain[i] ^= cipher[i%len(cipher)]
+	}
+	if string(plain) != "secret\x00" {
+		t.Errorf("unexpected decrypted password %q", plain)
+	}
+}
+
+func TestHandleOkPacketInfo(t *testing.T) {
+	const info = "Records: 3  Duplicates: 1  Warnings: 0"
+
+	// without clientSessionTrack the info is the rest of the packet
+	data := []byte{iOK, 0x03, 0x00, 0x02, 0x00, 0x00, 0x00}
+	conn := &Conn{}
+	if err := conn.handleOkPacket(append(data, info...)); err != nil {
+		t.Fatal(err)
+	}
+	if conn.info != info {
+		t.Errorf("expected info %q, got %q", info, conn.info)
+	}
+
+	// with clientSessionTrack it is a length encoded string
+	conn = &Conn{flags: clientSessionTrack}
+	if err := conn.handleOkPacket(append(append(data, byte(len(info))), info...)); err != nil {
+		t.Fatal(err)
+	}
+	if conn.info != info {
+		t.Errorf("expected info %q, got %q", info, conn.info)
+	}
+
+	if err := conn.handleOkPacket(data); err != nil {
+		t.Fatal(err)
+	}
+	if conn.info != "" {
+		t.Errorf("expected no info, got %q", conn.info)
+	}
+}
+
+func TestHandleOkPacketSessionState(t *testing.T) {
+	conn := &Conn{flags: clientSessionTrack, currentDB: "test"}
+
+	data := []byte{
+		0x00,       // OK
+		0x00,       // affected rows
+		0x00,       // insert id
+		0x02, 0x40, // statusInAutocommit | statusSessionStateChanged
+		0x00, 0x00, // warnings
+		0x00,                                 // info
+		0x0f,                                 // session state changes
+		0x00, 0x05, 0x04, 'a', 'b', 'c', 'd', // system variable (ignored)
+		0x01, 0x06, 0x05, 'o', 't', 'h', 'e', 'r', // schema
+	}
+	if err := conn.handleOkPacket(data); err != nil {
+		t.Fatal(err)
+	}
+	if db := conn.CurrentDatabase(); db != "other" {
+		t.Errorf("expected current database other, got %q", db)
+	}
+
+	// without clientSessionTrack the state changes must be ignored
+	conn = &Conn{currentDB: "test"}
+	if err := conn.handleOkPacket(data); err != nil {
+		t.Fatal(err)
+	}
+	if db := conn.CurrentDatabase(); db != "test" {
+		t.Errorf("expected current database test, got %q", db)
+	}
+}
+
+func TestReadResultOKNativeAuthSwitch(t *testing.T) {
+	nc := new(loopbackConn)
+	conn := newTestConn(nc, nil)
+	conn.cipher = []byte("old cipher")
+
+	payload := []byte{iEOF}
+	payload = append(payload, "mysql_native_password"...)
+	payload = append(payload, 0x00)
+	payload = append(payload, "abcdefghijklmnopqrst"...)
+	payload = append(payload, 0x00)
+	nc.data.Write([]byte{byte(len(payload)), 0x00, 0x00, 0x00})
+	nc.data.Write(payload)
+
+	if err := conn.readResultOK(); err != errAuthSwitch {
+		t.Fatalf("expected errAuthSwitch, got %v", err)
+	}
+	if conn.authPlugin != "mysql_native_password" {
+		t.Errorf("unexpected auth plugin %q", conn.authPlugin)
+	}
+	if string(conn.cipher) != "abcdefghijklmnopqrst" {
+		t.Errorf("unexpected cipher %q", conn.cipher)
+	}
+}
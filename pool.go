@@ -0,0 +1,133 @@
+// gmysql - A MySQL package for Go
+//
+// Copyright 2016 The gmysql Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// +build go1.7
+
+package gmysql
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var errPoolMax = errors.New("max number of connections must be positive")
+
+// Pool is a pool of connections to one database. It is safe for concurrent
+// use by multiple goroutines, while each Conn borrowed with Get must only be
+// used by one goroutine at a time until it is returned with Put.
+type Pool struct {
+	cfg *Config
+	sem chan struct{} // one token for each connection in use
+
+	mu     sync.Mutex
+	idle   []*Conn
+	closed bool
+}
+
+// NewPool returns a new pool of connections to the database specified by the
+// DSN. At most max connections are open at the same time. No connection is
+// opened until the first call of Get.
+func NewPool(dsn string, max int) (*Pool, error) {
+	cfg, err := ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if max <= 0 {
+		return nil, errPoolMax
+	}
+
+	return &Pool{
+		cfg: cfg,
+		sem: make(chan struct{}, max),
+	}, nil
+}
+
+// Get returns an idle connection from the pool or opens a new one.
+// Idle connections are validated with Ping first and discarded if they
+// are broken. If max connections are in use already, Get blocks until one is
+// returned with Put or until ctx is done.
+func (p *Pool) Get(ctx context.Context) (*Conn, error) {
+	select {
+	case p.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			<-p.sem
+			return nil, ErrPoolClosed
+		}
+		n := len(p.idle)
+		if n == 0 {
+			p.mu.Unlock()
+			break
+		}
+		conn := p.idle[n-1]
+		p.idle[n-1] = nil
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+
+		if err := conn.Ping(); err != nil {
+			// broken connection, try the next one
+			conn.Close()
+			continue
+		}
+		return conn, nil
+	}
+
+	conn, err := OpenConfig(p.cfg)
+	if err != nil {
+		<-p.sem
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Put returns a connection borrowed with Get to the pool. Broken connections
+// are discarded. The connection must not be used after calling Put.
+func (p *Pool) Put(conn *Conn) {
+	if conn.netConn == nil {
+		// connection is broken
+		<-p.sem
+		return
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		conn.Close()
+		<-p.sem
+		return
+	}
+	p.idle = append(p.idle, conn)
+	p.mu.Unlock()
+	<-p.sem
+}
+
+// Close closes all idle connections of the pool. Connections which are in use
+// are closed when they are returned with Put. Get returns ErrPoolClosed after
+// the pool was closed.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.closed = true
+	p.mu.Unlock()
+
+	var err error
+	for _, conn := range idle {
+		if cerr := conn.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,96 @@
+// gmysql - A MySQL package for Go
+//
+// Copyright 2016 The gmysql Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// +build go1.7
+
+package gmysql
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPoolExhausted(t *testing.T) {
+	p, err := NewPool("/dbname", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// simulate a borrowed connection
+	p.sem <- struct{}{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := p.Get(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+
+	// broken connections are discarded, but free the slot
+	p.Put(&Conn{})
+	if len(p.idle) != 0 {
+		t.Errorf("expected no idle connections, got %d", len(p.idle))
+	}
+	if len(p.sem) != 0 {
+		t.Errorf("expected no connections in use, got %d", len(p.sem))
+	}
+}
+
+func TestPoolClosed(t *testing.T) {
+	p, err := NewPool("/dbname", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.Get(context.Background()); err != ErrPoolClosed {
+		t.Errorf("expected ErrPoolClosed, got %v", err)
+	}
+
+	if _, err = NewPool("/dbname", 0); err != errPoolMax {
+		t.Errorf("expected %v, got %v", errPoolMax, err)
+	}
+}
+
+func TestPool(t *testing.T) {
+	if !available {
+		t.Skipf("MySQL-Server not running on %s", netAddr)
+	}
+
+	p, err := NewPool(dsn, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := p.Get(context.Background())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer p.Put(conn)
+
+			var n int
+			if err := conn.QueryRow("SELECT 1").Scan(&n); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(p.idle) > 2 {
+		t.Errorf("expected at most 2 idle connections, got %d", len(p.idle))
+	}
+}
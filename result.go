@@ -12,6 +12,8 @@ package gmysql
 type Result struct {
 	affectedRows int64
 	insertID     int64
+	warnings     int
+	info         string
 }
 
 // LastInsertID returns the integer generated by the database in response to a
@@ -26,3 +28,19 @@ func (res *Result) LastInsertID() (int64, error) {
 func (res *Result) RowsAffected() (int64, error) {
 	return res.affectedRows, nil
 }
+
+// Warnings returns the number of warnings the command generated, e.g. because
+// a value was truncated. The warnings can be fetched with SHOW WARNINGS.
+// In the strict mode, the warnings are additionally returned as error of the
+// type Warnings together with the Result.
+func (res *Result) Warnings() int {
+	return res.warnings
+}
+
+// Info returns the human readable information the server sent about the
+// command, if any, e.g. "Records: 3  Duplicates: 1  Warnings: 0" for
+// multi-row INSERT statements or "Rows matched: 2  Changed: 1  Warnings: 0"
+// for UPDATE statements.
+func (res *Result) Info() string {
+	return res.info
+}
@@ -9,19 +9,141 @@
 package gmysql
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"reflect"
+	"strings"
 )
 
 // Field contains meta-data for one field
 type Field struct {
 	tableName string
 	name      string
+	length    uint32
 	flags     fieldFlag
 	fieldType byte
 	decimals  byte
 }
 
+// isSet reports whether the field is a SET column. The server usually reports
+// them as strings with the set flag.
+func (f *Field) isSet() bool {
+	return f.fieldType == fieldTypeSet || f.flags&flagSet != 0
+}
+
+// typeDatabaseName returns the database type name of the field, e.g. "BIGINT"
+// or "VARCHAR". Integer types are suffixed with " UNSIGNED" if the unsigned
+// flag is set.
+func (f *Field) typeDatabaseName() string {
+	var name string
+	switch f.fieldType {
+	case fieldTypeBit:
+		return "BIT"
+	case fieldTypeBLOB:
+		return "BLOB"
+	case fieldTypeDate, fieldTypeNewDate:
+		return "DATE"
+	case fieldTypeDateTime:
+		return "DATETIME"
+	case fieldTypeDecimal, fieldTypeNewDecimal:
+		return "DECIMAL"
+	case fieldTypeDouble:
+		return "DOUBLE"
+	case fieldTypeEnum:
+		return "ENUM"
+	case fieldTypeFloat:
+		return "FLOAT"
+	case fieldTypeGeometry:
+		return "GEOMETRY"
+	case fieldTypeInt24:
+		name = "MEDIUMINT"
+	case fieldTypeJSON:
+		return "JSON"
+	case fieldTypeLong:
+		name = "INT"
+	case fieldTypeLongBLOB:
+		return "LONGBLOB"
+	case fieldTypeLongLong:
+		name = "BIGINT"
+	case fieldTypeMediumBLOB:
+		return "MEDIUMBLOB"
+	case fieldTypeNULL:
+		return "NULL"
+	case fieldTypeSet:
+		return "SET"
+	case fieldTypeShort:
+		name = "SMALLINT"
+	case fieldTypeString:
+		return "CHAR"
+	case fieldTypeTime:
+		return "TIME"
+	case fieldTypeTimestamp:
+		return "TIMESTAMP"
+	case fieldTypeTiny:
+		name = "TINYINT"
+	case fieldTypeTinyBLOB:
+		return "TINYBLOB"
+	case fieldTypeVarChar, fieldTypeVarString:
+		return "VARCHAR"
+	case fieldTypeYear:
+		return "YEAR"
+	default:
+		return ""
+	}
+
+	if f.flags&flagUnsigned != 0 {
+		return name + " UNSIGNED"
+	}
+	return name
+}
+
+// ColumnType contains the name and type of a column.
+type ColumnType struct {
+	name     string
+	typeName string
+	length   int64
+	nullable bool
+
+	// only set for decimal types
+	precision int64
+	scale     int64
+	isDec     bool
+}
+
+// Name returns the name or alias of the column.
+func (ci *ColumnType) Name() string {
+	return ci.name
+}
+
+// DatabaseTypeName returns the database system name of the column type,
+// e.g. "VARCHAR", "TEXT", "INT" or "BIGINT UNSIGNED".
+func (ci *ColumnType) DatabaseTypeName() string {
+	return ci.typeName
+}
+
+// Length returns the column type length as reported by the server.
+// For text and binary types this is the maximum length in bytes.
+func (ci *ColumnType) Length() int64 {
+	return ci.length
+}
+
+// Nullable reports whether the column may be NULL.
+func (ci *ColumnType) Nullable() bool {
+	return ci.nullable
+}
+
+// DecimalSize returns the precision and scale of decimal types.
+// If not applicable, ok is false.
+func (ci *ColumnType) DecimalSize() (precision, scale int64, ok bool) {
+	return ci.precision, ci.scale, ci.isDec
+}
+
+// RawBytes is a byte slice that holds a reference to memory owned by the
+// connection. Scanning into a RawBytes avoids copying the column value.
+// The bytes are only valid until the next call of Next, NextResultSet or Close.
+type RawBytes []byte
+
 // Rows is the result of a query. Its cursor starts before the first row
 // of the result set. Use Next to advance through the rows:
 //
@@ -45,6 +167,26 @@ type Rows interface {
 	// Columns returns the column names.
 	Columns() []string
 
+	// ColumnReader returns a reader of the value of the column with the index
+	// i in the current row. Rows larger than 16MB are streamed from the
+	// network instead of being read into memory first, e.g. to io.Copy a
+	// large BLOB to a file. Only a single column of such a row can be read
+	// then and Scan can not be used for it anymore.
+	// NULL values are read as empty values. In rows of prepared statements
+	// only string and BLOB columns can be read. The reader is only valid
+	// until the next call of Next or Close. Errors are returned by its Read
+	// method.
+	ColumnReader(i int) io.Reader
+
+	// ColumnTypes returns column information such as column type, length,
+	// and nullable.
+	ColumnTypes() []*ColumnType
+
+	// Err returns the error, if any, that was encountered during iteration.
+	// Err may be called after an explicit or implicit Close. Reaching the end
+	// of the rows is not an error.
+	Err() error
+
 	// Next prepares the next result row for reading with the Scan method.  It
 	// returns true on success, or false if there is no next result row or an
 	// error happened while preparing it. Err should be consulted to distinguish
@@ -54,6 +196,15 @@ type Rows interface {
 	// Next.
 	Next() bool
 
+	// NextResultSet prepares the next result set for reading. It reports
+	// whether there is further result sets, or false if there is no further
+	// result set or if there is an error advancing to it. Err should be
+	// consulted to distinguish between the two cases.
+	//
+	// After calling NextResultSet, the Next method should always be called
+	// before scanning. Unread rows of the current result set are discarded.
+	NextResultSet() bool
+
 	// Scan copies the columns in the current row into the values pointed
 	// at by dest.
 	//
@@ -66,7 +217,83 @@ type Rows interface {
 	// If an argument has type *interface{}, Scan copies the value
 	// provided without conversion. If the value is of type []byte, a copy is
 	// made and the caller owns the result.
+	//
+	// If an argument implements Scanner, its Scan method is called with the
+	// column value, which is nil if the column is NULL.
 	Scan(dest ...interface{}) error
+
+	// ScanMap returns the columns in the current row as a map from the column
+	// names to the values, like scanning into *interface{} destinations.
+	// []byte values are returned as string and NULL values as nil. If
+	// multiple columns have the same name, the last one wins.
+	// Rows of prepared statements (binary protocol) keep their native types:
+	// integers are returned as int64, floats as float64 and, with parseTime,
+	// DATE, DATETIME and TIMESTAMP values as time.Time.
+	ScanMap() (map[string]interface{}, error)
+
+	// ScanStruct copies the columns in the current row into the exported
+	// fields of the struct pointed at by dest. Columns are matched to the
+	// fields by the name given by the "db" field tag or else by the field
+	// name, ignoring the case. Fields tagged with `db:"-"` and columns
+	// without a matching field are ignored. The values are converted like by
+	// Scan, so NULL values can only be scanned into pointer fields or fields
+	// implementing Scanner, like sql.NullString.
+	ScanStruct(dest interface{}) error
+}
+
+// Row is the result of calling QueryRow to select a single row.
+type Row struct {
+	// One of these two will be non-nil:
+	err  error // deferred error for easy chaining
+	rows Rows
+}
+
+// Scan copies the columns from the matched row into the values pointed at by
+// dest. See the documentation on Rows.Scan for details. If more than one row
+// matches the query, Scan uses the first row and discards the rest. If no row
+// matches the query, Scan returns ErrNoRows.
+func (r *Row) Scan(dest ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+
+	defer r.rows.Close()
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return err
+		}
+		return ErrNoRows
+	}
+	if err := r.rows.Scan(dest...); err != nil {
+		return err
+	}
+
+	// Make sure the query can be processed to completion with no errors.
+	return r.rows.Close()
+}
+
+// ScanMap returns the columns of the matched row as a map like Rows.ScanMap.
+// If more than one row matches the query, ScanMap uses the first row and
+// discards the rest. If no row matches the query, ScanMap returns ErrNoRows.
+func (r *Row) ScanMap() (map[string]interface{}, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	defer r.rows.Close()
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, ErrNoRows
+	}
+	row, err := r.rows.ScanMap()
+	if err != nil {
+		return nil, err
+	}
+
+	// Make sure the query can be processed to completion with no errors.
+	return row, r.rows.Close()
 }
 
 type iRows struct {
@@ -74,6 +301,12 @@ type iRows struct {
 	columns []Field
 	data    []byte
 	err     error
+	done    bool  // all rows of the current result set were read
+	stmt    *Stmt // temporary statement, closed after the last result
+
+	// unread parts of a row larger than maxPacketSize
+	stream   *splitPacketReader
+	streamed bool // stream was passed to a ColumnReader
 }
 
 type binaryRows struct {
@@ -88,47 +321,223 @@ type textRows struct {
 type emptyRows struct{}
 
 func (rows *iRows) Columns() []string {
-	columns := make([]string, len(rows.columns))
-	if rows.conn.cfg.ColumnsWithAlias {
+	return columnNames(rows.columns, rows.conn.cfg.ColumnsWithAlias)
+}
+
+// columnStream returns a reader of the values of the current row
+func (rows *iRows) columnStream(i int) (*splitPacketReader, error) {
+	if rows.err == io.EOF {
+		// an io.EOF of the reader would look like an empty value
+		return nil, ErrNoRows
+	}
+	if rows.err != nil {
+		return nil, rows.err
+	}
+	if rows.streamed {
+		return nil, errRowStreamed
+	}
+	if rows.data == nil {
+		return nil, ErrNoRows
+	}
+	if i < 0 || i >= len(rows.columns) {
+		return nil, fmt.Errorf("column index %d out of range [0, %d)", i, len(rows.columns))
+	}
+
+	if rows.stream == nil {
+		// the complete row is in memory
+		return &splitPacketReader{data: rows.data}, nil
+	}
+	stream := rows.stream
+	stream.data = rows.data
+	rows.data = nil
+	rows.streamed = true
+	return stream, nil
+}
+
+func (rows *iRows) ColumnTypes() []*ColumnType {
+	return columnTypes(rows.columns)
+}
+
+// returns the names of the fields, prefixed with the table alias if withAlias
+// is set
+func columnNames(fields []Field, withAlias bool) []string {
+	columns := make([]string, len(fields))
+	if withAlias {
 		for i := range columns {
-			if tableName := rows.columns[i].tableName; len(tableName) > 0 {
-				columns[i] = tableName + "." + rows.columns[i].name
+			if tableName := fields[i].tableName; len(tableName) > 0 {
+				columns[i] = tableName + "." + fields[i].name
 			} else {
-				columns[i] = rows.columns[i].name
+				columns[i] = fields[i].name
 			}
 		}
 	} else {
 		for i := range columns {
-			columns[i] = rows.columns[i].name
+			columns[i] = fields[i].name
 		}
 	}
 	return columns
 }
 
+func columnTypes(fields []Field) []*ColumnType {
+	types := make([]*ColumnType, len(fields))
+	for i := range fields {
+		f := &fields[i]
+		ct := &ColumnType{
+			name:     f.name,
+			typeName: f.typeDatabaseName(),
+			length:   int64(f.length),
+			nullable: f.flags&flagNotNULL == 0,
+		}
+		switch f.fieldType {
+		case fieldTypeDecimal, fieldTypeNewDecimal:
+			// The reported length includes the sign and the decimal point
+			ct.precision = int64(f.length)
+			if f.decimals > 0 {
+				ct.precision--
+			}
+			if f.flags&flagUnsigned == 0 {
+				ct.precision--
+			}
+			ct.scale = int64(f.decimals)
+			ct.isDec = true
+		}
+		types[i] = ct
+	}
+	return types
+}
+
+func (rows *iRows) Err() error {
+	if rows.err == io.EOF {
+		return nil
+	}
+	return rows.err
+}
+
 func (rows *iRows) Close() error {
+	err := rows.close()
+	if rows.stmt != nil {
+		// the results were read, the temporary statement can be closed now
+		if cerr := rows.stmt.Close(); err == nil {
+			err = cerr
+		}
+		rows.stmt = nil
+	}
+	return err
+}
+
+// closeStmt closes the temporary statement once the rows do not need the
+// connection anymore, i.e. after the last result set or an error. A failure is
+// reported by Err, unless it already reports an error.
+func (rows *iRows) closeStmt() {
+	if rows.stmt == nil {
+		return
+	}
+	err := rows.stmt.Close()
+	rows.stmt = nil
+	if err != nil && (rows.err == nil || rows.err == io.EOF) {
+		rows.err = err
+	}
+}
+
+func (rows *iRows) close() error {
 	conn := rows.conn
 	if conn == nil {
 		return nil
 	}
+	rows.conn = nil
 	if conn.netConn == nil {
-		return ErrInvalidConn
+		// the connection broke while reading the rows
+		return ErrIncompleteResult
 	}
 
 	// Remove unread packets from stream
-	err := conn.readUntilEOF()
-	rows.conn = nil
+	var err error
+	if !rows.done {
+		if err = rows.discardStream(); err == nil {
+			err = conn.readUntilEOF()
+		}
+	}
+	if err == nil {
+		err = conn.discardResults()
+	}
+	conn.splitBuf = nil
+	if isBadConn(err) || err == ErrMalformPkt {
+		return ErrIncompleteResult
+	}
 	return err
 }
 
+func (rows *iRows) NextResultSet() (ok bool) {
+	defer func() {
+		if !ok {
+			rows.closeStmt()
+		}
+	}()
+
+	conn := rows.conn
+	if conn == nil {
+		return false
+	}
+	if conn.netConn == nil {
+		rows.err = ErrInvalidConn
+		return false
+	}
+
+	// Remove unread rows of the current result set from the stream
+	if !rows.done {
+		err := rows.discardStream()
+		if err == nil {
+			err = conn.readUntilEOF()
+		}
+		if err != nil {
+			rows.err = err
+			rows.conn = nil
+			return false
+		}
+	}
+
+	// Skip results without columns, e.g. the status of a CALL statement
+	for conn.status&statusMoreResultsExists != 0 {
+		resLen, err := conn.readResultSetHeaderPacket()
+		if err != nil {
+			rows.err = err
+			rows.conn = nil
+			return false
+		}
+		if resLen == 0 {
+			continue
+		}
+
+		rows.columns, err = conn.readColumns(resLen)
+		if err != nil {
+			rows.err = err
+			rows.conn = nil
+			return false
+		}
+		rows.data = nil
+		rows.err = nil
+		rows.done = false
+		return true
+	}
+
+	rows.conn = nil
+	return false
+}
+
 func (rows *binaryRows) Next() bool {
-	if conn := rows.conn; conn != nil {
+	if conn := rows.conn; conn != nil && !rows.done {
 		if conn.netConn == nil {
 			rows.err = ErrInvalidConn
+			rows.closeStmt()
 			return false
 		}
 		// Fetch next row from stream
 		rows.err = rows.readRow()
-		return rows.err != io.EOF
+		if rows.err != nil && (rows.conn == nil || conn.netConn == nil) {
+			// no further results follow
+			rows.closeStmt()
+		}
+		return rows.err == nil
 	}
 	return false
 }
@@ -137,11 +546,16 @@ func (rows *binaryRows) Scan(dest ...interface{}) (err error) {
 	if err = rows.err; err != nil {
 		return
 	}
+	if rows.stream != nil {
+		if err = rows.readRowRest(); err != nil {
+			return
+		}
+	}
 	if rows.data == nil {
 		return ErrNoRows
 	}
 	if len(dest) != len(rows.columns) {
-		fmt.Errorf("expected %d destination arguments in Scan, not %d", len(rows.columns), len(dest))
+		return fmt.Errorf("expected %d destination arguments in Scan, not %d", len(rows.columns), len(dest))
 	}
 
 	err = rows.convert(dest)
@@ -149,15 +563,50 @@ func (rows *binaryRows) Scan(dest ...interface{}) (err error) {
 	return
 }
 
+func (rows *binaryRows) ColumnReader(i int) io.Reader {
+	stream, err := rows.columnStream(i)
+	if err != nil {
+		return errorReader{err}
+	}
+	for j := 0; j < i; j++ {
+		if !rows.isNull(j) {
+			if err = stream.skipBinaryValue(rows.columns[j].fieldType); err != nil {
+				return errorReader{err}
+			}
+		}
+	}
+	if rows.isNull(i) {
+		return stream.limit(0)
+	}
+	if !isBinaryString(rows.columns[i].fieldType) {
+		return errorReader{fmt.Errorf("column index %d is neither a string nor a BLOB column", i)}
+	}
+	return stream.lengthEncodedString()
+}
+
+// isNull reports whether the value of the column with index i is NULL
+func (rows *binaryRows) isNull(i int) bool {
+	// (byte >> bit-pos) % 2 == 1
+	return ((rows.nullMask[(i+2)>>3] >> uint((i+2)&7)) & 1) == 1
+}
+
+func (rows *binaryRows) ScanMap() (map[string]interface{}, error) {
+	return scanMap(rows, len(rows.columns))
+}
+
+func (rows *binaryRows) ScanStruct(dest interface{}) error {
+	return scanStruct(rows, rows.columns, dest)
+}
+
 func (rows *textRows) Next() bool {
-	if conn := rows.conn; conn != nil {
+	if conn := rows.conn; conn != nil && !rows.done {
 		if conn.netConn == nil {
 			rows.err = ErrInvalidConn
 			return false
 		}
 		// Fetch next row from stream
 		rows.err = rows.readRow()
-		return rows.err != io.EOF
+		return rows.err == nil
 	}
 	return false
 }
@@ -166,11 +615,16 @@ func (rows *textRows) Scan(dest ...interface{}) (err error) {
 	if err = rows.err; err != nil {
 		return
 	}
+	if rows.stream != nil {
+		if err = rows.readRowRest(); err != nil {
+			return
+		}
+	}
 	if rows.data == nil {
 		return ErrNoRows
 	}
 	if len(dest) != len(rows.columns) {
-		fmt.Errorf("expected %d destination arguments in Scan, not %d", len(rows.columns), len(dest))
+		return fmt.Errorf("expected %d destination arguments in Scan, not %d", len(rows.columns), len(dest))
 	}
 
 	err = rows.convert(dest)
@@ -178,10 +632,43 @@ func (rows *textRows) Scan(dest ...interface{}) (err error) {
 	return
 }
 
+func (rows *textRows) ColumnReader(i int) io.Reader {
+	stream, err := rows.columnStream(i)
+	if err != nil {
+		return errorReader{err}
+	}
+	for j := 0; j < i; j++ {
+		if err = stream.skipLengthEncodedString(); err != nil {
+			return errorReader{err}
+		}
+	}
+	return stream.lengthEncodedString()
+}
+
+func (rows *textRows) ScanMap() (map[string]interface{}, error) {
+	return scanMap(rows, len(rows.columns))
+}
+
+func (rows *textRows) ScanStruct(dest interface{}) error {
+	return scanStruct(rows, rows.columns, dest)
+}
+
 func (rows emptyRows) Columns() []string {
 	return nil
 }
 
+func (rows emptyRows) ColumnTypes() []*ColumnType {
+	return nil
+}
+
+func (rows emptyRows) ColumnReader(i int) io.Reader {
+	return errorReader{ErrNoRows}
+}
+
+func (rows emptyRows) Err() error {
+	return nil
+}
+
 func (rows emptyRows) Close() error {
 	return nil
 }
@@ -190,6 +677,239 @@ func (rows emptyRows) Next() bool {
 	return false
 }
 
+func (rows emptyRows) NextResultSet() bool {
+	return false
+}
+
 func (rows emptyRows) Scan(dest ...interface{}) error {
 	return ErrNoRows
 }
+
+func (rows emptyRows) ScanMap() (map[string]interface{}, error) {
+	return nil, ErrNoRows
+}
+
+func (rows emptyRows) ScanStruct(dest interface{}) error {
+	return ErrNoRows
+}
+
+// scanMap implements ScanMap for rows with n columns
+func scanMap(rows Rows, n int) (map[string]interface{}, error) {
+	values := make([]interface{}, n)
+	dest := make([]interface{}, n)
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	row := make(map[string]interface{}, n)
+	for i, name := range rows.Columns() {
+		if b, ok := values[i].([]byte); ok {
+			row[name] = string(b)
+		} else {
+			row[name] = values[i]
+		}
+	}
+	return row, nil
+}
+
+// scanStruct implements ScanStruct for rows with the given columns
+func scanStruct(rows Rows, columns []Field, dest interface{}) error {
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() || dv.Elem().Kind() != reflect.Struct {
+		return errors.New("destination not a pointer to a struct")
+	}
+	dv = dv.Elem()
+	dt := dv.Type()
+
+	fields := make(map[string]int, dt.NumField())
+	for i := 0; i < dt.NumField(); i++ {
+		f := dt.Field(i)
+		if f.PkgPath != "" {
+			// unexported
+			continue
+		}
+		name := f.Tag.Get("db")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[strings.ToLower(name)] = i
+	}
+
+	values := make([]interface{}, len(columns))
+	for i := range columns {
+		if fi, ok := fields[strings.ToLower(columns[i].name)]; ok {
+			values[i] = dv.Field(fi).Addr().Interface()
+		} else {
+			values[i] = new(RawBytes) // discarded without copying
+		}
+	}
+	return rows.Scan(values...)
+}
+
+// errorReader is an io.Reader which always fails with err
+type errorReader struct {
+	err error
+}
+
+func (r errorReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
+
+// splitPacketReader reads the values of a row, which is continued in further
+// packets if it is larger than maxPacketSize.
+type splitPacketReader struct {
+	conn *Conn
+	data []byte // unread bytes of the current part
+	more bool   // further parts follow
+}
+
+// next makes sure that unread bytes are available
+func (r *splitPacketReader) next() error {
+	for len(r.data) == 0 {
+		if !r.more {
+			// values never exceed the row
+			return ErrMalformPkt
+		}
+		data, err := r.conn.readPacketPart(true)
+		if err != nil {
+			r.more = false
+			return err
+		}
+		r.data = data
+		r.more = len(data) == maxPacketSize
+	}
+	return nil
+}
+
+func (r *splitPacketReader) Read(p []byte) (int, error) {
+	if err := r.next(); err != nil {
+		return 0, err
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func (r *splitPacketReader) readByte() (byte, error) {
+	if err := r.next(); err != nil {
+		return 0, err
+	}
+	b := r.data[0]
+	r.data = r.data[1:]
+	return b, nil
+}
+
+func (r *splitPacketReader) skip(n uint64) error {
+	for n > 0 {
+		if err := r.next(); err != nil {
+			return err
+		}
+		m := uint64(len(r.data))
+		if m > n {
+			m = n
+		}
+		r.data = r.data[m:]
+		n -= m
+	}
+	return nil
+}
+
+// readLengthEncodedInteger works like the function of the same name
+func (r *splitPacketReader) readLengthEncodedInteger() (num uint64, isNull bool, err error) {
+	b, err := r.readByte()
+	if err != nil {
+		return
+	}
+
+	var n uint
+	switch b {
+	// 251: NULL
+	case 0xfb:
+		return 0, true, nil
+	// 252: value of following 2
+	case 0xfc:
+		n = 2
+	// 253: value of following 3
+	case 0xfd:
+		n = 3
+	// 254: value of following 8
+	case 0xfe:
+		n = 8
+	// 0-250: value of first byte
+	default:
+		return uint64(b), false, nil
+	}
+
+	for i := uint(0); i < n; i++ {
+		if b, err = r.readByte(); err != nil {
+			return
+		}
+		num |= uint64(b) << (8 * i)
+	}
+	return
+}
+
+func (r *splitPacketReader) skipLengthEncodedString() error {
+	num, _, err := r.readLengthEncodedInteger()
+	if err != nil {
+		return err
+	}
+	return r.skip(num)
+}
+
+// lengthEncodedString returns a reader of the next length encoded string,
+// which is empty if the value is NULL
+func (r *splitPacketReader) lengthEncodedString() io.Reader {
+	num, _, err := r.readLengthEncodedInteger()
+	if err != nil {
+		return errorReader{err}
+	}
+	return r.limit(num)
+}
+
+func (r *splitPacketReader) limit(n uint64) io.Reader {
+	return &io.LimitedReader{R: r, N: int64(n)}
+}
+
+// skipBinaryValue skips a non-NULL value of the binary protocol
+func (r *splitPacketReader) skipBinaryValue(fieldType byte) error {
+	switch fieldType {
+	case fieldTypeNULL:
+		return nil
+	case fieldTypeTiny:
+		return r.skip(1)
+	case fieldTypeShort, fieldTypeYear:
+		return r.skip(2)
+	case fieldTypeInt24, fieldTypeLong, fieldTypeFloat:
+		return r.skip(4)
+	case fieldTypeLongLong, fieldTypeDouble:
+		return r.skip(8)
+	case fieldTypeDate, fieldTypeNewDate, fieldTypeTime,
+		fieldTypeTimestamp, fieldTypeDateTime:
+		return r.skipLengthEncodedString()
+	}
+	if isBinaryString(fieldType) {
+		return r.skipLengthEncodedString()
+	}
+	return fmt.Errorf("Unknown FieldType %d", fieldType)
+}
+
+// isBinaryString reports whether values of the type are sent as length
+// encoded strings in the binary protocol
+func isBinaryString(fieldType byte) bool {
+	switch fieldType {
+	case fieldTypeDecimal, fieldTypeNewDecimal, fieldTypeVarChar,
+		fieldTypeEnum, fieldTypeSet, fieldTypeTinyBLOB,
+		fieldTypeMediumBLOB, fieldTypeLongBLOB, fieldTypeBLOB,
+		fieldTypeVarString, fieldTypeString, fieldTypeGeometry, fieldTypeJSON,
+		fieldTypeBit:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,424 @@
+// gmysql - A MySQL package for Go
+//
+// Copyright 2016 The gmysql Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package gmysql
+
+import (
+	"bytes"
+	"database/sql"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestColumnTypes(t *testing.T) {
+	rows := &iRows{
+		columns: []Field{
+			{name: "id", fieldType: fieldTypeLongLong, flags: flagNotNULL | flagUnsigned, length: 20},
+			{name: "name", fieldType: fieldTypeVarString, length: 765},
+			{name: "price", fieldType: fieldTypeNewDecimal, flags: flagNotNULL, length: 12, decimals: 2},
+			{name: "created", fieldType: fieldTypeDateTime, length: 19},
+		},
+	}
+
+	var columnTypeTests = []struct {
+		name      string
+		typeName  string
+		length    int64
+		nullable  bool
+		precision int64
+		scale     int64
+		isDec     bool
+	}{
+		{"id", "BIGINT UNSIGNED", 20, false, 0, 0, false},
+		{"name", "VARCHAR", 765, true, 0, 0, false},
+		{"price", "DECIMAL", 12, false, 10, 2, true},
+		{"created", "DATETIME", 19, true, 0, 0, false},
+	}
+
+	cts := rows.ColumnTypes()
+	if len(cts) != len(columnTypeTests) {
+		t.Fatalf("expected %d column types, got %d", len(columnTypeTests), len(cts))
+	}
+	for i, tst := range columnTypeTests {
+		ct := cts[i]
+		if ct.Name() != tst.name {
+			t.Errorf("%d: expected name %q, got %q", i, tst.name, ct.Name())
+		}
+		if ct.DatabaseTypeName() != tst.typeName {
+			t.Errorf("%d: expected type %q, got %q", i, tst.typeName, ct.DatabaseTypeName())
+		}
+		if ct.Length() != tst.length {
+			t.Errorf("%d: expected length %d, got %d", i, tst.length, ct.Length())
+		}
+		if ct.Nullable() != tst.nullable {
+			t.Errorf("%d: expected nullable %t, got %t", i, tst.nullable, ct.Nullable())
+		}
+		if precision, scale, ok := ct.DecimalSize(); ok != tst.isDec ||
+			(ok && (precision != tst.precision || scale != tst.scale)) {
+			t.Errorf("%d: expected decimal size (%d, %d, %t), got (%d, %d, %t)",
+				i, tst.precision, tst.scale, tst.isDec, precision, scale, ok)
+		}
+	}
+}
+
+func TestScanDestinationCount(t *testing.T) {
+	columns := []Field{
+		{name: "id", fieldType: fieldTypeLongLong},
+		{name: "name", fieldType: fieldTypeVarString},
+	}
+	data := []byte{0x01, '1', 0x03, 'f', 'o', 'o'}
+
+	var id int64
+	tr := &textRows{iRows{columns: columns, data: data}}
+	if err := tr.Scan(&id); err == nil {
+		t.Error("textRows: expected error for too few destination arguments")
+	}
+
+	br := &binaryRows{iRows: iRows{columns: columns, data: data}}
+	if err := br.Scan(&id); err == nil {
+		t.Error("binaryRows: expected error for too few destination arguments")
+	}
+}
+
+func TestScanMap(t *testing.T) {
+	columns := []Field{
+		{name: "id", fieldType: fieldTypeLongLong},
+		{name: "name", fieldType: fieldTypeVarString},
+		{name: "note", fieldType: fieldTypeVarString},
+	}
+	rows := &textRows{iRows{
+		conn:    &Conn{cfg: &Config{}},
+		columns: columns,
+		data:    []byte{0x01, '1', 0x03, 'f', 'o', 'o', 0xfb}, // NULL note
+	}}
+
+	row, err := rows.ScanMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(row) != 3 || row["id"] != "1" || row["name"] != "foo" {
+		t.Errorf("unexpected row %#v", row)
+	}
+	if v, ok := row["note"]; !ok || v != nil {
+		t.Errorf("expected nil note, got %#v (%t)", v, ok)
+	}
+
+	// the row was consumed
+	if _, err := rows.ScanMap(); err != ErrNoRows {
+		t.Errorf("expected ErrNoRows, got %v", err)
+	}
+	if _, err := (emptyRows{}).ScanMap(); err != ErrNoRows {
+		t.Errorf("expected ErrNoRows, got %v", err)
+	}
+}
+
+func TestBinaryScanMap(t *testing.T) {
+	columns := []Field{
+		{name: "id", fieldType: fieldTypeLongLong},
+		{name: "score", fieldType: fieldTypeDouble},
+		{name: "created", fieldType: fieldTypeDateTime},
+		{name: "name", fieldType: fieldTypeVarString},
+	}
+	data := []byte{0x00, 0x00} // packet header, null mask
+	data = append(data, 0x2a, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00)
+	data = append(data, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xf8, 0x3f) // 1.5
+	data = append(data, 0x07, 0xe1, 0x07, 0x0c, 0x1f, 0x17, 0x3b, 0x3b) // 2017-12-31 23:59:59
+	data = append(data, 0x03, 'f', 'o', 'o')
+
+	rows := &binaryRows{iRows: iRows{
+		conn:    &Conn{cfg: &Config{ParseTime: true, Loc: time.UTC}},
+		columns: columns,
+		data:    data[2:],
+	}}
+	rows.nullMask = data[1:2]
+
+	row, err := rows.ScanMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, ok := row["id"].(int64); !ok || id != 42 {
+		t.Errorf("expected int64 42, got %#v", row["id"])
+	}
+	if score, ok := row["score"].(float64); !ok || score != 1.5 {
+		t.Errorf("expected float64 1.5, got %#v", row["score"])
+	}
+	expected := time.Date(2017, 12, 31, 23, 59, 59, 0, time.UTC)
+	if created, ok := row["created"].(time.Time); !ok || !created.Equal(expected) {
+		t.Errorf("expected time.Time %v, got %#v", expected, row["created"])
+	}
+	if row["name"] != "foo" {
+		t.Errorf("expected foo, got %#v", row["name"])
+	}
+}
+
+func TestRowScanMap(t *testing.T) {
+	nc := new(loopbackConn)
+	conn := newTestConn(nc, nil)
+
+	// two rows, then EOF
+	nc.data.Write([]byte{0x02, 0x00, 0x00, 0x00, 0x01, '1'})
+	nc.data.Write([]byte{0x02, 0x00, 0x00, 0x01, 0x01, '2'})
+	nc.data.Write([]byte{0x05, 0x00, 0x00, 0x02, iEOF, 0x00, 0x00, 0x00, 0x00})
+
+	row := &Row{rows: &textRows{iRows{
+		conn:    conn,
+		columns: []Field{{name: "id", fieldType: fieldTypeLongLong}},
+	}}}
+	m, err := row.ScanMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m) != 1 || m["id"] != "1" {
+		t.Errorf("unexpected row %#v", m)
+	}
+	if nc.data.Len() != 0 {
+		t.Error("expected the remaining rows to be discarded")
+	}
+
+	row = &Row{rows: emptyRows{}}
+	if _, err := row.ScanMap(); err != ErrNoRows {
+		t.Errorf("expected ErrNoRows, got %v", err)
+	}
+
+	row = &Row{err: ErrInvalidConn}
+	if _, err := row.ScanMap(); err != ErrInvalidConn {
+		t.Errorf("expected ErrInvalidConn, got %v", err)
+	}
+}
+
+func TestRowScanNoRows(t *testing.T) {
+	row := &Row{rows: emptyRows{}}
+	if err := row.Scan(new(string)); err != ErrNoRows {
+		t.Errorf("expected ErrNoRows, got %v", err)
+	}
+
+	// an error while reading the first row must not be reported as ErrNoRows
+	nc := new(loopbackConn)
+	conn := newTestConn(nc, nil)
+	payload := append([]byte{iERR, 0x25, 0x05, '#', '7', '0', '1', '0', '0'}, "Query execution was interrupted"...)
+	nc.data.Write([]byte{byte(len(payload)), 0x00, 0x00, 0x00})
+	nc.data.Write(payload)
+
+	row = &Row{rows: &textRows{iRows{
+		conn:    conn,
+		columns: []Field{{name: "value", fieldType: fieldTypeVarString}},
+	}}}
+	err := row.Scan(new(string))
+	if me, ok := err.(*Error); !ok || me.Number != 1317 {
+		t.Errorf("expected error 1317, got %v", err)
+	}
+}
+
+func TestRowsErr(t *testing.T) {
+	rows := &textRows{iRows{err: io.EOF}}
+	if err := rows.Err(); err != nil {
+		t.Errorf("expected nil error at the end of the rows, got %v", err)
+	}
+
+	rows.err = ErrInvalidConn
+	if err := rows.Err(); err != ErrInvalidConn {
+		t.Errorf("expected ErrInvalidConn, got %v", err)
+	}
+
+	empty := emptyRows{}
+	if empty.Next() {
+		t.Error("expected Next of empty rows to be false")
+	}
+	if err := empty.Err(); err != nil {
+		t.Errorf("expected nil error of empty rows, got %v", err)
+	}
+}
+
+func TestScanStruct(t *testing.T) {
+	type user struct {
+		ID       int64
+		Name     string `db:"user_name"`
+		Nick     *string
+		Note     sql.NullString
+		Password string `db:"-"`
+		secret   string
+	}
+
+	columns := []Field{
+		{name: "id", fieldType: fieldTypeLongLong},
+		{name: "user_name", fieldType: fieldTypeVarString},
+		{name: "nick", fieldType: fieldTypeVarString},
+		{name: "note", fieldType: fieldTypeVarString},
+		{name: "password", fieldType: fieldTypeVarString},
+		{name: "secret", fieldType: fieldTypeVarString},
+		{name: "unmatched", fieldType: fieldTypeVarString},
+	}
+	data := []byte{
+		0x01, '1',
+		0x03, 'f', 'o', 'o',
+		0xfb, // NULL
+		0xfb, // NULL
+		0x01, 'x',
+		0x01, 'y',
+		0x01, 'z',
+	}
+	rows := &textRows{iRows{conn: &Conn{cfg: &Config{}}, columns: columns, data: data}}
+
+	u := user{Nick: new(string)}
+	if err := rows.ScanStruct(&u); err != nil {
+		t.Fatal(err)
+	}
+	if u.ID != 1 || u.Name != "foo" || u.Nick != nil || u.Note.Valid ||
+		u.Password != "" || u.secret != "" {
+		t.Errorf("unexpected struct %+v", u)
+	}
+
+	// NULL into a non-pointer field
+	rows.data = []byte{0xfb, 0x01, 'a', 0xfb, 0xfb, 0xfb, 0xfb, 0xfb}
+	if err := rows.ScanStruct(&u); err == nil {
+		t.Error("expected error for NULL into int64")
+	}
+
+	rows.data = data
+	if err := rows.ScanStruct(u); err == nil {
+		t.Error("expected error for non-pointer destination")
+	}
+}
+
+// writeRowPackets writes the payload as packets to the loopback connection,
+// split into parts of maxPacketSize, and returns the next sequence id
+func writeRowPackets(nc *loopbackConn, seq byte, payload []byte) byte {
+	for {
+		n := len(payload)
+		if n > maxPacketSize {
+			n = maxPacketSize
+		}
+		nc.data.Write([]byte{byte(n), byte(n >> 8), byte(n >> 16), seq})
+		nc.data.Write(payload[:n])
+		payload = payload[n:]
+		seq++
+		if n < maxPacketSize {
+			return seq
+		}
+	}
+}
+
+func TestColumnReader(t *testing.T) {
+	nc := new(loopbackConn)
+	conn := newTestConn(nc, nil)
+
+	blob := make([]byte, maxPacketSize+1024)
+	for i := range blob {
+		blob[i] = byte(i % 251)
+	}
+	bigRow := []byte{0x01, '1', 0xfe}
+	bigRow = append(bigRow, byte(len(blob)), byte(len(blob)>>8), byte(len(blob)>>16), byte(len(blob)>>24), 0, 0, 0, 0)
+	bigRow = append(bigRow, blob...)
+
+	// streamed, scanned, skipped and small rows
+	seq := writeRowPackets(nc, 0, bigRow)
+	seq = writeRowPackets(nc, seq, bigRow)
+	seq = writeRowPackets(nc, seq, bigRow)
+	seq = writeRowPackets(nc, seq, []byte{0x01, '2', 0x03, 'f', 'o', 'o'})
+	writeRowPackets(nc, seq, []byte{iEOF, 0x00, 0x00, 0x00, 0x00})
+
+	rows := &textRows{iRows{
+		conn: conn,
+		columns: []Field{
+			{name: "id", fieldType: fieldTypeLongLong},
+			{name: "data", fieldType: fieldTypeLongBLOB},
+		},
+	}}
+
+	if !rows.Next() {
+		t.Fatal(rows.Err())
+	}
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, rows.ColumnReader(1)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), blob) {
+		t.Errorf("streamed value differs, got %d bytes", buf.Len())
+	}
+	var id int
+	var data []byte
+	if err := rows.Scan(&id, &data); err != errRowStreamed {
+		t.Errorf("expected errRowStreamed, got %v", err)
+	}
+
+	if !rows.Next() {
+		t.Fatal(rows.Err())
+	}
+	if err := rows.Scan(&id, &data); err != nil {
+		t.Fatal(err)
+	}
+	if id != 1 || !bytes.Equal(data, blob) {
+		t.Errorf("unexpected scanned row: id %d, %d bytes", id, len(data))
+	}
+
+	if !rows.Next() {
+		t.Fatal(rows.Err())
+	}
+	// not read, discarded by Next
+
+	if !rows.Next() {
+		t.Fatal(rows.Err())
+	}
+	buf.Reset()
+	if _, err := io.Copy(&buf, rows.ColumnReader(1)); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "foo" {
+		t.Errorf("expected foo, got %q", buf.String())
+	}
+	if err := rows.Scan(&id, &data); err != nil || id != 2 {
+		t.Errorf("expected id 2, got %d (%v)", id, err)
+	}
+
+	if rows.Next() {
+		t.Fatal("expected end of rows")
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rows.ColumnReader(0).Read(make([]byte, 1)); err != ErrNoRows {
+		t.Errorf("expected ErrNoRows, got %v", err)
+	}
+}
+
+func TestBinaryColumnReader(t *testing.T) {
+	columns := []Field{
+		{name: "id", fieldType: fieldTypeLongLong},
+		{name: "created", fieldType: fieldTypeDateTime},
+		{name: "note", fieldType: fieldTypeVarString},
+		{name: "name", fieldType: fieldTypeVarString},
+	}
+	data := []byte{0x00, 0x10} // packet header, null mask: note is NULL
+	data = append(data, 0x2a, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00)
+	data = append(data, 0x04, 0xe1, 0x07, 0x0c, 0x1f) // 2017-12-31
+	data = append(data, 0x03, 'f', 'o', 'o')
+
+	rows := &binaryRows{iRows: iRows{
+		conn:    &Conn{cfg: &Config{}},
+		columns: columns,
+		data:    data[2:],
+	}}
+	rows.nullMask = data[1:2]
+
+	value, err := ioutil.ReadAll(rows.ColumnReader(3))
+	if err != nil || string(value) != "foo" {
+		t.Errorf("expected foo, got %q (%v)", value, err)
+	}
+	value, err = ioutil.ReadAll(rows.ColumnReader(2))
+	if err != nil || len(value) != 0 {
+		t.Errorf("expected empty value for NULL, got %q (%v)", value, err)
+	}
+	if _, err = ioutil.ReadAll(rows.ColumnReader(0)); err == nil {
+		t.Error("expected error for integer column")
+	}
+	if _, err = ioutil.ReadAll(rows.ColumnReader(4)); err == nil {
+		t.Error("expected error for column index out of range")
+	}
+}
@@ -8,21 +8,40 @@
 
 package gmysql
 
+import (
+	"fmt"
+	"time"
+)
+
 // Stmt is a prepared statement.
 type Stmt struct {
 	conn       *Conn
 	id         uint32
 	paramCount int
-	columns    []Field // cached from the first query
+	columns    []Field // read from the prepare response
+	query      string
+	cached     bool // closed on eviction from the statement cache
+	generation uint // generation of conn the statement was prepared on
 }
 
 // Prepare creates a prepared statement for later queries or executions.
 // The caller must call the statement's Close method
 // when the statement is no longer needed.
+//
+// If the statement cache is enabled with the stmtCacheSize DSN param, a
+// previously prepared statement of the identical query is returned instead.
+// Close is a no-op for cached statements, they are closed once they are evicted
+// from the cache or the connection is closed.
 func (conn *Conn) Prepare(query string) (*Stmt, error) {
-	if conn.netConn == nil {
-		return nil, ErrInvalidConn
+	if err := conn.connect(); err != nil {
+		return nil, err
+	}
+	if conn.stmtCache != nil {
+		if stmt := conn.stmtCache.get(query); stmt != nil {
+			return stmt, nil
+		}
 	}
+
 	// Send command
 	err := conn.writeCommandPacketStr(comStmtPrepare, query)
 	if err != nil {
@@ -30,7 +49,9 @@ func (conn *Conn) Prepare(query string) (*Stmt, error) {
 	}
 
 	stmt := &Stmt{
-		conn: conn,
+		conn:       conn,
+		query:      query,
+		generation: conn.generation,
 	}
 
 	// Read Result
@@ -43,7 +64,18 @@ func (conn *Conn) Prepare(query string) (*Stmt, error) {
 		}
 
 		if columnCount > 0 {
-			err = conn.readUntilEOF()
+			stmt.columns, err = conn.readColumns(int(columnCount))
+		}
+	}
+
+	if err == nil && conn.stmtCache != nil {
+		stmt.cached = true
+		if evicted := conn.stmtCache.put(stmt); evicted != nil {
+			// the new statement is usable anyway, a broken connection is
+			// noticed by the next command
+			if cerr := evicted.close(); cerr != nil {
+				errLog.Print("closing evicted statement: ", cerr)
+			}
 		}
 	}
 
@@ -52,7 +84,24 @@ func (conn *Conn) Prepare(query string) (*Stmt, error) {
 
 // Close closes the statement.
 func (stmt *Stmt) Close() error {
-	if stmt.conn == nil || stmt.conn.netConn == nil {
+	if stmt.cached {
+		// cached statement, closed on eviction
+		return nil
+	}
+	return stmt.close()
+}
+
+// invalid reports whether the statement can not be used anymore, because it
+// was closed or its connection was closed or reconnected in the meantime.
+func (stmt *Stmt) invalid() bool {
+	return stmt.conn == nil || stmt.conn.netConn == nil ||
+		stmt.generation != stmt.conn.generation
+}
+
+func (stmt *Stmt) close() error {
+	if stmt.invalid() {
+		// the server already dropped it, the id might be reused
+		stmt.conn = nil
 		return ErrInvalidConn
 	}
 
@@ -66,12 +115,40 @@ func (stmt *Stmt) NumInput() int {
 	return stmt.paramCount
 }
 
+// Columns returns the column names of the rows the statement returns, as
+// reported by the server when it was prepared. It returns nil if the statement
+// returns no rows, e.g. for an INSERT.
+func (stmt *Stmt) Columns() []string {
+	if stmt.columns == nil {
+		return nil
+	}
+	withAlias := stmt.conn != nil && stmt.conn.cfg != nil && stmt.conn.cfg.ColumnsWithAlias
+	return columnNames(stmt.columns, withAlias)
+}
+
+// ColumnTypes returns the column information of the rows the statement
+// returns, like Rows.ColumnTypes, as reported by the server when it was
+// prepared. It returns nil if the statement returns no rows.
+func (stmt *Stmt) ColumnTypes() []*ColumnType {
+	if stmt.columns == nil {
+		return nil
+	}
+	return columnTypes(stmt.columns)
+}
+
 // Exec executes a prepared statement with the given arguments and returns a
 // Result summarizing the effect of the statement.
 func (stmt *Stmt) Exec(args ...interface{}) (*Result, error) {
-	if stmt.conn.netConn == nil {
+	if stmt.invalid() {
 		return nil, ErrInvalidConn
 	}
+	done := stmt.conn.runHooks(stmt.query)
+	res, err := stmt.exec(args)
+	done(err)
+	return res, err
+}
+
+func (stmt *Stmt) exec(args []interface{}) (*Result, error) {
 	// Send command
 	err := stmt.writeExecutePacket(args)
 	if err != nil {
@@ -81,6 +158,8 @@ func (stmt *Stmt) Exec(args ...interface{}) (*Result, error) {
 	conn := stmt.conn
 	conn.affectedRows = 0
 	conn.insertID = 0
+	conn.warnings = 0
+	conn.info = ""
 
 	// Read Result
 	resLen, err := conn.readResultSetHeaderPacket()
@@ -96,22 +175,163 @@ func (stmt *Stmt) Exec(args ...interface{}) (*Result, error) {
 			err = conn.readUntilEOF()
 		}
 		if err == nil {
-			return &Result{
-				affectedRows: int64(conn.affectedRows),
-				insertID:     int64(conn.insertID),
-			}, nil
+			// Read results of further statements, e.g. of a CALL
+			err = conn.discardResults()
 		}
 	}
+	if _, ok := err.(Warnings); err == nil || ok {
+		return &Result{
+			affectedRows: int64(conn.affectedRows),
+			insertID:     int64(conn.insertID),
+			warnings:     int(conn.warnings),
+			info:         conn.info,
+		}, err
+	}
 
 	return nil, err
 }
 
+// ExecBatch executes the prepared statement once for each of the argument lists,
+// e.g. to insert many rows. It returns a Result with the sum of the affected
+// rows and warnings and the insert ID of the first execution.
+//
+// INSERT and REPLACE statements with a single VALUES list, like
+// "INSERT INTO foo (a, b) VALUES (?, ?)", are not executed once per argument
+// list. Instead the args are interpolated into as few multi-row INSERT
+// queries as the max_allowed_packet permits, unless interpolateParams=false is
+// set. Argument lists which can not be interpolated are executed separately.
+//
+// The batch is aborted on the first error. Use a transaction to make it
+// atomic. In strict mode, the Warnings of all executions are returned together
+// with the Result once the batch is complete.
+func (stmt *Stmt) ExecBatch(argsList [][]interface{}) (*Result, error) {
+	if stmt.invalid() {
+		return nil, ErrInvalidConn
+	}
+	conn := stmt.conn
+
+	res := new(Result)
+	var warnings Warnings
+	add := func(r *Result, err error) error {
+		if w, ok := err.(Warnings); ok {
+			// strict mode, keep going like Exec does
+			warnings = append(warnings, w...)
+		} else if err != nil {
+			return err
+		}
+		if res.insertID == 0 {
+			res.insertID = r.insertID
+		}
+		res.affectedRows += r.affectedRows
+		res.warnings += r.warnings
+		return nil
+	}
+	result := func() (*Result, error) {
+		if warnings != nil {
+			return res, warnings
+		}
+		return res, nil
+	}
+
+	head, values, tail, ok := splitInsertValues(stmt.query)
+	if !ok || conn.cfg.NoInterpolateParams {
+		for _, args := range argsList {
+			if err := add(stmt.Exec(args...)); err != nil {
+				return nil, err
+			}
+		}
+		return result()
+	}
+
+	// multi-row query, sent once the next row does not fit anymore
+	var query []byte
+	rows := 0
+	flush := func() error {
+		if rows == 0 {
+			return nil
+		}
+		query = append(query, tail...)
+		r, err := conn.Exec(string(query))
+		if err = add(&r, err); err != nil {
+			return err
+		}
+		query = query[:0]
+		rows = 0
+		return nil
+	}
+
+	for _, args := range argsList {
+		if len(args) != stmt.paramCount {
+			return nil, fmt.Errorf(
+				"Arguments count mismatch (Got: %d Has: %d)",
+				len(args),
+				stmt.paramCount,
+			)
+		}
+
+		row, err := conn.interpolateParams(values, args)
+		if err == nil && len(head)+len(row)+len(tail)+4 > conn.maxPacketAllowed {
+			// the row does not even fit into a query on its own
+			err = ErrPktTooLarge
+		}
+		if err == ErrUnsafeInterpolate || err == ErrPktTooLarge {
+			// execute the prepared statement for these args instead
+			if err = flush(); err != nil {
+				return nil, err
+			}
+			if err = add(stmt.Exec(args...)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if rows > 0 && len(query)+1+len(row)+len(tail)+4 > conn.maxPacketAllowed {
+			if err = flush(); err != nil {
+				return nil, err
+			}
+		}
+		if rows == 0 {
+			query = append(query, head...)
+		} else {
+			query = append(query, ',')
+		}
+		query = append(query, row...)
+		rows++
+	}
+
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return result()
+}
+
+// ExecTimeout executes a prepared statement like Exec, but returns ErrBadConn
+// if the result is not received within the timeout d. The connection is closed
+// in that case, since its state is unknown.
+func (stmt *Stmt) ExecTimeout(d time.Duration, args ...interface{}) (*Result, error) {
+	if stmt.invalid() {
+		return nil, ErrInvalidConn
+	}
+	defer stmt.conn.setDeadline(d)()
+	return stmt.Exec(args...)
+}
+
 // Query executes a prepared query statement with the given arguments and
 // returns the query results as a *Rows
 func (stmt *Stmt) Query(args ...interface{}) (Rows, error) {
-	if stmt.conn.netConn == nil {
+	if stmt.invalid() {
 		return nil, ErrInvalidConn
 	}
+	done := stmt.conn.runHooks(stmt.query)
+	rows, err := stmt.queryRows(args)
+	done(err)
+	return rows, err
+}
+
+func (stmt *Stmt) queryRows(args []interface{}) (Rows, error) {
 	// Send command
 	err := stmt.writeExecutePacket(args)
 	if err != nil {
@@ -129,16 +349,58 @@ func (stmt *Stmt) Query(args ...interface{}) (Rows, error) {
 	br := new(binaryRows)
 	br.conn = conn
 
-	if resLen > 0 {
-		// Columns
-		// If not cached, read them and cache them
-		if stmt.columns == nil {
-			stmt.columns, err = conn.readColumns(resLen)
-		} else {
-			err = conn.readUntilEOF()
+	if resLen == 0 {
+		if conn.status&statusMoreResultsExists == 0 {
+			// no columns, no more data
+			return emptyRows{}, nil
 		}
-		br.columns = stmt.columns
+		// no columns, but further result sets follow
+		br.done = true
+		return br, nil
+	}
+
+	// Columns
+	// The server sends them with each execution. The columns of the prepare
+	// response are kept unless they changed, e.g. by an ALTER TABLE, since
+	// the rows must be decoded with the current types.
+	columns, err := conn.readColumns(resLen)
+	if err == nil && !sameFields(stmt.columns, columns) {
+		stmt.columns = columns
 	}
+	br.columns = stmt.columns
 
 	return br, err
 }
+
+// QueryTimeout executes a prepared query statement like Query, but returns
+// ErrBadConn if the result set header and the columns are not received within
+// the timeout d. The connection is closed in that case, since its state is
+// unknown. Reading the rows afterwards is not affected by the timeout.
+func (stmt *Stmt) QueryTimeout(d time.Duration, args ...interface{}) (Rows, error) {
+	if stmt.invalid() {
+		return nil, ErrInvalidConn
+	}
+	defer stmt.conn.setDeadline(d)()
+	return stmt.Query(args...)
+}
+
+// QueryRow executes a prepared query statement that is expected to return at
+// most one row. QueryRow always returns a non-nil value. Errors are deferred
+// until Row's Scan method is called.
+func (stmt *Stmt) QueryRow(args ...interface{}) *Row {
+	rows, err := stmt.Query(args...)
+	return &Row{rows: rows, err: err}
+}
+
+// sameFields reports whether the column definitions a and b are equal
+func sameFields(a, b []Field) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
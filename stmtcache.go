@@ -0,0 +1,61 @@
+// gmysql - A MySQL package for Go
+//
+// Copyright 2016 The gmysql Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package gmysql
+
+import (
+	"container/list"
+)
+
+// stmtCache is a LRU cache of prepared statements, keyed by their query.
+type stmtCache struct {
+	size  int
+	ll    *list.List // most recently used statement first
+	items map[string]*list.Element
+}
+
+func newStmtCache(size int) *stmtCache {
+	return &stmtCache{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element, size),
+	}
+}
+
+// get returns the cached statement for the query or nil if there is none
+func (c *stmtCache) get(query string) *Stmt {
+	if e, ok := c.items[query]; ok {
+		c.ll.MoveToFront(e)
+		return e.Value.(*Stmt)
+	}
+	return nil
+}
+
+// put adds the statement to the cache. If the cache is full, the least
+// recently used statement is removed from the cache and returned.
+func (c *stmtCache) put(stmt *Stmt) (evicted *Stmt) {
+	c.items[stmt.query] = c.ll.PushFront(stmt)
+
+	if c.ll.Len() > c.size {
+		e := c.ll.Back()
+		evicted = c.ll.Remove(e).(*Stmt)
+		delete(c.items, evicted.query)
+	}
+	return
+}
+
+// clear removes all statements from the cache and invalidates them.
+// It must be called when the connection is closed, since the server releases
+// all statements of a connection then.
+func (c *stmtCache) clear() {
+	for e := c.ll.Front(); e != nil; e = e.Next() {
+		e.Value.(*Stmt).conn = nil
+	}
+	c.ll.Init()
+	c.items = make(map[string]*list.Element, c.size)
+}
@@ -0,0 +1,80 @@
+// gmysql - A MySQL package for Go
+//
+// Copyright 2016 The gmysql Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package gmysql
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStmtCacheLRU(t *testing.T) {
+	conn := new(Conn)
+	c := newStmtCache(2)
+
+	s1 := &Stmt{conn: conn, query: "SELECT 1"}
+	s2 := &Stmt{conn: conn, query: "SELECT 2"}
+	s3 := &Stmt{conn: conn, query: "SELECT 3"}
+
+	if evicted := c.put(s1); evicted != nil {
+		t.Errorf("unexpected eviction of %q", evicted.query)
+	}
+	if evicted := c.put(s2); evicted != nil {
+		t.Errorf("unexpected eviction of %q", evicted.query)
+	}
+
+	// s1 is now the most recently used statement
+	if stmt := c.get("SELECT 1"); stmt != s1 {
+		t.Errorf("expected cached statement for %q, got %v", s1.query, stmt)
+	}
+	if evicted := c.put(s3); evicted != s2 {
+		t.Errorf("expected eviction of %q, got %v", s2.query, evicted)
+	}
+	if stmt := c.get("SELECT 2"); stmt != nil {
+		t.Errorf("expected %q to be evicted, got %v", s2.query, stmt)
+	}
+
+	c.clear()
+	if stmt := c.get("SELECT 1"); stmt != nil {
+		t.Errorf("expected empty cache, got %v", stmt)
+	}
+	if s1.conn != nil || s3.conn != nil {
+		t.Error("expected cleared statements to be invalidated")
+	}
+
+	// invalidated statements must not panic
+	if _, err := s1.Exec(); err != ErrInvalidConn {
+		t.Errorf("expected ErrInvalidConn, got %v", err)
+	}
+}
+
+func TestPrepareEvictionCloseError(t *testing.T) {
+	previous := errLog
+	defer func() {
+		errLog = previous
+	}()
+	logger := new(testLogger)
+	SetLogger(logger)
+
+	conn, server, _ := newResponderConn(nil, testPrepareResponse())
+	defer server.Close()
+	conn.stmtCache = newStmtCache(1)
+	// closing the evicted statement fails, its connection is closed
+	conn.stmtCache.put(&Stmt{conn: &Conn{}, query: "SELECT 1", cached: true})
+
+	stmt, err := conn.Prepare("SELECT id, name FROM test WHERE id = ?")
+	if err != nil {
+		t.Fatalf("expected the statement without error, got %v", err)
+	}
+	if stmt == nil || conn.stmtCache.get(stmt.query) != stmt {
+		t.Error("expected the statement to be cached")
+	}
+	if len(logger.lines) != 1 || !strings.Contains(logger.lines[0], ErrInvalidConn.Error()) {
+		t.Errorf("expected the close error to be logged, got %q", logger.lines)
+	}
+}
@@ -0,0 +1,89 @@
+// gmysql - A MySQL package for Go
+//
+// Copyright 2016 The gmysql Authors. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package gmysql
+
+// Tx is an in-progress database transaction.
+//
+// A transaction must end with a call to Commit or Rollback.
+//
+// After a call to Commit or Rollback, all operations on the transaction fail
+// with ErrTxDone.
+type Tx struct {
+	conn       *Conn
+	generation uint // generation of conn the transaction was started on
+}
+
+// Begin starts a transaction.
+func (conn *Conn) Begin() (*Tx, error) {
+	if err := conn.connect(); err != nil {
+		return nil, err
+	}
+	if err := conn.exec("START TRANSACTION"); err != nil {
+		return nil, err
+	}
+	return &Tx{conn: conn, generation: conn.generation}, nil
+}
+
+// broken reports whether the connection of the transaction was closed or
+// reconnected in the meantime, which ended the transaction on the server.
+func (tx *Tx) broken() bool {
+	return tx.conn.netConn == nil || tx.conn.generation != tx.generation
+}
+
+// Commit commits the transaction.
+func (tx *Tx) Commit() (err error) {
+	if tx.conn == nil {
+		return ErrTxDone
+	}
+	if tx.broken() {
+		tx.conn = nil
+		return ErrInvalidConn
+	}
+	err = tx.conn.exec("COMMIT")
+	tx.conn = nil
+	return
+}
+
+// Rollback aborts the transaction.
+func (tx *Tx) Rollback() (err error) {
+	if tx.conn == nil {
+		return ErrTxDone
+	}
+	if tx.broken() {
+		tx.conn = nil
+		return ErrInvalidConn
+	}
+	err = tx.conn.exec("ROLLBACK")
+	tx.conn = nil
+	return
+}
+
+// Exec executes a query within the transaction without returning any rows.
+// The args are for any placeholder parameters in the query.
+func (tx *Tx) Exec(query string, args ...interface{}) (Result, error) {
+	if tx.conn == nil {
+		return Result{}, ErrTxDone
+	}
+	if tx.broken() {
+		return Result{}, ErrInvalidConn
+	}
+	return tx.conn.Exec(query, args...)
+}
+
+// Query executes a query within the transaction that returns rows, typically
+// a SELECT. The args are for any placeholder parameters in the query.
+func (tx *Tx) Query(query string, args ...interface{}) (Rows, error) {
+	if tx.conn == nil {
+		return nil, ErrTxDone
+	}
+	if tx.broken() {
+		return nil, ErrInvalidConn
+	}
+	return tx.conn.Query(query, args...)
+}
@@ -9,11 +9,19 @@
 package gmysql
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/sha1"
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/binary"
+	"encoding/pem"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -50,7 +58,7 @@ func init() {
 //  db, err := sql.Open("mysql", "user@tcp(localhost:3306)/test?tls=custom")
 //
 func RegisterTLSConfig(key string, config *tls.Config) error {
-	if _, isBool := readBool(key); isBool || strings.ToLower(key) == "skip-verify" {
+	if _, isBool := readBool(key); isBool || strings.ToLower(key) == "skip-verify" || strings.ToLower(key) == "preferred" {
 		return fmt.Errorf("Key '%s' is reserved", key)
 	}
 
@@ -58,6 +66,45 @@ func RegisterTLSConfig(key string, config *tls.Config) error {
 	return nil
 }
 
+// RegisterTLSConfigFiles loads the PEM encoded CA certificate and client
+// key pair from the given files and registers the resulting tls.Config
+// under key, like RegisterTLSConfig.
+// If caFile is empty, the host's root CA set is used. If certFile and
+// keyFile are empty, no client certificate is presented.
+//
+//  err := mysql.RegisterTLSConfigFiles("custom", "/path/ca-cert.pem",
+//      "/path/client-cert.pem", "/path/client-key.pem")
+//  if err != nil {
+//      log.Fatal(err)
+//  }
+//  db, err := sql.Open("mysql", "user@tcp(localhost:3306)/test?tls=custom")
+//
+func RegisterTLSConfigFiles(key, caFile, certFile, keyFile string) error {
+	config := &tls.Config{}
+
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return err
+		}
+		rootCertPool := x509.NewCertPool()
+		if ok := rootCertPool.AppendCertsFromPEM(pem); !ok {
+			return fmt.Errorf("No PEM encoded certificates found in '%s'", caFile)
+		}
+		config.RootCAs = rootCertPool
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return RegisterTLSConfig(key, config)
+}
+
 // DeregisterTLSConfig removes the tls.Config associated with key.
 func DeregisterTLSConfig(key string) {
 	delete(tlsConfigRegister, key)
@@ -111,6 +158,58 @@ func scramblePassword(scramble, password []byte) []byte {
 	return scramble
 }
 
+// Encrypt password using the SHA256 method of caching_sha2_password
+func scrambleSHA256Password(scramble, password []byte) []byte {
+	if len(password) == 0 {
+		return nil
+	}
+
+	// XOR(SHA256(password), SHA256(SHA256(SHA256(password)), scramble))
+	crypt := sha256.New()
+	crypt.Write(password)
+	message1 := crypt.Sum(nil)
+
+	crypt.Reset()
+	crypt.Write(message1)
+	message1Hash := crypt.Sum(nil)
+
+	crypt.Reset()
+	crypt.Write(message1Hash)
+	crypt.Write(scramble)
+	message2 := crypt.Sum(nil)
+
+	for i := range message1 {
+		message1[i] ^= message2[i]
+	}
+	return message1
+}
+
+// Encrypt the NUL terminated password XOR scramble with the RSA public key of
+// the server, for sha256_password and caching_sha2_password without TLS
+func encryptPassword(scramble, password, pemKey []byte) ([]byte, error) {
+	block, _ := pem.Decode(pemKey)
+	if block == nil {
+		return nil, ErrMalformPkt
+	}
+	pkix, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	pub, ok := pkix.(*rsa.PublicKey)
+	if !ok {
+		return nil, ErrMalformPkt
+	}
+
+	plain := make([]byte, len(password)+1)
+	copy(plain, password)
+	if len(scramble) > 0 {
+		for i := range plain {
+			plain[i] ^= scramble[i%len(scramble)]
+		}
+	}
+	return rsa.EncryptOAEP(sha1.New(), rand.Reader, pub, plain, nil)
+}
+
 // Encrypt password using pre 4.1 (old password) method
 // https://github.com/atcurtis/mariadb/blob/master/mysys/my_rnd.c
 type myRnd struct {
@@ -301,6 +400,78 @@ func parseBinaryDateTime(num uint64, data []byte, loc *time.Location) (interface
 	return nil, fmt.Errorf("Invalid DATETIME-packet length %d", num)
 }
 
+// parses a TIME value of the form [-]HH:MM:SS[.fractal] into a time.Duration.
+// The hours may exceed 24, MySQL allows up to 838:59:59.
+func parseDuration(str string) (time.Duration, error) {
+	s := str
+	neg := len(s) > 0 && s[0] == '-'
+	if neg {
+		s = s[1:]
+	}
+
+	var frac string
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		s, frac = s[:i], s[i+1:]
+		if len(frac) == 0 {
+			return 0, fmt.Errorf("Invalid TIME-String: %s", str)
+		}
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 || len(frac) > 9 {
+		return 0, fmt.Errorf("Invalid TIME-String: %s", str)
+	}
+
+	var d time.Duration
+	for i, unit := range []time.Duration{time.Hour, time.Minute, time.Second} {
+		n, err := strconv.ParseUint(parts[i], 10, 32)
+		if err != nil || (i > 0 && n > 59) {
+			return 0, fmt.Errorf("Invalid TIME-String: %s", str)
+		}
+		d += time.Duration(n) * unit
+	}
+	if len(frac) > 0 {
+		n, err := strconv.ParseUint(frac, 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid TIME-String: %s", str)
+		}
+		for i := len(frac); i < 9; i++ {
+			n *= 10
+		}
+		d += time.Duration(n)
+	}
+
+	if neg {
+		d = -d
+	}
+	return d, nil
+}
+
+// parses a TIME value of the binary protocol into a time.Duration
+// http://dev.mysql.com/doc/internals/en/binary-protocol-value.html#packet-ProtocolBinary::MYSQL_TYPE_TIME
+func parseBinaryDuration(data []byte) (time.Duration, error) {
+	switch len(data) {
+	case 0:
+		return 0, nil
+	case 8, 12:
+	default:
+		return 0, fmt.Errorf("Invalid TIME-packet length %d", len(data))
+	}
+
+	d := time.Duration(binary.LittleEndian.Uint32(data[1:5]))*24*time.Hour + // days
+		time.Duration(data[5])*time.Hour + // hours
+		time.Duration(data[6])*time.Minute + // minutes
+		time.Duration(data[7])*time.Second // seconds
+	if len(data) == 12 {
+		d += time.Duration(binary.LittleEndian.Uint32(data[8:12])) * time.Microsecond
+	}
+
+	// is_negative [1 byte]
+	if data[0] == 1 {
+		d = -d
+	}
+	return d, nil
+}
+
 // zeroDateTime is used in formatBinaryDateTime to avoid an allocation
 // if the DATE or DATETIME has the zero value.
 // It must never be changed.
@@ -310,6 +481,44 @@ var zeroDateTime = []byte("0000-00-00 00:00:00.000000")
 const digits01 = "0123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789"
 const digits10 = "0000000000111111111122222222223333333333444444444455555555556666666666777777777788888888889999999999"
 
+// appendDateTime appends t as "YYYY-MM-DD HH:MM:SS.MMMMMM" to buf. The time is
+// rounded to microseconds. The fractional seconds are always included, so
+// DATETIME(6) values round-trip losslessly.
+func appendDateTime(buf []byte, t time.Time) []byte {
+	t = t.Add(time.Nanosecond * 500) // To round under microsecond
+	year := t.Year()
+	year100 := year / 100
+	year1 := year % 100
+	month := t.Month()
+	day := t.Day()
+	hour := t.Hour()
+	minute := t.Minute()
+	second := t.Second()
+	micro := t.Nanosecond() / 1000
+	micro10000 := micro / 10000
+	micro100 := micro / 100 % 100
+	micro1 := micro % 100
+
+	return append(buf,
+		digits10[year100], digits01[year100],
+		digits10[year1], digits01[year1],
+		'-',
+		digits10[month], digits01[month],
+		'-',
+		digits10[day], digits01[day],
+		' ',
+		digits10[hour], digits01[hour],
+		':',
+		digits10[minute], digits01[minute],
+		':',
+		digits10[second], digits01[second],
+		'.',
+		digits10[micro10000], digits01[micro10000],
+		digits10[micro100], digits01[micro100],
+		digits10[micro1], digits01[micro1],
+	)
+}
+
 func formatBinaryDateTime(src []byte, length uint8, justTime bool) (interface{}, error) {
 	// length expects the deterministic length of the zero value,
 	// negative time and 100+ hours are automatically added if needed
@@ -494,12 +703,173 @@ func stringToInt(b []byte) int {
 	return val
 }
 
+// reads the 2 byte server status flags
+func readStatus(b []byte) statusFlag {
+	return statusFlag(b[0]) | statusFlag(b[1])<<8
+}
+
+// reports whether a server with the given version string supports the utf8mb4
+// charset, which was added in MySQL 5.5.3
+func supportsUtf8mb4(version string) bool {
+	var major, minor, patch int
+	if _, err := fmt.Sscanf(version, "%d.%d.%d", &major, &minor, &patch); err != nil {
+		// unknown version format, assume a recent server
+		return true
+	}
+	switch {
+	case major != 5:
+		return major > 5
+	case minor != 5:
+		return minor > 5
+	default:
+		return patch >= 3
+	}
+}
+
+// inserts a MAX_EXECUTION_TIME optimizer hint with the given milliseconds after
+// the SELECT keyword of the query. Reports false if the query is no SELECT.
+func addMaxExecTimeHint(query string, ms int) (string, bool) {
+	start := len(query) - len(strings.TrimLeft(query, " \t\r\n"))
+	end := start + len("SELECT")
+	if len(query) < end || !strings.EqualFold(query[start:end], "SELECT") {
+		return query, false
+	}
+	if len(query) > end {
+		switch query[end] {
+		case ' ', '\t', '\r', '\n', '(':
+		default:
+			// e.g. SELECTED
+			return query, false
+		}
+	}
+	return query[:end] + " /*+ MAX_EXECUTION_TIME(" + strconv.Itoa(ms) + ") */" + query[end:], true
+}
+
+// reports whether the query only reads, i.e. starts with SELECT, SHOW,
+// DESCRIBE, DESC or EXPLAIN, so it can be retried safely
+func isReadQuery(query string) bool {
+	query = strings.TrimLeft(query, " \t\r\n(")
+	end := 0
+	for end < len(query) && isIdentChar(query[end]) {
+		end++
+	}
+	switch strings.ToUpper(query[:end]) {
+	case "SELECT", "SHOW", "DESCRIBE", "DESC", "EXPLAIN":
+		return true
+	}
+	return false
+}
+
+// reports whether err is a network timeout, e.g. of a deadline
+func isTimeout(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Timeout()
+}
+
+// reports whether name is a valid system variable name, which can be used
+// unquoted in a query
+func isVarName(name string) bool {
+	if len(name) == 0 {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// returns the charset of the collation, which is the prefix of its name,
+// e.g. utf8mb4 for utf8mb4_0900_ai_ci
+func collationCharset(name string) string {
+	if i := strings.IndexByte(name, '_'); i > 0 {
+		return name[:i]
+	}
+	return name
+}
+
+// splits an INSERT or REPLACE query with a single VALUES list into the part
+// before the list, the list including its parentheses and the part after it,
+// e.g. an ON DUPLICATE KEY UPDATE clause. Reports false if the query has
+// another form or if placeholders are outside of the list.
+func splitInsertValues(query string) (head, values, tail string, ok bool) {
+	trimmed := strings.TrimLeft(query, " \t\r\n")
+	if !(len(trimmed) > 6 && strings.EqualFold(trimmed[:6], "INSERT")) &&
+		!(len(trimmed) > 7 && strings.EqualFold(trimmed[:7], "REPLACE")) {
+		return
+	}
+
+	// find the VALUES keyword
+	start := -1
+	for i := 1; i+len("VALUES") < len(query); i++ {
+		if !strings.EqualFold(query[i:i+len("VALUES")], "VALUES") {
+			continue
+		}
+		switch query[i-1] {
+		case ' ', '\t', '\r', '\n', ')':
+		default:
+			continue
+		}
+		start = i + len("VALUES")
+		break
+	}
+	if start < 0 {
+		return
+	}
+	for start < len(query) && strings.IndexByte(" \t\r\n", query[start]) >= 0 {
+		start++
+	}
+	if start == len(query) || query[start] != '(' {
+		return
+	}
+
+	// find the matching closing parenthesis, skipping string literals
+	end, depth := -1, 0
+	var quote byte
+	for i := start; i < len(query) && end < 0; i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				end = i + 1
+			}
+		}
+	}
+	if end < 0 {
+		return
+	}
+
+	head, values, tail = query[:start], query[start:end], query[end:]
+	if strings.IndexByte(head, '?') >= 0 || strings.IndexByte(tail, '?') >= 0 ||
+		strings.HasPrefix(strings.TrimLeft(tail, " \t\r\n"), ",") {
+		// placeholders outside of the list or multiple lists
+		return "", "", "", false
+	}
+	return head, values, tail, true
+}
+
 // returns the string read as a bytes slice, wheter the value is NULL,
 // the number of bytes read and an error, in case the string is longer than
 // the input slice
 func readLengthEncodedString(b []byte) ([]byte, bool, int, error) {
 	// Get length
 	num, isNull, n := readLengthEncodedInteger(b)
+	if len(b) < n {
+		return nil, false, n, io.EOF
+	}
 	if num < 1 {
 		return b[n:n], isNull, n, nil
 	}
@@ -518,6 +888,9 @@ func readLengthEncodedString(b []byte) ([]byte, bool, int, error) {
 func skipLengthEncodedString(b []byte) (int, error) {
 	// Get length
 	num, _, n := readLengthEncodedInteger(b)
+	if len(b) < n {
+		return n, io.EOF
+	}
 	if num < 1 {
 		return n, nil
 	}
@@ -531,7 +904,8 @@ func skipLengthEncodedString(b []byte) (int, error) {
 	return n, io.EOF
 }
 
-// returns the number read, whether the value is NULL and the number of bytes read
+// returns the number read, whether the value is NULL and the number of bytes read.
+// If b is too short, the returned number of bytes exceeds its length.
 func readLengthEncodedInteger(b []byte) (uint64, bool, int) {
 	// See issue #349
 	if len(b) == 0 {
@@ -545,14 +919,23 @@ func readLengthEncodedInteger(b []byte) (uint64, bool, int) {
 
 	// 252: value of following 2
 	case 0xfc:
+		if len(b) < 3 {
+			return 0, false, 3
+		}
 		return uint64(b[1]) | uint64(b[2])<<8, false, 3
 
 	// 253: value of following 3
 	case 0xfd:
+		if len(b) < 4 {
+			return 0, false, 4
+		}
 		return uint64(b[1]) | uint64(b[2])<<8 | uint64(b[3])<<16, false, 4
 
 	// 254: value of following 8
 	case 0xfe:
+		if len(b) < 9 {
+			return 0, false, 9
+		}
 		return uint64(b[1]) | uint64(b[2])<<8 | uint64(b[3])<<16 |
 				uint64(b[4])<<24 | uint64(b[5])<<32 | uint64(b[6])<<40 |
 				uint64(b[7])<<48 | uint64(b[8])<<56,
@@ -727,3 +1110,11 @@ func escapeStringQuotes(buf []byte, v string) []byte {
 
 	return buf[:pos]
 }
+
+// QuoteIdentifier quotes name with backticks for the use as identifier in a
+// query, e.g. as a table or column name, which can not be passed as arg.
+// Backticks in name are doubled, so it can not end the quoted identifier.
+// A qualified name like db.table must be quoted part by part.
+func QuoteIdentifier(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
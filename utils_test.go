@@ -10,8 +10,18 @@ package gmysql
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/binary"
+	"encoding/pem"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -90,6 +100,17 @@ func TestLengthEncodedInteger(t *testing.T) {
 		if !bytes.Equal(encoded, tst.encoded) {
 			t.Errorf("%v: expected %x, got %x", num, tst.encoded, encoded)
 		}
+
+		// truncated input must not panic
+		if len(tst.encoded) > 1 {
+			truncated := tst.encoded[:len(tst.encoded)-1]
+			if _, _, numLen := readLengthEncodedInteger(truncated); numLen <= len(truncated) {
+				t.Errorf("%x: expected size beyond the input, got %d", truncated, numLen)
+			}
+			if _, _, _, err := readLengthEncodedString(truncated); err != io.EOF {
+				t.Errorf("%x: expected io.EOF, got %v", truncated, err)
+			}
+		}
 	}
 }
 
@@ -112,6 +133,26 @@ func TestOldPass(t *testing.T) {
 	}
 }
 
+func TestScrambleSHA256Pass(t *testing.T) {
+	scramble := []byte{10, 47, 74, 111, 75, 73, 34, 48, 88, 76, 114, 74, 37, 13, 3, 80, 82, 2, 23, 21}
+	vectors := []struct {
+		pass string
+		out  string
+	}{
+		{"secret", "f490e76f66d9d86665ce54d98c78d0acfe2fb0b08b423da807144873d30b312c"},
+		{"secret2", "abc3934a012cf342e876071c8ee202de51785b430258a7a0138bc79c4d800bc6"},
+	}
+	for _, tuple := range vectors {
+		ours := scrambleSHA256Password(scramble, []byte(tuple.pass))
+		if tuple.out != fmt.Sprintf("%x", ours) {
+			t.Errorf("Failed SHA256 password %q", tuple.pass)
+		}
+	}
+	if ours := scrambleSHA256Password(scramble, nil); ours != nil {
+		t.Errorf("expected nil for empty password, got %x", ours)
+	}
+}
+
 func TestFormatBinaryDateTime(t *testing.T) {
 	rawDate := [11]byte{}
 	binary.LittleEndian.PutUint16(rawDate[:2], 1978)   // years
@@ -141,6 +182,24 @@ func TestFormatBinaryDateTime(t *testing.T) {
 	expect("1978-12-30 15:46:23.987654", 11, 26)
 }
 
+func TestAppendDateTime(t *testing.T) {
+	var dateTimeTests = []struct {
+		in       time.Time
+		expected string
+	}{
+		{time.Date(2011, 11, 20, 21, 27, 37, 0, time.UTC), "2011-11-20 21:27:37.000000"},
+		{time.Date(2011, 11, 20, 21, 27, 37, 1000, time.UTC), "2011-11-20 21:27:37.000001"},
+		{time.Date(2011, 11, 20, 21, 27, 37, 1499, time.UTC), "2011-11-20 21:27:37.000001"},
+		{time.Date(2011, 11, 20, 21, 27, 37, 1500, time.UTC), "2011-11-20 21:27:37.000002"},
+		{time.Date(1999, 12, 31, 23, 59, 59, 999999500, time.UTC), "2000-01-01 00:00:00.000000"},
+	}
+	for _, tst := range dateTimeTests {
+		if actual := string(appendDateTime(nil, tst.in)); actual != tst.expected {
+			t.Errorf("%v: expected %q, got %q", tst.in, tst.expected, actual)
+		}
+	}
+}
+
 func TestEscapeBackslash(t *testing.T) {
 	expect := func(expected, value string) {
 		actual := string(escapeBytesBackslash([]byte{}, []byte(value)))
@@ -167,6 +226,7 @@ func TestEscapeBackslash(t *testing.T) {
 	expect("foo\\\"bar", "foo\"bar")
 	expect("foo\\\\bar", "foo\\bar")
 	expect("foo\\'bar", "foo'bar")
+	expect("foo\\'\U0001F600\\\\", "foo'\U0001F600\\") // 4-byte UTF-8
 }
 
 func TestEscapeQuotes(t *testing.T) {
@@ -194,4 +254,202 @@ func TestEscapeQuotes(t *testing.T) {
 	expect("foo\x1abar", "foo\x1abar") // not affected
 	expect("foo''bar", "foo'bar")      // affected
 	expect("foo\"bar", "foo\"bar")     // not affected
+
+	expect("''\U0001F600", "'\U0001F600") // 4-byte UTF-8
+}
+
+func TestQuoteIdentifier(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"test", "`test`"},
+		{"weird`name", "`weird``name`"},
+		{"``", "``````"},
+		{"a` FROM test; DROP TABLE test; --", "`a`` FROM test; DROP TABLE test; --`"},
+		{"db.table", "`db.table`"},
+		{"", "``"},
+	}
+	for _, tst := range tests {
+		if quoted := QuoteIdentifier(tst.name); quoted != tst.expected {
+			t.Errorf("%q: expected %s, got %s", tst.name, tst.expected, quoted)
+		}
+	}
+}
+
+func TestAddMaxExecTimeHint(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+		ok       bool
+	}{
+		{"SELECT 1", "SELECT /*+ MAX_EXECUTION_TIME(100) */ 1", true},
+		{"  select\n*", "  select /*+ MAX_EXECUTION_TIME(100) */\n*", true},
+		{"SELECT", "SELECT /*+ MAX_EXECUTION_TIME(100) */", true},
+		{"SELECTED", "SELECTED", false},
+		{"INSERT INTO foo SELECT 1", "INSERT INTO foo SELECT 1", false},
+		{"", "", false},
+	}
+	for _, tst := range tests {
+		actual, ok := addMaxExecTimeHint(tst.query, 100)
+		if actual != tst.expected || ok != tst.ok {
+			t.Errorf("%q: expected %q (%t), got %q (%t)", tst.query, tst.expected, tst.ok, actual, ok)
+		}
+	}
+}
+
+func TestSplitInsertValues(t *testing.T) {
+	tests := []struct {
+		query  string
+		head   string
+		values string
+		tail   string
+		ok     bool
+	}{
+		{"INSERT INTO foo VALUES (?, ?)", "INSERT INTO foo VALUES ", "(?, ?)", "", true},
+		{"insert into foo(a,b)values(?,NOW())", "insert into foo(a,b)values", "(?,NOW())", "", true},
+		{"REPLACE foo VALUES (?, ')')", "REPLACE foo VALUES ", "(?, ')')", "", true},
+		{"INSERT INTO foo (a) VALUES (?) ON DUPLICATE KEY UPDATE a=VALUES(a)", "INSERT INTO foo (a) VALUES ", "(?)", " ON DUPLICATE KEY UPDATE a=VALUES(a)", true},
+		{"INSERT INTO myvalues SELECT ?", "", "", "", false},
+		{"INSERT INTO foo VALUES (?), (?)", "", "", "", false},
+		{"INSERT INTO foo (a) VALUES (?) ON DUPLICATE KEY UPDATE a=?", "", "", "", false},
+		{"INSERT INTO foo VALUES (?", "", "", "", false},
+		{"UPDATE foo SET a=?", "", "", "", false},
+	}
+	for _, tst := range tests {
+		head, values, tail, ok := splitInsertValues(tst.query)
+		if head != tst.head || values != tst.values || tail != tst.tail || ok != tst.ok {
+			t.Errorf("%q: expected %q %q %q (%t), got %q %q %q (%t)", tst.query,
+				tst.head, tst.values, tst.tail, tst.ok, head, values, tail, ok)
+		}
+	}
+}
+
+func TestIsVarName(t *testing.T) {
+	for _, name := range []string{"sql_mode", "group_concat_max_len", "A1"} {
+		if !isVarName(name) {
+			t.Errorf("expected %q to be valid", name)
+		}
+	}
+	for _, name := range []string{"", "sql mode", "a=1", "a;DROP TABLE b", "@@a", "a.b"} {
+		if isVarName(name) {
+			t.Errorf("expected %q to be invalid", name)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		str      string
+		expected time.Duration
+		valid    bool
+	}{
+		{"00:00:00", 0, true},
+		{"838:59:59", 838*time.Hour + 59*time.Minute + 59*time.Second, true},
+		{"-838:59:59.000000", -(838*time.Hour + 59*time.Minute + 59*time.Second), true},
+		{"12:34:56.789", 12*time.Hour + 34*time.Minute + 56*time.Second + 789*time.Millisecond, true},
+		{"-00:00:01.5", -1500 * time.Millisecond, true},
+		{"12:60:00", 0, false},
+		{"12:34", 0, false},
+		{"+12:34:56", 0, false},
+		{"12:34:56.", 0, false},
+		{"", 0, false},
+	}
+	for _, tst := range tests {
+		d, err := parseDuration(tst.str)
+		if (err == nil) != tst.valid {
+			t.Errorf("%q: expected valid %t, got error %v", tst.str, tst.valid, err)
+			continue
+		}
+		if d != tst.expected {
+			t.Errorf("%q: expected %v, got %v", tst.str, tst.expected, d)
+		}
+	}
+}
+
+func TestSupportsUtf8mb4(t *testing.T) {
+	tests := []struct {
+		version  string
+		expected bool
+	}{
+		{"5.1.73-log", false},
+		{"5.5.2-m2", false},
+		{"5.5.3-m3", true},
+		{"5.6.10", true},
+		{"5.5.5-10.1.14-MariaDB", true},
+		{"8.0.30", true},
+		{"4.1.22", false},
+		{"unknown", true},
+	}
+	for _, tst := range tests {
+		if actual := supportsUtf8mb4(tst.version); actual != tst.expected {
+			t.Errorf("%s: expected %t, got %t", tst.version, tst.expected, actual)
+		}
+	}
+}
+
+func TestRegisterTLSConfigFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gmysql-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "gmysql test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)})
+	if err = ioutil.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	const key = "files_test"
+	defer DeregisterTLSConfig(key)
+
+	// the self-signed certificate doubles as CA
+	if err = RegisterTLSConfigFiles(key, certFile, certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := ParseDSN("user@tcp(localhost:3306)/dbname?tls=" + key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.TLS == nil || cfg.TLS.RootCAs == nil {
+		t.Fatal("expected the CA certificate to be loaded")
+	}
+	if len(cfg.TLS.Certificates) != 1 {
+		t.Fatalf("expected 1 client certificate, got %d", len(cfg.TLS.Certificates))
+	}
+
+	// a key file is not a CA certificate
+	if err = RegisterTLSConfigFiles(key, keyFile, "", ""); err == nil {
+		t.Error("expected error for invalid CA file")
+	}
+	if err = RegisterTLSConfigFiles(key, "", certFile, ""); err == nil {
+		t.Error("expected error for missing key file")
+	}
+	if err = RegisterTLSConfigFiles("true", "", "", ""); err == nil {
+		t.Error("expected error for reserved key")
+	}
 }